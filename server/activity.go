@@ -11,27 +11,31 @@ import (
 type ActivityType string
 
 var (
-	ADDED_WATCHED             ActivityType = "ADDED_WATCHED"
-	REMOVED_WATCHED           ActivityType = "REMOVED_WATCHED"
-	RATING_CHANGED            ActivityType = "RATING_CHANGED"
-	STATUS_CHANGED            ActivityType = "STATUS_CHANGED"
-	THOUGHTS_CHANGED          ActivityType = "THOUGHTS_CHANGED"
-	THOUGHTS_REMOVED          ActivityType = "THOUGHTS_REMOVED"
-	IMPORTED_WATCHED          ActivityType = "IMPORTED_WATCHED"
-	IMPORTED_WATCHED_JF       ActivityType = "IMPORTED_WATCHED_JF"
-	IMPORTED_RATING           ActivityType = "IMPORTED_RATING"        // Imported rating, but with no rating acts as original import of content to old platform (where they are importing from) activity
-	IMPORTED_ADDED_WATCHED    ActivityType = "IMPORTED_ADDED_WATCHED" // Imported watched date, so we can save the original watch dates of content from users old platform (where they are importing from).
-	IMPORTED_ADDED_WATCHED_JF ActivityType = "IMPORTED_ADDED_WATCHED_JF"
-	SEASON_ADDED              ActivityType = "SEASON_ADDED"
-	SEASON_ADDED_JF           ActivityType = "SEASON_ADDED_JF"
-	SEASON_REMOVED            ActivityType = "SEASON_REMOVED"
-	SEASON_RATING_CHANGED     ActivityType = "SEASON_RATING_CHANGED"
-	SEASON_STATUS_CHANGED     ActivityType = "SEASON_STATUS_CHANGED"
-	EPISODE_ADDED             ActivityType = "EPISODE_ADDED"
-	EPISODE_ADDED_JF          ActivityType = "EPISODE_ADDED_JF"
-	EPISODE_REMOVED           ActivityType = "EPISODE_REMOVED"
-	EPISODE_RATING_CHANGED    ActivityType = "EPISODE_RATING_CHANGED"
-	EPISODE_STATUS_CHANGED    ActivityType = "EPISODE_STATUS_CHANGED"
+	ADDED_WATCHED               ActivityType = "ADDED_WATCHED"
+	REMOVED_WATCHED             ActivityType = "REMOVED_WATCHED"
+	RATING_CHANGED              ActivityType = "RATING_CHANGED"
+	STATUS_CHANGED              ActivityType = "STATUS_CHANGED"
+	THOUGHTS_CHANGED            ActivityType = "THOUGHTS_CHANGED"
+	THOUGHTS_REMOVED            ActivityType = "THOUGHTS_REMOVED"
+	IMPORTED_WATCHED            ActivityType = "IMPORTED_WATCHED"
+	IMPORTED_WATCHED_JF         ActivityType = "IMPORTED_WATCHED_JF"
+	IMPORTED_WATCHED_EMBY       ActivityType = "IMPORTED_WATCHED_EMBY"
+	IMPORTED_RATING             ActivityType = "IMPORTED_RATING"        // Imported rating, but with no rating acts as original import of content to old platform (where they are importing from) activity
+	IMPORTED_ADDED_WATCHED      ActivityType = "IMPORTED_ADDED_WATCHED" // Imported watched date, so we can save the original watch dates of content from users old platform (where they are importing from).
+	IMPORTED_ADDED_WATCHED_JF   ActivityType = "IMPORTED_ADDED_WATCHED_JF"
+	IMPORTED_ADDED_WATCHED_EMBY ActivityType = "IMPORTED_ADDED_WATCHED_EMBY"
+	SEASON_ADDED                ActivityType = "SEASON_ADDED"
+	SEASON_ADDED_JF             ActivityType = "SEASON_ADDED_JF"
+	SEASON_REMOVED              ActivityType = "SEASON_REMOVED"
+	SEASON_RATING_CHANGED       ActivityType = "SEASON_RATING_CHANGED"
+	SEASON_STATUS_CHANGED       ActivityType = "SEASON_STATUS_CHANGED"
+	EPISODE_ADDED               ActivityType = "EPISODE_ADDED"
+	EPISODE_ADDED_JF            ActivityType = "EPISODE_ADDED_JF"
+	EPISODE_REMOVED             ActivityType = "EPISODE_REMOVED"
+	EPISODE_RATING_CHANGED      ActivityType = "EPISODE_RATING_CHANGED"
+	EPISODE_STATUS_CHANGED      ActivityType = "EPISODE_STATUS_CHANGED"
+	AUTO_REQUESTED              ActivityType = "AUTO_REQUESTED"    // Planned content was automatically requested, data holds the outcome.
+	CONTENT_AVAILABLE           ActivityType = "CONTENT_AVAILABLE" // Content was imported by sonarr/radarr, data holds the episodes for shows.
 )
 
 type Activity struct {
@@ -0,0 +1,257 @@
+// User management for admins.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User details shown to admins in the user management list.
+type AdminUser struct {
+	ID                    uint       `json:"id"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	Username              string     `json:"username"`
+	Type                  UserType   `json:"type"`
+	Permissions           int        `json:"permissions"`
+	Disabled              bool       `json:"disabled"`
+	PasswordResetRequired bool       `json:"passwordResetRequired"`
+	SeerrUserID           int        `json:"seerrUserId"`
+	LastActivity          *time.Time `json:"lastActivity" gorm:"-"`
+}
+
+type AdminUserStats struct {
+	Profile
+	WatchedItems int64 `json:"watchedItems"`
+	Activities   int64 `json:"activities"`
+	Following    int64 `json:"following"`
+	Followers    int64 `json:"followers"`
+}
+
+type AdminUserPermissionRequest struct {
+	// The permission bit to grant or revoke (eg PERM_ADMIN).
+	Permission int `json:"permission" binding:"required"`
+	// True to grant the permission, false to revoke it.
+	Grant bool `json:"grant"`
+}
+
+type AdminUserSeerrUserRequest struct {
+	// Overseerr/Jellyseerr user to request as, 0 to match by linked identity.
+	SeerrUserID int `json:"seerrUserId" binding:"min=0"`
+}
+
+// Permissions admins are allowed to grant/revoke.
+var grantablePermissions = []int{PERM_ADMIN, PERM_REQUEST_CONTENT}
+
+func getAllUsers(db *gorm.DB) ([]AdminUser, error) {
+	users := []AdminUser{}
+	res := db.Model(&User{}).Find(&users)
+	if res.Error != nil {
+		slog.Error("getAllUsers: Failed to get users", "error", res.Error)
+		return []AdminUser{}, errors.New("failed to get users")
+	}
+	// Get everyones last activity in one go, instead of a query per user.
+	// The grouped max only picks the rows, since sqlite returns aggregated
+	// dates as strings that can't be scanned into a time.
+	var lastActivities []Activity
+	res = db.Model(&Activity{}).Select("user_id, created_at").
+		Where("(user_id, created_at) IN (?)", db.Model(&Activity{}).Select("user_id, MAX(created_at)").Group("user_id")).
+		Find(&lastActivities)
+	if res.Error != nil {
+		slog.Error("getAllUsers: Failed to get last activity for users", "error", res.Error)
+		return users, nil
+	}
+	lastActivity := make(map[uint]time.Time, len(lastActivities))
+	for _, a := range lastActivities {
+		lastActivity[a.UserID] = a.CreatedAt
+	}
+	for i, u := range users {
+		if t, ok := lastActivity[u.ID]; ok {
+			users[i].LastActivity = &t
+		}
+	}
+	return users, nil
+}
+
+func getUserForAdmin(db *gorm.DB, userId uint) (User, error) {
+	var user User
+	res := db.Where("id = ?", userId).Take(&user)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return User{}, errors.New("user not found")
+		}
+		slog.Error("getUserForAdmin: Failed to get user", "user_id", userId, "error", res.Error)
+		return User{}, errors.New("failed to get user")
+	}
+	return user, nil
+}
+
+// Grant or revoke a permission for a user.
+// Returns the users new permissions.
+func adminUpdateUserPermission(db *gorm.DB, currentUserId uint, userId uint, pr AdminUserPermissionRequest) (int, error) {
+	grantable := false
+	for _, p := range grantablePermissions {
+		if p == pr.Permission {
+			grantable = true
+			break
+		}
+	}
+	if !grantable {
+		return 0, errors.New("invalid permission")
+	}
+	if currentUserId == userId && pr.Permission == PERM_ADMIN && !pr.Grant {
+		return 0, errors.New("you can't remove your own admin permission")
+	}
+	user, err := getUserForAdmin(db, userId)
+	if err != nil {
+		return 0, err
+	}
+	perms := user.Permissions
+	if pr.Grant {
+		perms |= pr.Permission
+	} else {
+		perms &^= pr.Permission
+	}
+	if err := db.Model(&User{}).Where("id = ?", userId).Update("permissions", perms).Error; err != nil {
+		slog.Error("adminUpdateUserPermission: Failed to update permissions", "user_id", userId, "error", err)
+		return 0, errors.New("failed to update permissions")
+	}
+	slog.Info("adminUpdateUserPermission: Users permissions updated", "user_id", userId, "by_user_id", currentUserId, "old_perms", user.Permissions, "new_perms", perms)
+	return perms, nil
+}
+
+// Disable or enable a users account.
+// Disabling also logs the user out everywhere.
+func adminSetUserDisabled(db *gorm.DB, currentUserId uint, userId uint, disabled bool) error {
+	if currentUserId == userId {
+		return errors.New("you can't disable your own account")
+	}
+	if _, err := getUserForAdmin(db, userId); err != nil {
+		return err
+	}
+	if err := db.Model(&User{}).Where("id = ?", userId).Update("disabled", disabled).Error; err != nil {
+		slog.Error("adminSetUserDisabled: Failed to update user", "user_id", userId, "error", err)
+		return errors.New("failed to update user")
+	}
+	if disabled {
+		revokeUserSessions(db, userId)
+	}
+	slog.Info("adminSetUserDisabled: User updated", "user_id", userId, "by_user_id", currentUserId, "disabled", disabled)
+	return nil
+}
+
+// Remove a users account and all of their data.
+// Returns an export of their data first if requested.
+func adminDeleteUser(db *gorm.DB, currentUserId uint, userId uint, export bool) (*UserDataExport, error) {
+	if currentUserId == userId {
+		return nil, errors.New("you can't delete your own account from here")
+	}
+	if _, err := getUserForAdmin(db, userId); err != nil {
+		return nil, err
+	}
+	var e *UserDataExport
+	if export {
+		ex, err := exportUserData(db, userId)
+		if err != nil {
+			slog.Error("adminDeleteUser: Failed to export user data", "user_id", userId, "error", err)
+			return nil, errors.New("failed to export data")
+		}
+		e = &ex
+	}
+	if err := purgeUser(db, userId); err != nil {
+		return nil, err
+	}
+	slog.Info("adminDeleteUser: User deleted", "user_id", userId, "by_user_id", currentUserId)
+	return e, nil
+}
+
+// Require a user to change their password the next time they login.
+// Only users with a Watcharr login have a password we can reset.
+func adminForcePasswordReset(db *gorm.DB, userId uint) error {
+	if _, err := getUserForAdmin(db, userId); err != nil {
+		return err
+	}
+	if !userHasPassword(db, userId) {
+		return errors.New("only watcharr users have a password to reset")
+	}
+	if err := db.Model(&User{}).Where("id = ?", userId).Update("password_reset_required", true).Error; err != nil {
+		slog.Error("adminForcePasswordReset: Failed to update user", "user_id", userId, "error", err)
+		return errors.New("failed to update user")
+	}
+	setPasswordResetRequired(userId, true)
+	revokeUserSessions(db, userId)
+	return nil
+}
+
+// Set the Overseerr/Jellyseerr user a user makes requests as.
+func adminSetUserSeerrUser(db *gorm.DB, userId uint, seerrUserId int) error {
+	if _, err := getUserForAdmin(db, userId); err != nil {
+		return err
+	}
+	if seerrUserId != 0 {
+		users, err := getSeerrUsers()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, u := range users {
+			if u.ID == seerrUserId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("overseerr/jellyseerr user not found")
+		}
+	}
+	if err := db.Model(&User{}).Where("id = ?", userId).Update("seerr_user_id", seerrUserId).Error; err != nil {
+		slog.Error("adminSetUserSeerrUser: Failed to update user", "user_id", userId, "error", err)
+		return errors.New("failed to update user")
+	}
+	return nil
+}
+
+func adminGetUserStats(db *gorm.DB, userId uint) (AdminUserStats, error) {
+	if _, err := getUserForAdmin(db, userId); err != nil {
+		return AdminUserStats{}, err
+	}
+	profile, err := getProfile(db, userId)
+	if err != nil {
+		return AdminUserStats{}, err
+	}
+	stats := AdminUserStats{Profile: profile}
+	if res := db.Model(&Watched{}).Where("user_id = ?", userId).Count(&stats.WatchedItems); res.Error != nil {
+		slog.Error("adminGetUserStats - WatchedItems query failed", "error", res.Error)
+	}
+	if res := db.Model(&Activity{}).Where("user_id = ?", userId).Count(&stats.Activities); res.Error != nil {
+		slog.Error("adminGetUserStats - Activities query failed", "error", res.Error)
+	}
+	if res := db.Model(&Follow{}).Where("user_id = ?", userId).Count(&stats.Following); res.Error != nil {
+		slog.Error("adminGetUserStats - Following query failed", "error", res.Error)
+	}
+	if res := db.Model(&Follow{}).Where("followed_user_id = ?", userId).Count(&stats.Followers); res.Error != nil {
+		slog.Error("adminGetUserStats - Followers query failed", "error", res.Error)
+	}
+	return stats, nil
+}
+
+// Snapshot of a users admin managed details, for the audit log.
+func adminUserAuditSnapshot(db *gorm.DB, userId uint) any {
+	user, err := getUserForAdmin(db, userId)
+	if err != nil {
+		return nil
+	}
+	return auditSnapshot(AdminUser{
+		ID:                    user.ID,
+		CreatedAt:             user.CreatedAt,
+		Username:              user.Username,
+		Type:                  user.Type,
+		Permissions:           user.Permissions,
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		SeerrUserID:           user.SeerrUserID,
+	})
+}
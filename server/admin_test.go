@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAllUsersLastActivity(t *testing.T) {
+	db := newTestDB(t, &Image{}, &User{}, &Activity{})
+	users := []User{{Username: "active"}, {Username: "inactive"}, {Username: "deleted activity"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal("failed to create users:", err)
+	}
+	newest := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	activities := []Activity{
+		{UserID: users[0].ID, Type: ADDED_WATCHED, GormModel: GormModel{CreatedAt: newest.Add(-48 * time.Hour)}},
+		{UserID: users[0].ID, Type: RATING_CHANGED, GormModel: GormModel{CreatedAt: newest}},
+		{UserID: users[0].ID, Type: STATUS_CHANGED, GormModel: GormModel{CreatedAt: newest.Add(-time.Hour)}},
+		{UserID: users[2].ID, Type: ADDED_WATCHED, GormModel: GormModel{CreatedAt: newest}},
+	}
+	if err := db.Create(&activities).Error; err != nil {
+		t.Fatal("failed to create activities:", err)
+	}
+	if err := db.Delete(&activities[3]).Error; err != nil {
+		t.Fatal("failed to delete activity:", err)
+	}
+
+	got, err := getAllUsers(db)
+	if err != nil {
+		t.Fatal("getAllUsers() error:", err)
+	}
+	if len(got) != len(users) {
+		t.Fatalf("getAllUsers() returned %d users, want %d", len(got), len(users))
+	}
+	want := map[uint]*time.Time{users[0].ID: &newest, users[1].ID: nil, users[2].ID: nil}
+	for _, u := range got {
+		w := want[u.ID]
+		switch {
+		case w == nil && u.LastActivity != nil:
+			t.Errorf("user %d last activity = %v, want none", u.ID, u.LastActivity)
+		case w != nil && (u.LastActivity == nil || !u.LastActivity.Equal(*w)):
+			t.Errorf("user %d last activity = %v, want %v", u.ID, u.LastActivity, *w)
+		}
+	}
+}
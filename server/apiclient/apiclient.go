@@ -0,0 +1,114 @@
+// Http client for the json apis of services we talk to with an api key
+// (Sonarr/Radarr and Overseerr/Jellyseerr), so they can share transports
+// and how requests are built and responses read.
+
+package apiclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Used when Options.Timeout isn't set.
+const DefaultTimeout = 30 * time.Second
+
+type Options struct {
+	// How long a request can take (including reading the response).
+	Timeout time.Duration
+	// Don't verify the servers certificate, for installs using a self-signed one.
+	SkipTLSVerify bool
+}
+
+// Transports are shared by every client so connections get reused.
+var (
+	transport         = http.DefaultTransport.(*http.Transport).Clone()
+	insecureTransport = func() *http.Transport {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		return t
+	}()
+)
+
+type Client struct {
+	// Name of the service, for logs.
+	Service string
+	Host    string
+	// Path all endpoints are under (eg `/api/v3`).
+	BasePath string
+	// Sent as the `X-Api-Key` header.
+	Key string
+	// Build the error returned for non 2xx responses from their body.
+	ParseError func(statusCode int, body []byte) error
+	client     *http.Client
+}
+
+func New(service string, host string, basePath string, key string, o Options, parseError func(int, []byte) error) *Client {
+	c := &http.Client{Timeout: o.Timeout, Transport: transport}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if o.SkipTLSVerify {
+		c.Transport = insecureTransport
+	}
+	return &Client{Service: service, Host: host, BasePath: basePath, Key: key, ParseError: parseError, client: c}
+}
+
+// Run a request against the api.
+// `body` is sent as json if not nil, the response is decoded into `resp` if not nil.
+func (c *Client) Do(method string, ep string, query map[string]string, body interface{}, resp interface{}) error {
+	slog.Debug("api request", "service", c.Service, "method", method, "endpoint", ep, "query", query)
+	base, err := url.Parse(c.Host)
+	if err != nil {
+		return errors.New("failed to parse api uri")
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + c.BasePath + ep
+	params := url.Values{}
+	for k, v := range query {
+		params.Add(k, v)
+	}
+	base.RawQuery = params.Encode()
+
+	var reqBody io.Reader
+	if body != nil {
+		jsonb, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(jsonb)
+	}
+	req, err := http.NewRequest(method, base.String(), reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", c.Key)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		slog.Debug("api non 2xx status code", "service", c.Service, "status_code", res.StatusCode, "body", string(data))
+		return c.ParseError(res.StatusCode, data)
+	}
+	if resp != nil && len(data) > 0 {
+		return json.Unmarshal(data, resp)
+	}
+	return nil
+}
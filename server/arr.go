@@ -3,14 +3,24 @@ package main
 import (
 	"errors"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sbondCo/Watcharr/arr"
 )
 
 type ArrSettings struct {
 	Name string `json:"name,omitempty"`
-	Host string `json:"host,omitempty"`
-	Key  string `json:"key,omitempty"`
+	ArrConnection
+	// Send content that users (who have opted in) add to their
+	// planned list to this server. The first enabled server is used.
+	AutoRequestPlanned bool `json:"autoRequestPlanned"`
+	// Ids of tags added to all content sent to this server.
+	Tags []int `json:"tags,omitempty"`
+	// Also tag content with who requested it (as `watcharr-{username}`).
+	TagRequester bool `json:"tagRequester"`
 }
 
 type SonarrSettings struct {
@@ -19,12 +29,19 @@ type SonarrSettings struct {
 	RootFolder      int  `json:"rootFolder,omitempty"`
 	LanguageProfile int  `json:"languageProfile,omitempty"`
 	AutomaticSearch bool `json:"automaticSearch"`
-	// TODO eventually separate profiles and root for anime content (i can see diff language profile being useful)
+	// Optional: Used instead of the above when adding anime.
+	AnimeQualityProfile  int `json:"animeQualityProfile,omitempty"`
+	AnimeRootFolder      int `json:"animeRootFolder,omitempty"`
+	AnimeLanguageProfile int `json:"animeLanguageProfile,omitempty"`
+	// Series type for anime, `anime` if unset.
+	AnimeSeriesType string `json:"animeSeriesType,omitempty" binding:"omitempty,oneof=standard daily anime"`
+	// Which episodes are monitored when adding a show, sonarrs default (all) if unset.
+	MonitorMode string `json:"monitorMode,omitempty" binding:"omitempty,oneof=all future firstSeason latestSeason"`
 }
 
-func (s *SonarrSettings) safe() SonarrSettings {
+func (s SonarrSettings) safe() SonarrSettings {
 	s.Key = ""
-	return *s
+	return s
 }
 
 type RadarrSettings struct {
@@ -32,32 +49,50 @@ type RadarrSettings struct {
 	QualityProfile  int  `json:"qualityProfile,omitempty"`
 	RootFolder      int  `json:"rootFolder,omitempty"`
 	AutomaticSearch bool `json:"automaticSearch"`
+	// When movies are considered available, radarrs default (announced) if unset.
+	MinimumAvailability string `json:"minimumAvailability,omitempty" binding:"omitempty,oneof=announced inCinemas released"`
 }
 
-func (s *RadarrSettings) safe() RadarrSettings {
+func (s RadarrSettings) safe() RadarrSettings {
 	s.Key = ""
-	return *s
+	return s
 }
 
-type ArrTestParams struct {
+// How to connect to an arr.
+// Also used on its own to test a server before it's added.
+type ArrConnection struct {
 	Host string `json:"host,omitempty"`
 	Key  string `json:"key,omitempty"`
+	// Optional: Request timeout in seconds, defaults to 30.
+	Timeout int `json:"timeout,omitempty"`
+	// Optional: Don't verify the servers certificate (for self-signed installs).
+	SkipTLSVerify bool `json:"skipTlsVerify,omitempty"`
+}
+
+// Get a client for the server.
+func (c ArrConnection) client(t arr.ArrType) *arr.Arr {
+	return arr.New(t, c.Host, c.Key, arr.Options{
+		Timeout:       time.Duration(c.Timeout) * time.Second,
+		SkipTLSVerify: c.SkipTLSVerify,
+	})
 }
 
 type SonarrTestResponse struct {
 	QualityProfiles  []arr.QualityProfile  `json:"qualityProfiles"`
 	RootFolders      []arr.RootFolder      `json:"rootFolders"`
 	LanguageProfiles []arr.LanguageProfile `json:"languageProfiles"`
+	Tags             []arr.Tag             `json:"tags"`
 }
 
 type RadarrTestResponse struct {
 	QualityProfiles  []arr.QualityProfile  `json:"qualityProfiles"`
 	RootFolders      []arr.RootFolder      `json:"rootFolders"`
 	LanguageProfiles []arr.LanguageProfile `json:"languageProfiles"`
+	Tags             []arr.Tag             `json:"tags"`
 }
 
-func testSonarr(p ArrTestParams) (SonarrTestResponse, error) {
-	sonarr := arr.New(arr.SONARR, &p.Host, &p.Key)
+func testSonarr(p ArrConnection) (SonarrTestResponse, error) {
+	sonarr := p.client(arr.SONARR)
 	qps, err := sonarr.GetQualityProfiles()
 	if err != nil {
 		slog.Error("testSonarr failed to get quality profiles!", "error", err)
@@ -73,11 +108,16 @@ func testSonarr(p ArrTestParams) (SonarrTestResponse, error) {
 		slog.Error("testSonarr failed to get language profiles!", "error", err)
 		return SonarrTestResponse{}, errors.New("failed to get language profiles")
 	}
-	return SonarrTestResponse{QualityProfiles: qps, RootFolders: rfs, LanguageProfiles: lps}, nil
+	tags, err := sonarr.GetTags()
+	if err != nil {
+		slog.Error("testSonarr failed to get tags!", "error", err)
+		return SonarrTestResponse{}, errors.New("failed to get tags")
+	}
+	return SonarrTestResponse{QualityProfiles: qps, RootFolders: rfs, LanguageProfiles: lps, Tags: tags}, nil
 }
 
-func testRadarr(p ArrTestParams) (RadarrTestResponse, error) {
-	radarr := arr.New(arr.RADARR, &p.Host, &p.Key)
+func testRadarr(p ArrConnection) (RadarrTestResponse, error) {
+	radarr := p.client(arr.RADARR)
 	qps, err := radarr.GetQualityProfiles()
 	if err != nil {
 		slog.Error("testRadarr failed to get quality profiles!", "error", err)
@@ -88,117 +128,321 @@ func testRadarr(p ArrTestParams) (RadarrTestResponse, error) {
 		slog.Error("testRadarr failed to get root folders!", "error", err)
 		return RadarrTestResponse{}, errors.New("failed to get root folders")
 	}
-	return RadarrTestResponse{QualityProfiles: qps, RootFolders: rfs}, nil
+	tags, err := radarr.GetTags()
+	if err != nil {
+		slog.Error("testRadarr failed to get tags!", "error", err)
+		return RadarrTestResponse{}, errors.New("failed to get tags")
+	}
+	return RadarrTestResponse{QualityProfiles: qps, RootFolders: rfs, Tags: tags}, nil
 }
 
-// TODO any way to simplify (deduplicate/reuse) these methods (and the whole file tbh) would be very good
+// Get the path of a root folder from its id.
+// Our server settings store the id, but requests need the path.
+func getArrRootFolderPath(a *arr.Arr, id int) (string, error) {
+	rfs, err := a.GetRootFolders()
+	if err != nil {
+		return "", errors.New("failed to get root folders")
+	}
+	for _, v := range rfs {
+		if v.ID == id {
+			return v.Path, nil
+		}
+	}
+	slog.Error("getArrRootFolderPath: Root folder not found", "service", a.Type, "id", id)
+	return "", errors.New("root folder not found")
+}
 
-// Add sonarr server to config
-func addSonarr(s SonarrSettings) error {
-	for _, v := range Config.SONARR {
-		if v.Name == s.Name {
-			// Server exists with this name...
-			return errors.New("server with that name already exists")
+// Get the tags to add to content being sent to a server.
+// Combines the tags from the request with the servers tags and,
+// if enabled, the requesters tag (created if it doesn't exist yet).
+func getArrRequestTags(a *arr.Arr, server ArrSettings, tags []int, requester string) []int {
+	out := slices.Clone(tags)
+	for _, t := range server.Tags {
+		if !slices.Contains(out, t) {
+			out = append(out, t)
 		}
 	}
-	Config.SONARR = append(Config.SONARR, s)
-	writeConfig()
-	return nil
+	if !server.TagRequester || requester == "" {
+		return out
+	}
+	t, err := getArrRequesterTag(a, requester)
+	if err != nil {
+		// Not worth failing the request over.
+		slog.Error("getArrRequestTags: Failed to get requester tag", "server", server.Name, "requester", requester, "error", err)
+		return out
+	}
+	if !slices.Contains(out, t) {
+		out = append(out, t)
+	}
+	return out
 }
 
-// Edit sonarr server in config
-func editSonarr(s SonarrSettings) error {
-	for i, v := range Config.SONARR {
-		if v.Name == s.Name {
-			Config.SONARR[i] = s
-			writeConfig()
-			return nil
+// Label of a users tag on arr servers.
+// Arrs only allow lowercase letters, numbers and dashes in tags.
+func arrRequesterTagLabel(username string) string {
+	return "watcharr-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(username))
+}
+
+// Get the id of a users tag on a server, creating it if needed.
+func getArrRequesterTag(a *arr.Arr, username string) (int, error) {
+	label := arrRequesterTagLabel(username)
+	tags, err := a.GetTags()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tags {
+		if t.Label == label {
+			return t.ID, nil
 		}
 	}
-	return errors.New("can't edit server that does not exist")
+	t, err := a.CreateTag(label)
+	if err != nil {
+		return 0, err
+	}
+	return t.ID, nil
 }
 
-func rmSonarr(name string) error {
-	for i, v := range Config.SONARR {
-		if v.Name == name {
-			Config.SONARR = append(Config.SONARR[:i], Config.SONARR[i+1:]...)
-			writeConfig()
-			return nil
+// Get the anime options of a sonarr server for requests,
+// with its root folder id converted to a path.
+func getSonarrAnimeOptions(sonarr *arr.Arr, server SonarrSettings) (arr.SonarrAnimeOptions, error) {
+	o := arr.SonarrAnimeOptions{
+		QualityProfile:  server.AnimeQualityProfile,
+		LanguageProfile: server.AnimeLanguageProfile,
+		SeriesType:      server.AnimeSeriesType,
+	}
+	if server.AnimeRootFolder != 0 {
+		rf, err := getArrRootFolderPath(sonarr, server.AnimeRootFolder)
+		if err != nil {
+			return arr.SonarrAnimeOptions{}, err
 		}
+		o.RootFolder = rf
 	}
-	return errors.New("can't remove a server that does not exist")
+	return o, nil
 }
 
-func getSonarr(name string) (SonarrSettings, error) {
-	for i, v := range Config.SONARR {
-		if v.Name == name {
-			return Config.SONARR[i], nil
+// TMDB keyword for anime.
+const tmdbAnimeKeywordId = 210024
+
+// TMDB genre for animation.
+const tmdbAnimationGenreId = 16
+
+// If a show looks like anime, either by its anime keyword
+// or by being animation from Japan.
+// Show must have been fetched with its keywords appended.
+func isAnimeShow(show TMDBShowDetails) bool {
+	for _, k := range show.Keywords.Results {
+		if k.ID == tmdbAnimeKeywordId {
+			return true
 		}
 	}
-	return SonarrSettings{}, errors.New("server not found")
+	animation := false
+	for _, g := range show.Genres {
+		if g.ID == tmdbAnimationGenreId {
+			animation = true
+			break
+		}
+	}
+	return animation && slices.Contains(show.OriginCountry, "JP")
 }
 
-// Get list of sonarr servers without api keys.
-// Regular users with access to adding to sonarr will request this.
-func getSonarrsSafe() []SonarrSettings {
-	s := []SonarrSettings{}
-	for _, v := range Config.SONARR {
-		s = append(s, v.safe())
+// If the show with a tvdb id looks like anime, see `isAnimeShow`.
+func isAnimeShowByTvdbId(tvdbId int) (bool, error) {
+	id, err := findShowByTvdbId(tvdbId)
+	if err != nil {
+		return false, err
 	}
-	return s
+	show := new(TMDBShowDetails)
+	if err := tmdbRequest("/tv/"+strconv.Itoa(id), map[string]string{"append_to_response": "keywords"}, &show); err != nil {
+		slog.Error("isAnimeShowByTvdbId: Failed to get show details", "tmdb_id", id, "error", err)
+		return false, errors.New("failed to get show details")
+	}
+	return isAnimeShow(*show), nil
 }
 
-// Add radarr server to config
-func addRadarr(s RadarrSettings) error {
-	for _, v := range Config.RADARR {
-		if v.Name == s.Name {
+type ArrContentState string
+
+var (
+	// Not added to the server.
+	ARR_CONTENT_MISSING ArrContentState = "MISSING"
+	// Added and monitored, but not (fully) downloaded yet.
+	ARR_CONTENT_MONITORED ArrContentState = "MONITORED"
+	// Added, but not monitored and not downloaded.
+	ARR_CONTENT_UNMONITORED ArrContentState = "UNMONITORED"
+	ARR_CONTENT_DOWNLOADED  ArrContentState = "DOWNLOADED"
+)
+
+// State of content on one sonarr/radarr server.
+type ArrContentStatus struct {
+	ArrType    arr.ArrType     `json:"arrType"`
+	ServerName string          `json:"serverName"`
+	State      ArrContentState `json:"state,omitempty"`
+	// Percentage of episodes downloaded, for shows.
+	Progress float64 `json:"progress,omitempty"`
+	// Set if we couldn't check this server.
+	Error string `json:"error,omitempty"`
+}
+
+// Get the state of content on every sonarr (for shows)
+// or radarr (for movies) server we have configured.
+func getArrContentStatus(contentType ContentType, tmdbId int) ([]ArrContentStatus, error) {
+	statuses := []ArrContentStatus{}
+	if contentType == MOVIE {
+		for _, server := range Config.RADARR {
+			st := ArrContentStatus{ArrType: arr.RADARR, ServerName: server.Name}
+			m, err := server.client(arr.RADARR).LookupMovie(tmdbId)
+			if errors.Is(err, arr.ErrNotFound) {
+				st.State = ARR_CONTENT_MISSING
+			} else if err != nil {
+				st.Error = err.Error()
+			} else if m.HasFile {
+				st.State = ARR_CONTENT_DOWNLOADED
+			} else if m.Monitored {
+				st.State = ARR_CONTENT_MONITORED
+			} else {
+				st.State = ARR_CONTENT_UNMONITORED
+			}
+			statuses = append(statuses, st)
+		}
+		return statuses, nil
+	}
+	if len(Config.SONARR) == 0 {
+		return statuses, nil
+	}
+	tvdbId, err := getShowTvdbId(tmdbId)
+	if err != nil {
+		return []ArrContentStatus{}, err
+	}
+	for _, server := range Config.SONARR {
+		st := ArrContentStatus{ArrType: arr.SONARR, ServerName: server.Name}
+		s, err := server.client(arr.SONARR).LookupSeries(tvdbId)
+		if errors.Is(err, arr.ErrNotFound) {
+			st.State = ARR_CONTENT_MISSING
+		} else if err != nil {
+			st.Error = err.Error()
+		} else if arrSeriesImported(s) {
+			st.State = ARR_CONTENT_DOWNLOADED
+			st.Progress = 100
+		} else {
+			st.Progress = s.Statistics.PercentOfEpisodes
+			if s.Monitored {
+				st.State = ARR_CONTENT_MONITORED
+			} else {
+				st.State = ARR_CONTENT_UNMONITORED
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// Error if content has already been added to the server, so we don't try
+// adding it again and only get the arrs validation error back.
+// `id` is the tmdb id for radarr, or tvdb id for sonarr.
+func ensureNotOnArr(a *arr.Arr, serverName string, id int) error {
+	var err error
+	if a.Type == arr.RADARR {
+		_, err = a.LookupMovie(id)
+	} else {
+		_, err = a.LookupSeries(id)
+	}
+	if err == nil {
+		return errors.New("already added to " + serverName)
+	}
+	if errors.Is(err, arr.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Sonarr and radarr servers are stored the same way, so their config
+// is managed by these generic funcs (wrapped below for each type).
+type arrServer[T any] interface {
+	SonarrSettings | RadarrSettings
+	getName() string
+	// Copy without the api key.
+	safe() T
+}
+
+func (s ArrSettings) getName() string {
+	return s.Name
+}
+
+func addArrServer[T arrServer[T]](servers *[]T, s T) error {
+	for _, v := range *servers {
+		if v.getName() == s.getName() {
 			// Server exists with this name...
 			return errors.New("server with that name already exists")
 		}
 	}
-	Config.RADARR = append(Config.RADARR, s)
-	writeConfig()
-	return nil
+	*servers = append(*servers, s)
+	return writeConfig()
 }
 
-// Edit radarr server in config
-func editRadarr(s RadarrSettings) error {
-	for i, v := range Config.RADARR {
-		if v.Name == s.Name {
-			Config.RADARR[i] = s
-			writeConfig()
-			return nil
+func editArrServer[T arrServer[T]](servers *[]T, s T) error {
+	for i, v := range *servers {
+		if v.getName() == s.getName() {
+			(*servers)[i] = s
+			return writeConfig()
 		}
 	}
 	return errors.New("can't edit server that does not exist")
 }
 
-func rmRadarr(name string) error {
-	for i, v := range Config.RADARR {
-		if v.Name == name {
-			Config.RADARR = append(Config.RADARR[:i], Config.RADARR[i+1:]...)
-			writeConfig()
-			return nil
+func rmArrServer[T arrServer[T]](servers *[]T, name string) error {
+	for i, v := range *servers {
+		if v.getName() == name {
+			*servers = append((*servers)[:i], (*servers)[i+1:]...)
+			return writeConfig()
 		}
 	}
 	return errors.New("can't remove a server that does not exist")
 }
 
-func getRadarr(name string) (RadarrSettings, error) {
-	for i, v := range Config.RADARR {
-		if v.Name == name {
-			return Config.RADARR[i], nil
+func getArrServer[T arrServer[T]](servers []T, name string) (T, error) {
+	for _, v := range servers {
+		if v.getName() == name {
+			return v, nil
 		}
 	}
-	return RadarrSettings{}, errors.New("server not found")
+	var empty T
+	return empty, errors.New("server not found")
 }
 
-// Get list of radarr servers without api keys.
-// Regular users with access to adding to radarr will request this.
-func getRadarrsSafe() []RadarrSettings {
-	s := []RadarrSettings{}
-	for _, v := range Config.RADARR {
+// Get list of servers without api keys.
+// Regular users with access to adding to sonarr/radarr will request this.
+func getArrServersSafe[T arrServer[T]](servers []T) []T {
+	s := []T{}
+	for _, v := range servers {
 		s = append(s, v.safe())
 	}
 	return s
 }
+
+// Add sonarr server to config
+func addSonarr(s SonarrSettings) error { return addArrServer(&Config.SONARR, s) }
+
+// Edit sonarr server in config
+func editSonarr(s SonarrSettings) error { return editArrServer(&Config.SONARR, s) }
+
+func rmSonarr(name string) error { return rmArrServer(&Config.SONARR, name) }
+
+func getSonarr(name string) (SonarrSettings, error) { return getArrServer(Config.SONARR, name) }
+
+func getSonarrsSafe() []SonarrSettings { return getArrServersSafe(Config.SONARR) }
+
+// Add radarr server to config
+func addRadarr(s RadarrSettings) error { return addArrServer(&Config.RADARR, s) }
+
+// Edit radarr server in config
+func editRadarr(s RadarrSettings) error { return editArrServer(&Config.RADARR, s) }
+
+func rmRadarr(name string) error { return rmArrServer(&Config.RADARR, name) }
+
+func getRadarr(name string) (RadarrSettings, error) { return getArrServer(Config.RADARR, name) }
+
+func getRadarrsSafe() []RadarrSettings { return getArrServersSafe(Config.RADARR) }
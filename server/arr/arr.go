@@ -3,13 +3,12 @@
 package arr
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"io"
 	"log/slog"
-	"net/http"
-	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/sbondCo/Watcharr/apiclient"
 )
 
 type ArrType string
@@ -19,15 +18,19 @@ var (
 	RADARR ArrType = "RADARR"
 )
 
+// Returned when the requested item doesn't exist on the arr.
+var ErrNotFound = errors.New("not found")
+
 type Arr struct {
 	// Type of Arr we want to use.
 	// Each servars api might differ, so this will
 	// allow us to make those changes when needed.
 	Type ArrType
 	// Hostname to the Arr sever
-	Host *string
+	Host string
 	// Api key for the Arr server.
-	Key *string
+	Key    string
+	client *apiclient.Client
 }
 
 type ArrRequest struct {
@@ -37,6 +40,7 @@ type ArrRequest struct {
 	AutomaticSearch bool   `json:"automaticSearch"`
 	Title           string `json:"title"` // content name
 	Year            int    `json:"year"`  // content year
+	Tags            []int  `json:"tags"`  // ids
 }
 
 type SonarrRequest struct {
@@ -45,11 +49,28 @@ type SonarrRequest struct {
 	LanguageProfile int             `json:"languageProfile"` // id
 	SeriesType      string          `json:"seriesType"`
 	Seasons         []SonarrSeasons `json:"seasons"`
+	// Which episodes to monitor (all, future, firstSeason or latestSeason).
+	// Seasons are monitored to match when set.
+	MonitorMode string `json:"monitorMode"`
+	// If the show is anime, the Anime options are used
+	// instead of the ones above, when they are set.
+	IsAnime bool               `json:"isAnime"`
+	Anime   SonarrAnimeOptions `json:"-"`
+}
+
+// Servers anime settings, all optional.
+type SonarrAnimeOptions struct {
+	QualityProfile  int    // id
+	LanguageProfile int    // id
+	RootFolder      string // path
+	SeriesType      string
 }
 
 type RadarrRequest struct {
 	ArrRequest
 	TMDBID int `json:"tmdbId"`
+	// When the movie is considered available (announced, inCinemas or released).
+	MinimumAvailability string `json:"minimumAvailability"`
 }
 
 type SonarrSeasons struct {
@@ -57,50 +78,91 @@ type SonarrSeasons struct {
 	Monitored    bool `json:"monitored"`
 }
 
-func New(t ArrType, host *string, key *string) *Arr {
+func New(t ArrType, host string, key string, o Options) *Arr {
 	return &Arr{
 		Type: t,
 		Host: host,
 		Key:  key,
+		client: apiclient.New(string(t), host, "/api/v3", key, o, func(statusCode int, body []byte) error {
+			return parseError(statusCode, body)
+		}),
 	}
 }
 
 func (a *Arr) GetQualityProfiles() ([]QualityProfile, error) {
-	slog.Info("GetQualityProfiles", "type", a.Type, "host", *a.Host, "key", *a.Key)
-	var resp []QualityProfile
-	err := request(*a.Host, "/qualityprofile", map[string]string{"apikey": *a.Key}, &resp)
+	resp, err := get[[]QualityProfile](a, "/qualityprofile", nil)
 	if err != nil {
-		slog.Error("GetQualityProfiles request failed", "service", a.Type, "error", err)
-		return []QualityProfile{}, errors.New("request to service failed")
+		slog.Error("GetQualityProfiles request failed", "service", a.Type, "host", a.Host, "error", err)
+		return []QualityProfile{}, err
 	}
 	return resp, nil
 }
 
 func (a *Arr) GetRootFolders() ([]RootFolder, error) {
-	slog.Info("GetRootFolders", "type", a.Type, "host", *a.Host, "key", *a.Key)
-	var resp []RootFolder
-	err := request(*a.Host, "/rootfolder", map[string]string{"apikey": *a.Key}, &resp)
+	resp, err := get[[]RootFolder](a, "/rootfolder", nil)
 	if err != nil {
-		slog.Error("GetRootFolders request failed", "service", a.Type, "error", err)
-		return []RootFolder{}, errors.New("request to service failed")
+		slog.Error("GetRootFolders request failed", "service", a.Type, "host", a.Host, "error", err)
+		return []RootFolder{}, err
 	}
 	return resp, nil
 }
 
 func (a *Arr) GetLangaugeProfiles() ([]LanguageProfile, error) {
-	slog.Info("GetLangaugeProfiles", "type", a.Type, "host", *a.Host, "key", *a.Key)
-	var resp []LanguageProfile
 	// languageprofile supposedly deprecated.. but new language endpoint doesnt seem to work.. note probs to switch soon
-	err := request(*a.Host, "/languageprofile", map[string]string{"apikey": *a.Key}, &resp)
+	resp, err := get[[]LanguageProfile](a, "/languageprofile", nil)
+	if err != nil {
+		slog.Error("GetLangaugeProfiles request failed", "service", a.Type, "host", a.Host, "error", err)
+		return []LanguageProfile{}, err
+	}
+	return resp, nil
+}
+
+func (a *Arr) GetTags() ([]Tag, error) {
+	resp, err := get[[]Tag](a, "/tag", nil)
 	if err != nil {
-		slog.Error("GetLangaugeProfiles request failed", "service", a.Type, "error", err)
-		return []LanguageProfile{}, errors.New("request to service failed")
+		slog.Error("GetTags request failed", "service", a.Type, "error", err)
+		return []Tag{}, err
+	}
+	return resp, nil
+}
+
+func (a *Arr) CreateTag(label string) (Tag, error) {
+	resp, err := post[Tag](a, "/tag", map[string]interface{}{"label": label})
+	if err != nil {
+		slog.Error("CreateTag request failed", "service", a.Type, "error", err)
+		return Tag{}, err
 	}
 	return resp, nil
 }
 
-// TODO do title! and year?
 func (a *Arr) BuildAddShowBody(r SonarrRequest) map[string]interface{} {
+	if r.IsAnime {
+		if r.Anime.QualityProfile != 0 {
+			r.QualityProfile = r.Anime.QualityProfile
+		}
+		if r.Anime.LanguageProfile != 0 {
+			r.LanguageProfile = r.Anime.LanguageProfile
+		}
+		if r.Anime.RootFolder != "" {
+			r.RootFolder = r.Anime.RootFolder
+		}
+		if r.Anime.SeriesType != "" {
+			r.SeriesType = r.Anime.SeriesType
+		} else {
+			r.SeriesType = "anime"
+		}
+	}
+	addOptions := map[string]interface{}{
+		"ignoreEpisodesWithFiles":  true,
+		"searchForMissingEpisodes": r.AutomaticSearch,
+	}
+	if r.MonitorMode != "" {
+		addOptions["monitor"] = r.MonitorMode
+		r.Seasons = monitorSeasons(r.Seasons, r.MonitorMode)
+	}
+	if r.Tags == nil {
+		r.Tags = []int{}
+	}
 	req := map[string]interface{}{
 		"title":             r.Title,
 		"year":              r.Year,
@@ -111,125 +173,201 @@ func (a *Arr) BuildAddShowBody(r SonarrRequest) map[string]interface{} {
 		"tvdbId":            r.TVDBID,
 		"seriesType":        r.SeriesType,
 		"seasons":           r.Seasons,
-		"addOptions": map[string]interface{}{
-			"ignoreEpisodesWithFiles":  true,
-			"searchForMissingEpisodes": r.AutomaticSearch,
-		},
-		"rootFolderPath": r.RootFolder,
+		"tags":              r.Tags,
+		"addOptions":        addOptions,
+		"rootFolderPath":    r.RootFolder,
 	}
 	return req
 }
 
+// Set which seasons are monitored for a monitor mode.
+// Specials (season 0) are left alone, as are seasons for `future`
+// (sonarr only monitors the episodes that haven't aired).
+func monitorSeasons(seasons []SonarrSeasons, mode string) []SonarrSeasons {
+	first, latest := -1, -1
+	for _, s := range seasons {
+		if s.SeasonNumber == 0 {
+			continue
+		}
+		if first == -1 || s.SeasonNumber < first {
+			first = s.SeasonNumber
+		}
+		if s.SeasonNumber > latest {
+			latest = s.SeasonNumber
+		}
+	}
+	out := make([]SonarrSeasons, len(seasons))
+	for i, s := range seasons {
+		out[i] = s
+		if s.SeasonNumber == 0 {
+			continue
+		}
+		switch mode {
+		case "all":
+			out[i].Monitored = true
+		case "firstSeason":
+			out[i].Monitored = s.SeasonNumber == first
+		case "latestSeason":
+			out[i].Monitored = s.SeasonNumber == latest
+		}
+	}
+	return out
+}
+
 func (a *Arr) BuildAddMovieBody(r RadarrRequest) map[string]interface{} {
+	if r.Tags == nil {
+		r.Tags = []int{}
+	}
 	req := map[string]interface{}{
 		"title":            r.Title,
 		"year":             r.Year,
 		"qualityProfileId": r.QualityProfile,
 		"monitored":        true,
 		"tmdbId":           r.TMDBID,
+		"tags":             r.Tags,
 		"addOptions": map[string]interface{}{
 			"searchForMovie": r.AutomaticSearch,
 		},
 		"rootFolderPath": r.RootFolder,
 	}
+	if r.MinimumAvailability != "" {
+		req["minimumAvailability"] = r.MinimumAvailability
+	}
 	return req
 }
 
-func (a *Arr) AddContent(b map[string]interface{}) error {
-	ep := "series"
-	if a.Type == RADARR {
-		ep = "movie"
-	}
-	slog.Debug("AddContent", "type", ep, "body", b)
-	var resp interface{}
-	err := requestPost(*a.Host, "/"+ep, *a.Key, b, &resp)
+// Add content to the arr, returns the id of the new series/movie.
+func (a *Arr) AddContent(b map[string]interface{}) (int, error) {
+	slog.Debug("AddContent", "type", a.Type, "body", b)
+	resp, err := post[struct {
+		ID int `json:"id"`
+	}](a, a.contentEndpoint(), b)
 	if err != nil {
 		slog.Error("AddContent request failed", "service", a.Type, "error", err)
-		return errors.New("request to service failed")
+		return 0, err
 	}
-	return nil
+	return resp.ID, nil
 }
 
-func request(host string, ep string, p map[string]string, resp interface{}) error {
-	slog.Debug("tmdbAPIRequest", "endpoint", ep, "params", p)
-	base, err := url.Parse(host)
+// Remove a series/movie from the arr, optionally deleting its files too.
+func (a *Arr) DeleteContent(id int, deleteFiles bool) error {
+	err := del(a, a.contentEndpoint()+"/"+strconv.Itoa(id), map[string]string{"deleteFiles": strconv.FormatBool(deleteFiles)})
 	if err != nil {
-		return errors.New("failed to parse api uri")
+		slog.Error("DeleteContent request failed", "service", a.Type, "error", err)
+		return err
 	}
+	return nil
+}
 
-	// Path params
-	base.Path += "/api/v3" + ep
-
-	// Query params
-	params := url.Values{}
-	for k, v := range p {
-		params.Add(k, v)
+// Change if a series/movie is monitored.
+func (a *Arr) SetMonitored(id int, monitored bool) error {
+	body := map[string]interface{}{"monitored": monitored}
+	if a.Type == RADARR {
+		body["movieIds"] = []int{id}
+	} else {
+		body["seriesIds"] = []int{id}
 	}
-
-	// Add params to url
-	base.RawQuery = params.Encode()
-
-	// Run get request
-	res, err := http.Get(base.String())
+	_, err := put[any](a, a.contentEndpoint()+"/editor", body)
 	if err != nil {
+		slog.Error("SetMonitored request failed", "service", a.Type, "error", err)
 		return err
 	}
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		return err
+	return nil
+}
+
+// Endpoint of the arrs content (series for sonarr, movie for radarr).
+func (a *Arr) contentEndpoint() string {
+	if a.Type == RADARR {
+		return "/movie"
 	}
-	if res.StatusCode != 200 {
-		slog.Error("arr non 200 status code:", "status_code", res.StatusCode)
-		return errors.New(string(body))
+	return "/series"
+}
+
+// Get all items in the download queue.
+func (a *Arr) GetQueue() ([]QueueRecord, error) {
+	p := map[string]string{"pageSize": "1000"}
+	if a.Type == SONARR {
+		p["includeUnknownSeriesItems"] = "false"
+	} else {
+		p["includeUnknownMovieItems"] = "false"
 	}
-	// slog.Info("", "body", body)
-	err = json.Unmarshal([]byte(body), &resp)
+	resp, err := get[QueuePage](a, "/queue", p)
 	if err != nil {
-		return err
+		slog.Error("GetQueue request failed", "service", a.Type, "error", err)
+		return []QueueRecord{}, err
 	}
-	return nil
+	return resp.Records, nil
 }
 
-func requestPost(host string, ep string, key string, p map[string]interface{}, resp interface{}) error {
-	base, err := url.Parse(host)
+// Get history of a series/movie, newest first.
+func (a *Arr) GetHistory(id int) ([]HistoryRecord, error) {
+	ep := "/history/series"
+	p := map[string]string{"seriesId": strconv.Itoa(id)}
+	if a.Type == RADARR {
+		ep = "/history/movie"
+		p = map[string]string{"movieId": strconv.Itoa(id)}
+	}
+	resp, err := get[[]HistoryRecord](a, ep, p)
 	if err != nil {
-		return errors.New("failed to parse api uri")
+		slog.Error("GetHistory request failed", "service", a.Type, "error", err)
+		return []HistoryRecord{}, err
 	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].Date > resp[j].Date
+	})
+	return resp, nil
+}
 
-	// Path params
-	base.Path += "/api/v3" + ep
-
-	var res *http.Response
-
-	// Query params
-	params := url.Values{}
-	params.Add("apikey", key)
-
-	// Add params to url
-	base.RawQuery = params.Encode()
-
-	jsonp, err := json.Marshal(p)
+// Get a movie from radarr.
+// Returns ErrNotFound if the movie doesn't exist.
+func (a *Arr) GetMovie(id int) (Movie, error) {
+	resp, err := get[Movie](a, "/movie/"+strconv.Itoa(id), nil)
 	if err != nil {
-		return err
+		if !errors.Is(err, ErrNotFound) {
+			slog.Error("GetMovie request failed", "service", a.Type, "error", err)
+		}
+		return Movie{}, err
 	}
-	res, err = http.Post(base.String(), "application/json", bytes.NewBuffer(jsonp))
+	return resp, nil
+}
+
+// Get a series from sonarr.
+// Returns ErrNotFound if the series doesn't exist.
+func (a *Arr) GetSeries(id int) (Series, error) {
+	resp, err := get[Series](a, "/series/"+strconv.Itoa(id), nil)
 	if err != nil {
-		return err
+		if !errors.Is(err, ErrNotFound) {
+			slog.Error("GetSeries request failed", "service", a.Type, "error", err)
+		}
+		return Series{}, err
 	}
+	return resp, nil
+}
 
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
+// Find a movie in radarr by its tmdb id.
+// Returns ErrNotFound if the movie hasn't been added.
+func (a *Arr) LookupMovie(tmdbId int) (Movie, error) {
+	resp, err := get[[]Movie](a, "/movie", map[string]string{"tmdbId": strconv.Itoa(tmdbId)})
 	if err != nil {
-		return err
+		slog.Error("LookupMovie request failed", "service", a.Type, "error", err)
+		return Movie{}, err
 	}
-	if !(res.StatusCode >= 200 && res.StatusCode <= 299) {
-		slog.Error("arr non 2xx status code:", "status_code", res.StatusCode)
-		return errors.New(string(body))
+	if len(resp) == 0 {
+		return Movie{}, ErrNotFound
 	}
-	err = json.Unmarshal([]byte(body), &resp)
+	return resp[0], nil
+}
+
+// Find a series in sonarr by its tvdb id.
+// Returns ErrNotFound if the series hasn't been added.
+func (a *Arr) LookupSeries(tvdbId int) (Series, error) {
+	resp, err := get[[]Series](a, "/series", map[string]string{"tvdbId": strconv.Itoa(tvdbId)})
 	if err != nil {
-		return err
+		slog.Error("LookupSeries request failed", "service", a.Type, "error", err)
+		return Series{}, err
 	}
-	return nil
+	if len(resp) == 0 {
+		return Series{}, ErrNotFound
+	}
+	return resp[0], nil
 }
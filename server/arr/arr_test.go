@@ -0,0 +1,58 @@
+package arr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonitorSeasons(t *testing.T) {
+	// Specials, then seasons 1-3, all unmonitored.
+	seasons := []SonarrSeasons{{0, false}, {1, false}, {2, false}, {3, false}}
+	tests := []struct {
+		name    string
+		seasons []SonarrSeasons
+		mode    string
+		want    []SonarrSeasons
+	}{
+		{"all", seasons, "all", []SonarrSeasons{{0, false}, {1, true}, {2, true}, {3, true}}},
+		{"first season", seasons, "firstSeason", []SonarrSeasons{{0, false}, {1, true}, {2, false}, {3, false}}},
+		{"latest season", seasons, "latestSeason", []SonarrSeasons{{0, false}, {1, false}, {2, false}, {3, true}}},
+		{
+			"future leaves seasons alone",
+			[]SonarrSeasons{{0, true}, {1, true}, {2, false}},
+			"future",
+			[]SonarrSeasons{{0, true}, {1, true}, {2, false}},
+		},
+		{
+			"unknown mode leaves seasons alone",
+			[]SonarrSeasons{{1, true}, {2, false}},
+			"",
+			[]SonarrSeasons{{1, true}, {2, false}},
+		},
+		{
+			"specials are left monitored",
+			[]SonarrSeasons{{0, true}, {1, true}, {2, true}},
+			"latestSeason",
+			[]SonarrSeasons{{0, true}, {1, false}, {2, true}},
+		},
+		{
+			"out of order seasons",
+			[]SonarrSeasons{{3, false}, {1, false}, {2, false}},
+			"firstSeason",
+			[]SonarrSeasons{{3, false}, {1, true}, {2, false}},
+		},
+		{"only specials", []SonarrSeasons{{0, false}}, "firstSeason", []SonarrSeasons{{0, false}}},
+		{"no seasons", []SonarrSeasons{}, "all", []SonarrSeasons{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := monitorSeasons(tt.seasons, tt.mode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("monitorSeasons(%v, %q) = %v, want %v", tt.seasons, tt.mode, got, tt.want)
+			}
+		})
+	}
+	if seasons[1].Monitored {
+		t.Error("monitorSeasons changed the seasons passed to it")
+	}
+}
@@ -0,0 +1,88 @@
+// Requests to arr apis and the errors they return.
+
+package arr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sbondCo/Watcharr/apiclient"
+)
+
+type Options = apiclient.Options
+
+// Returned when an arr responds with a non 2xx status.
+type Error struct {
+	StatusCode int
+	// Message from the arr, if it sent one.
+	Message string
+	// Set when the arr rejected what we sent it (eg content already added).
+	Validation []ValidationFailure
+}
+
+type ValidationFailure struct {
+	PropertyName string `json:"propertyName"`
+	ErrorMessage string `json:"errorMessage"`
+	Severity     string `json:"severity"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Validation) > 0 {
+		msgs := make([]string, len(e.Validation))
+		for i, v := range e.Validation {
+			msgs[i] = v.ErrorMessage
+		}
+		return strings.Join(msgs, ", ")
+	}
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("arr responded with status %d", e.StatusCode)
+}
+
+// Lets `errors.Is(err, ErrNotFound)` match 404 responses.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Build an Error from a failed responses body. Arrs send validation
+// failures as an array, and most other errors as an object with a message.
+func parseError(statusCode int, body []byte) *Error {
+	e := &Error{StatusCode: statusCode}
+	var vf []ValidationFailure
+	if err := json.Unmarshal(body, &vf); err == nil && len(vf) > 0 && vf[0].ErrorMessage != "" {
+		e.Validation = vf
+		return e
+	}
+	var m struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &m); err == nil {
+		e.Message = m.Message
+	}
+	return e
+}
+
+func get[T any](a *Arr, ep string, query map[string]string) (T, error) {
+	var resp T
+	err := a.client.Do(http.MethodGet, ep, query, nil, &resp)
+	return resp, err
+}
+
+func post[T any](a *Arr, ep string, body interface{}) (T, error) {
+	var resp T
+	err := a.client.Do(http.MethodPost, ep, nil, body, &resp)
+	return resp, err
+}
+
+func put[T any](a *Arr, ep string, body interface{}) (T, error) {
+	var resp T
+	err := a.client.Do(http.MethodPut, ep, nil, body, &resp)
+	return resp, err
+}
+
+func del(a *Arr, ep string, query map[string]string) error {
+	return a.client.Do(http.MethodDelete, ep, query, nil, nil)
+}
@@ -0,0 +1,176 @@
+package arr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name           string
+		statusCode     int
+		body           string
+		wantMessage    string
+		wantValidation []ValidationFailure
+		wantString     string
+		wantNotFound   bool
+	}{
+		{
+			name:       "validation failures",
+			statusCode: 400,
+			body:       `[{"propertyName":"TvdbId","errorMessage":"This series has already been added","severity":"error"},{"propertyName":"Path","errorMessage":"Path is invalid"}]`,
+			wantValidation: []ValidationFailure{
+				{PropertyName: "TvdbId", ErrorMessage: "This series has already been added", Severity: "error"},
+				{PropertyName: "Path", ErrorMessage: "Path is invalid"},
+			},
+			wantString: "This series has already been added, Path is invalid",
+		},
+		{
+			name:        "message",
+			statusCode:  401,
+			body:        `{"message":"Unauthorized"}`,
+			wantMessage: "Unauthorized",
+			wantString:  "Unauthorized",
+		},
+		{
+			name:         "not found with message",
+			statusCode:   404,
+			body:         `{"message":"NotFound"}`,
+			wantMessage:  "NotFound",
+			wantString:   "NotFound",
+			wantNotFound: true,
+		},
+		{
+			name:         "not found without body",
+			statusCode:   404,
+			body:         ``,
+			wantString:   "arr responded with status 404",
+			wantNotFound: true,
+		},
+		{
+			name:       "html error page",
+			statusCode: 502,
+			body:       `<html><body>Bad Gateway</body></html>`,
+			wantString: "arr responded with status 502",
+		},
+		{
+			name:       "empty validation array",
+			statusCode: 400,
+			body:       `[]`,
+			wantString: "arr responded with status 400",
+		},
+		{
+			name:       "array without error messages",
+			statusCode: 400,
+			body:       `[{"propertyName":"Path"}]`,
+			wantString: "arr responded with status 400",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := parseError(tt.statusCode, []byte(tt.body))
+			if e.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", e.StatusCode, tt.statusCode)
+			}
+			if e.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", e.Message, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(e.Validation, tt.wantValidation) {
+				t.Errorf("Validation = %+v, want %+v", e.Validation, tt.wantValidation)
+			}
+			if e.Error() != tt.wantString {
+				t.Errorf("Error() = %q, want %q", e.Error(), tt.wantString)
+			}
+			if errors.Is(e, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("errors.Is(err, ErrNotFound) = %v, want %v", !tt.wantNotFound, tt.wantNotFound)
+			}
+		})
+	}
+}
+
+func TestPutAndDelete(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		query  string
+		body   map[string]interface{}
+	}
+	tests := []struct {
+		name string
+		arr  ArrType
+		call func(a *Arr) error
+		// Status the server responds with.
+		status  int
+		want    request
+		wantErr bool
+	}{
+		{
+			name: "delete series keeping files",
+			arr:  SONARR,
+			call: func(a *Arr) error { return a.DeleteContent(5, false) },
+			want: request{method: http.MethodDelete, path: "/api/v3/series/5", query: "deleteFiles=false"},
+		},
+		{
+			name: "delete movie with files",
+			arr:  RADARR,
+			call: func(a *Arr) error { return a.DeleteContent(7, true) },
+			want: request{method: http.MethodDelete, path: "/api/v3/movie/7", query: "deleteFiles=true"},
+		},
+		{
+			name: "unmonitor series",
+			arr:  SONARR,
+			call: func(a *Arr) error { return a.SetMonitored(5, false) },
+			want: request{method: http.MethodPut, path: "/api/v3/series/editor", body: map[string]interface{}{"monitored": false, "seriesIds": []interface{}{float64(5)}}},
+		},
+		{
+			name: "monitor movie",
+			arr:  RADARR,
+			call: func(a *Arr) error { return a.SetMonitored(7, true) },
+			want: request{method: http.MethodPut, path: "/api/v3/movie/editor", body: map[string]interface{}{"monitored": true, "movieIds": []interface{}{float64(7)}}},
+		},
+		{
+			name:    "delete missing content",
+			arr:     RADARR,
+			call:    func(a *Arr) error { return a.DeleteContent(8, false) },
+			status:  http.StatusNotFound,
+			want:    request{method: http.MethodDelete, path: "/api/v3/movie/8", query: "deleteFiles=false"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = request{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery}
+				if r.Header.Get("X-Api-Key") != "key" {
+					t.Errorf("X-Api-Key = %q, want %q", r.Header.Get("X-Api-Key"), "key")
+				}
+				if b, _ := io.ReadAll(r.Body); len(b) > 0 {
+					json.Unmarshal(b, &got.body)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Write([]byte("{}"))
+			}))
+			defer srv.Close()
+
+			err := tt.call(New(tt.arr, srv.URL, "key", Options{}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNotFound) {
+				t.Errorf("errors.Is(err, ErrNotFound) = false, want true")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("request = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
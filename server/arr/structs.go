@@ -43,3 +43,105 @@ type LanguageProfile struct {
 	} `json:"languages"`
 	ID int `json:"id"`
 }
+
+type Tag struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+type QueuePage struct {
+	Page         int           `json:"page"`
+	PageSize     int           `json:"pageSize"`
+	TotalRecords int           `json:"totalRecords"`
+	Records      []QueueRecord `json:"records"`
+}
+
+type QueueRecord struct {
+	ID int `json:"id"`
+	// Only one of these is set, depending on the arr.
+	MovieID  int `json:"movieId,omitempty"`
+	SeriesID int `json:"seriesId,omitempty"`
+	// Sonarr queues each episode separately.
+	EpisodeID             int     `json:"episodeId,omitempty"`
+	Title                 string  `json:"title"`
+	Size                  float64 `json:"size"`
+	Sizeleft              float64 `json:"sizeleft"`
+	Status                string  `json:"status"`
+	TrackedDownloadStatus string  `json:"trackedDownloadStatus"`
+	TrackedDownloadState  string  `json:"trackedDownloadState"`
+	ErrorMessage          string  `json:"errorMessage"`
+	StatusMessages        []struct {
+		Title    string   `json:"title"`
+		Messages []string `json:"messages"`
+	} `json:"statusMessages"`
+}
+
+type HistoryRecord struct {
+	ID        int    `json:"id"`
+	EventType string `json:"eventType"`
+	Date      string `json:"date"`
+	Data      struct {
+		Message string `json:"message"`
+	} `json:"data"`
+}
+
+type Movie struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	TmdbID    int    `json:"tmdbId"`
+	Monitored bool   `json:"monitored"`
+	HasFile   bool   `json:"hasFile"`
+}
+
+type Series struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	TvdbID     int    `json:"tvdbId"`
+	Monitored  bool   `json:"monitored"`
+	Statistics struct {
+		EpisodeFileCount  int     `json:"episodeFileCount"`
+		EpisodeCount      int     `json:"episodeCount"`
+		TotalEpisodeCount int     `json:"totalEpisodeCount"`
+		PercentOfEpisodes float64 `json:"percentOfEpisodes"`
+	} `json:"statistics"`
+}
+
+// Body of webhooks sent by sonarr/radarr (Settings > Connect > Webhook).
+// Only what we use is included.
+type WebhookPayload struct {
+	// Grab, Download, MovieDelete, MovieFileDelete, SeriesDelete,
+	// EpisodeFileDelete or Test (and others we don't handle).
+	EventType    string `json:"eventType"`
+	InstanceName string `json:"instanceName"`
+	// Radarr only.
+	Movie *WebhookMovie `json:"movie,omitempty"`
+	// Sonarr only.
+	Series   *WebhookSeries   `json:"series,omitempty"`
+	Episodes []WebhookEpisode `json:"episodes,omitempty"`
+	// Set on Download events when an existing file was replaced.
+	IsUpgrade bool `json:"isUpgrade"`
+	// Set on file delete events, eg `upgrade` or `manual`.
+	DeleteReason string `json:"deleteReason,omitempty"`
+}
+
+type WebhookMovie struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Year   int    `json:"year"`
+	TmdbID int    `json:"tmdbId"`
+}
+
+type WebhookSeries struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	TvdbID int    `json:"tvdbId"`
+	// Only sent by Sonarr v4.
+	TmdbID int `json:"tmdbId,omitempty"`
+}
+
+type WebhookEpisode struct {
+	ID            int    `json:"id"`
+	SeasonNumber  int    `json:"seasonNumber"`
+	EpisodeNumber int    `json:"episodeNumber"`
+	Title         string `json:"title"`
+}
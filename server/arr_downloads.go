@@ -0,0 +1,258 @@
+// Download tracking for content sent to sonarr/radarr.
+// Each added series/movie is polled until it has been imported,
+// so users can see when something they requested is ready.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+type ArrDownloadState string
+
+var (
+	// Waiting for a release to be found, or for the download to start.
+	ARR_DOWNLOAD_QUEUED      ArrDownloadState = "QUEUED"
+	ARR_DOWNLOAD_DOWNLOADING ArrDownloadState = "DOWNLOADING"
+	ARR_DOWNLOAD_IMPORTED    ArrDownloadState = "IMPORTED"
+	ARR_DOWNLOAD_FAILED      ArrDownloadState = "FAILED"
+)
+
+// How long we keep polling downloads that haven't been imported.
+const arrDownloadMaxAge = 30 * 24 * time.Hour
+
+// Failed downloads are only rechecked this often, they rarely recover
+// on their own (the arr would have to grab another release).
+const arrDownloadFailedPollInterval = time.Hour
+
+// Set while a poll is running, so a slow server can't make them pile up.
+var arrDownloadsPolling atomic.Bool
+
+type ArrDownload struct {
+	GormModel
+	// User that requested the content.
+	UserID uint `gorm:"index;not null" json:"-"`
+	// Set when added from an approved content request.
+	ContentRequestID *uint       `gorm:"index" json:"-"`
+	ArrType          arr.ArrType `gorm:"not null" json:"arrType"`
+	ServerName       string      `gorm:"not null" json:"serverName"`
+	// ID of the series/movie in the arr.
+	ArrID int              `gorm:"not null" json:"-"`
+	Title string           `json:"title"`
+	State ArrDownloadState `gorm:"index;not null" json:"state"`
+	// Percentage downloaded (or of episodes imported for series).
+	Progress float64 `json:"progress"`
+	// Why the download failed, if it has.
+	StatusMessage string `json:"statusMessage,omitempty"`
+}
+
+// Start tracking content that was just added to an arr.
+func trackArrDownload(db *gorm.DB, d ArrDownload) {
+	if d.ArrID == 0 {
+		slog.Warn("trackArrDownload: Arr returned no id for added content, can't track it", "server", d.ServerName, "title", d.Title)
+		return
+	}
+	d.State = ARR_DOWNLOAD_QUEUED
+	if res := db.Create(&d); res.Error != nil {
+		slog.Error("trackArrDownload: Failed to save download", "server", d.ServerName, "title", d.Title, "error", res.Error)
+	}
+}
+
+// Get downloads of content the user has requested.
+func getUserArrDownloads(db *gorm.DB, userId uint) ([]ArrDownload, error) {
+	downloads := []ArrDownload{}
+	if res := db.Where("user_id = ?", userId).Order("created_at DESC").Find(&downloads); res.Error != nil {
+		slog.Error("getUserArrDownloads: Failed to get downloads", "user_id", userId, "error", res.Error)
+		return []ArrDownload{}, errors.New("failed to get downloads")
+	}
+	return downloads, nil
+}
+
+// Get the arr client for a server in our config.
+func getArrClient(t arr.ArrType, serverName string) (*arr.Arr, error) {
+	if t == arr.SONARR {
+		s, err := getSonarr(serverName)
+		if err != nil {
+			return nil, err
+		}
+		return s.client(arr.SONARR), nil
+	}
+	s, err := getRadarr(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return s.client(arr.RADARR), nil
+}
+
+// Update the state of all downloads that haven't been imported yet.
+// Queues are fetched once per server.
+// Skipped if the last poll is still running.
+func pollArrDownloads(db *gorm.DB) {
+	if !arrDownloadsPolling.CompareAndSwap(false, true) {
+		slog.Debug("pollArrDownloads: Last poll still running, skipping")
+		return
+	}
+	defer arrDownloadsPolling.Store(false)
+	var downloads []ArrDownload
+	res := db.Where(
+		"state != ? AND created_at > ? AND (state != ? OR updated_at < ?)",
+		ARR_DOWNLOAD_IMPORTED, time.Now().Add(-arrDownloadMaxAge), ARR_DOWNLOAD_FAILED, time.Now().Add(-arrDownloadFailedPollInterval),
+	).Find(&downloads)
+	if res.Error != nil {
+		slog.Error("pollArrDownloads: Failed to get downloads", "error", res.Error)
+		return
+	}
+	if len(downloads) == 0 {
+		return
+	}
+	type server struct {
+		client *arr.Arr
+		queue  []arr.QueueRecord
+	}
+	servers := map[string]*server{}
+	for _, d := range downloads {
+		key := string(d.ArrType) + ":" + d.ServerName
+		s, ok := servers[key]
+		if !ok {
+			s = &server{}
+			servers[key] = s
+			client, err := getArrClient(d.ArrType, d.ServerName)
+			if err != nil {
+				slog.Warn("pollArrDownloads: Server no longer exists", "type", d.ArrType, "server", d.ServerName)
+				continue
+			}
+			queue, err := client.GetQueue()
+			if err != nil {
+				slog.Error("pollArrDownloads: Failed to get queue", "type", d.ArrType, "server", d.ServerName, "error", err)
+				continue
+			}
+			s.client = client
+			s.queue = queue
+		}
+		if s.client == nil {
+			continue
+		}
+		state, progress, msg := getArrDownloadState(s.client, s.queue, d)
+		if state == "" || (state == d.State && progress == d.Progress && msg == d.StatusMessage) {
+			if d.State == ARR_DOWNLOAD_FAILED {
+				// Wait before checking it again.
+				if res := db.Model(&ArrDownload{}).Where("id = ?", d.ID).Update("updated_at", time.Now()); res.Error != nil {
+					slog.Error("pollArrDownloads: Failed to update failed download", "id", d.ID, "error", res.Error)
+				}
+			}
+			continue
+		}
+		res := db.Model(&ArrDownload{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"state":          state,
+			"progress":       progress,
+			"status_message": msg,
+		})
+		if res.Error != nil {
+			slog.Error("pollArrDownloads: Failed to update download", "id", d.ID, "error", res.Error)
+			continue
+		}
+		if state != d.State {
+			slog.Info("pollArrDownloads: Download state changed", "id", d.ID, "title", d.Title, "from", d.State, "to", state)
+		}
+	}
+}
+
+// Work out a downloads current state from the servers queue, or from
+// the series/movie and its history if it isn't in the queue.
+// Returns an empty state if it couldn't be worked out right now.
+func getArrDownloadState(client *arr.Arr, queue []arr.QueueRecord, d ArrDownload) (ArrDownloadState, float64, string) {
+	var (
+		inQueue     bool
+		downloading bool
+		size        float64
+		sizeleft    float64
+		errs        []string
+	)
+	for _, q := range queue {
+		if (d.ArrType == arr.RADARR && q.MovieID != d.ArrID) || (d.ArrType == arr.SONARR && q.SeriesID != d.ArrID) {
+			continue
+		}
+		inQueue = true
+		size += q.Size
+		sizeleft += q.Sizeleft
+		status := strings.ToLower(q.Status)
+		if status == "downloading" {
+			downloading = true
+		}
+		if status == "failed" || strings.ToLower(q.TrackedDownloadStatus) == "error" {
+			if q.ErrorMessage != "" {
+				errs = append(errs, q.ErrorMessage)
+			} else {
+				for _, sm := range q.StatusMessages {
+					errs = append(errs, sm.Messages...)
+				}
+			}
+		}
+	}
+	if inQueue {
+		progress := 0.0
+		if size > 0 {
+			progress = (size - sizeleft) / size * 100
+		}
+		if len(errs) > 0 {
+			return ARR_DOWNLOAD_FAILED, progress, strings.Join(errs, ", ")
+		}
+		if downloading {
+			return ARR_DOWNLOAD_DOWNLOADING, progress, ""
+		}
+		return ARR_DOWNLOAD_QUEUED, progress, ""
+	}
+
+	// Not in queue, check if it has been imported.
+	progress := 0.0
+	if d.ArrType == arr.RADARR {
+		m, err := client.GetMovie(d.ArrID)
+		if err != nil {
+			if errors.Is(err, arr.ErrNotFound) {
+				return ARR_DOWNLOAD_FAILED, 0, "removed from " + d.ServerName
+			}
+			return "", 0, ""
+		}
+		if m.HasFile {
+			return ARR_DOWNLOAD_IMPORTED, 100, ""
+		}
+	} else {
+		s, err := client.GetSeries(d.ArrID)
+		if err != nil {
+			if errors.Is(err, arr.ErrNotFound) {
+				return ARR_DOWNLOAD_FAILED, 0, "removed from " + d.ServerName
+			}
+			return "", 0, ""
+		}
+		if arrSeriesImported(s) {
+			return ARR_DOWNLOAD_IMPORTED, 100, ""
+		}
+		progress = s.Statistics.PercentOfEpisodes
+	}
+
+	// Not imported, check if the last download failed.
+	history, err := client.GetHistory(d.ArrID)
+	if err != nil {
+		return "", 0, ""
+	}
+	if len(history) > 0 && history[0].EventType == "downloadFailed" {
+		msg := history[0].Data.Message
+		if msg == "" {
+			msg = "download failed"
+		}
+		return ARR_DOWNLOAD_FAILED, progress, msg
+	}
+	return ARR_DOWNLOAD_QUEUED, progress, ""
+}
+
+// If every monitored episode of a series has a file.
+func arrSeriesImported(s arr.Series) bool {
+	return s.Statistics.EpisodeCount > 0 && s.Statistics.EpisodeFileCount >= s.Statistics.EpisodeCount
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+func TestPollArrDownloadsBacksOffFailed(t *testing.T) {
+	// Radarr that has had every movie removed, recording which were asked for.
+	var (
+		mu     sync.Mutex
+		polled = map[string]bool{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/queue" {
+			w.Write([]byte(`{"records": []}`))
+			return
+		}
+		if id, ok := strings.CutPrefix(r.URL.Path, "/api/v3/movie/"); ok {
+			mu.Lock()
+			polled[id] = true
+			mu.Unlock()
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	old := Config.RADARR
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: "radarr", ArrConnection: ArrConnection{Host: srv.URL, Key: "key"}}}}
+	t.Cleanup(func() { Config.RADARR = old })
+
+	db := newTestDB(t, &ArrDownload{})
+	removed := "removed from radarr"
+	downloads := []struct {
+		d ArrDownload
+		// How long ago it was last updated.
+		updated    time.Duration
+		wantPolled bool
+		wantState  ArrDownloadState
+	}{
+		{ArrDownload{ArrID: 1, State: ARR_DOWNLOAD_FAILED, StatusMessage: removed}, 30 * time.Minute, false, ARR_DOWNLOAD_FAILED},
+		{ArrDownload{ArrID: 2, State: ARR_DOWNLOAD_FAILED, StatusMessage: removed}, 2 * time.Hour, true, ARR_DOWNLOAD_FAILED},
+		{ArrDownload{ArrID: 3, State: ARR_DOWNLOAD_QUEUED}, time.Minute, true, ARR_DOWNLOAD_FAILED},
+		{ArrDownload{ArrID: 4, State: ARR_DOWNLOAD_IMPORTED, Progress: 100}, time.Minute, false, ARR_DOWNLOAD_IMPORTED},
+	}
+	for i, v := range downloads {
+		d := v.d
+		d.UserID = 1
+		d.ArrType = arr.RADARR
+		d.ServerName = "radarr"
+		if err := db.Create(&d).Error; err != nil {
+			t.Fatal("failed to create download:", err)
+		}
+		if err := db.Model(&d).UpdateColumn("updated_at", time.Now().Add(-v.updated)).Error; err != nil {
+			t.Fatal("failed to set updated_at:", err)
+		}
+		downloads[i].d = d
+	}
+
+	pollArrDownloads(db)
+
+	for _, v := range downloads {
+		id := v.d.ArrID
+		if polled[strconv.Itoa(id)] != v.wantPolled {
+			t.Errorf("movie %d polled = %v, want %v", id, !v.wantPolled, v.wantPolled)
+		}
+		var got ArrDownload
+		if err := db.Take(&got, v.d.ID).Error; err != nil {
+			t.Fatal("failed to get download:", err)
+		}
+		if got.State != v.wantState {
+			t.Errorf("movie %d state = %s, want %s", id, got.State, v.wantState)
+		}
+		// Failed downloads that were checked wait another interval.
+		if v.wantPolled && v.wantState == ARR_DOWNLOAD_FAILED && time.Since(got.UpdatedAt) > time.Minute {
+			t.Errorf("movie %d updated_at = %v, want it bumped to now", id, got.UpdatedAt)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+func TestIsAnimeShow(t *testing.T) {
+	tests := []struct {
+		name string
+		// Show details as TMDB returns them (with keywords appended).
+		show string
+		want bool
+	}{
+		{
+			name: "anime keyword",
+			show: `{"keywords": {"results": [{"id": 210024, "name": "anime"}]}}`,
+			want: true,
+		},
+		{
+			name: "anime keyword without animation genre or japan",
+			show: `{"genres": [{"id": 18}], "origin_country": ["US"], "keywords": {"results": [{"id": 1}, {"id": 210024}]}}`,
+			want: true,
+		},
+		{
+			name: "animation from japan",
+			show: `{"genres": [{"id": 10759}, {"id": 16}], "origin_country": ["JP"]}`,
+			want: true,
+		},
+		{
+			name: "animation from japan and elsewhere",
+			show: `{"genres": [{"id": 16}], "origin_country": ["US", "JP"]}`,
+			want: true,
+		},
+		{
+			name: "animation not from japan",
+			show: `{"genres": [{"id": 16}], "origin_country": ["US"]}`,
+			want: false,
+		},
+		{
+			name: "from japan but not animation",
+			show: `{"genres": [{"id": 18}], "origin_country": ["JP"]}`,
+			want: false,
+		},
+		{
+			name: "other keywords",
+			show: `{"genres": [{"id": 35}], "origin_country": ["GB"], "keywords": {"results": [{"id": 9715}]}}`,
+			want: false,
+		},
+		{
+			name: "nothing to go on",
+			show: `{}`,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var show TMDBShowDetails
+			if err := json.Unmarshal([]byte(tt.show), &show); err != nil {
+				t.Fatal("failed to unmarshal show:", err)
+			}
+			if got := isAnimeShow(show); got != tt.want {
+				t.Errorf("isAnimeShow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrRequesterTagLabel(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "watcharr-alice"},
+		{"Alice", "watcharr-alice"},
+		{"user01", "watcharr-user01"},
+		{"john.doe", "watcharr-john-doe"},
+		{"first last", "watcharr-first-last"},
+		{"user_name", "watcharr-user-name"},
+		{"already-dashed", "watcharr-already-dashed"},
+		{"Zoë", "watcharr-zo-"},
+		{"名前", "watcharr---"},
+		{"", "watcharr-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			if got := arrRequesterTagLabel(tt.username); got != tt.want {
+				t.Errorf("arrRequesterTagLabel(%q) = %q, want %q", tt.username, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetArrRequesterTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		tags        []arr.Tag
+		wantId      int
+		wantCreated string
+	}{
+		{
+			name:     "existing tag is used",
+			username: "Alice",
+			tags:     []arr.Tag{{ID: 1, Label: "4k"}, {ID: 2, Label: "watcharr-alice"}},
+			wantId:   2,
+		},
+		{
+			name:        "missing tag is created",
+			username:    "Bob.Smith",
+			tags:        []arr.Tag{{ID: 1, Label: "watcharr-alice"}},
+			wantId:      10,
+			wantCreated: "watcharr-bob-smith",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/tag" {
+					http.NotFound(w, r)
+					return
+				}
+				if r.Method == http.MethodPost {
+					var tag arr.Tag
+					json.NewDecoder(r.Body).Decode(&tag)
+					created = tag.Label
+					json.NewEncoder(w).Encode(arr.Tag{ID: 10, Label: tag.Label})
+					return
+				}
+				json.NewEncoder(w).Encode(tt.tags)
+			}))
+			defer srv.Close()
+
+			id, err := getArrRequesterTag(arr.New(arr.SONARR, srv.URL, "key", arr.Options{}), tt.username)
+			if err != nil {
+				t.Fatal("getArrRequesterTag() error:", err)
+			}
+			if id != tt.wantId {
+				t.Errorf("getArrRequesterTag() = %d, want %d", id, tt.wantId)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created tag %q, want %q", created, tt.wantCreated)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Sonarr/Radarr webhook receiver.
+// Arrs can be setup to call us when content is grabbed, imported or deleted
+// (Settings > Connect > Webhook), which updates the state of tracked
+// downloads straight away instead of on the next poll, and lets us tell
+// users when content they requested or planned is available.
+//
+// Webhook urls are `/api/webhook/sonarr/{server name}` and
+// `/api/webhook/radarr/{server name}`, with ARR_WEBHOOK_SECRET
+// as the password (username can be anything).
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+func handleArrWebhook(db *gorm.DB, t arr.ArrType, serverName string, p arr.WebhookPayload) error {
+	client, err := getArrClient(t, serverName)
+	if err != nil {
+		return err
+	}
+	var (
+		arrId int
+		title string
+	)
+	if t == arr.RADARR && p.Movie != nil {
+		arrId = p.Movie.ID
+		title = p.Movie.Title
+	} else if t == arr.SONARR && p.Series != nil {
+		arrId = p.Series.ID
+		title = p.Series.Title
+	}
+	if p.EventType == "Test" {
+		slog.Info("handleArrWebhook: Received test webhook", "type", t, "server", serverName)
+		return nil
+	}
+	if arrId == 0 {
+		slog.Debug("handleArrWebhook: Webhook has no movie/series, ignoring", "type", t, "server", serverName, "event", p.EventType)
+		return nil
+	}
+	slog.Info("handleArrWebhook: Received webhook", "type", t, "server", serverName, "event", p.EventType, "title", title)
+
+	var (
+		update    = map[string]interface{}{}
+		available bool
+	)
+	switch p.EventType {
+	case "Grab":
+		update["state"] = ARR_DOWNLOAD_DOWNLOADING
+		update["status_message"] = ""
+	case "Download":
+		if p.IsUpgrade {
+			return nil
+		}
+		available = true
+		update["status_message"] = ""
+		if t == arr.RADARR {
+			update["state"] = ARR_DOWNLOAD_IMPORTED
+			update["progress"] = 100
+		} else {
+			// Only some episodes may have been imported, check the
+			// series to see if everything is here now.
+			s, err := client.GetSeries(arrId)
+			if err != nil {
+				slog.Error("handleArrWebhook: Failed to get series", "server", serverName, "arr_id", arrId, "error", err)
+				update["state"] = ARR_DOWNLOAD_DOWNLOADING
+			} else if arrSeriesImported(s) {
+				update["state"] = ARR_DOWNLOAD_IMPORTED
+				update["progress"] = 100
+			} else {
+				update["state"] = ARR_DOWNLOAD_DOWNLOADING
+				update["progress"] = s.Statistics.PercentOfEpisodes
+			}
+		}
+	case "MovieDelete", "SeriesDelete":
+		update["state"] = ARR_DOWNLOAD_FAILED
+		update["progress"] = 0
+		update["status_message"] = "removed from " + serverName
+	case "MovieFileDelete", "EpisodeFileDelete":
+		// Files are deleted when replaced by an upgrade, nothing changes for us.
+		if p.DeleteReason == "upgrade" {
+			return nil
+		}
+		update["state"] = ARR_DOWNLOAD_QUEUED
+		update["progress"] = 0
+	default:
+		slog.Debug("handleArrWebhook: Unhandled event type", "event", p.EventType)
+		return nil
+	}
+
+	res := db.Model(&ArrDownload{}).
+		Where("arr_type = ? AND server_name = ? AND arr_id = ?", t, serverName, arrId).
+		Updates(update)
+	if res.Error != nil {
+		slog.Error("handleArrWebhook: Failed to update downloads", "server", serverName, "arr_id", arrId, "error", res.Error)
+		return errors.New("failed to update downloads")
+	}
+	slog.Debug("handleArrWebhook: Updated downloads", "server", serverName, "arr_id", arrId, "count", res.RowsAffected)
+
+	if available {
+		content, err := getArrWebhookContent(db, t, p)
+		if err != nil {
+			// Content isn't in our db, so nobody has requested/planned it.
+			slog.Debug("handleArrWebhook: No content found for webhook", "title", title, "error", err)
+			return nil
+		}
+		queueContentAvailable(db, content, p.Episodes)
+	}
+	return nil
+}
+
+// Find the content the webhook is about in our db,
+// using the tmdb id from the arr (or tvdb id for older sonarr versions).
+func getArrWebhookContent(db *gorm.DB, t arr.ArrType, p arr.WebhookPayload) (Content, error) {
+	var (
+		contentType = MOVIE
+		tmdbId      int
+	)
+	if t == arr.RADARR {
+		tmdbId = p.Movie.TmdbID
+	} else {
+		contentType = SHOW
+		tmdbId = p.Series.TmdbID
+		if tmdbId == 0 && p.Series.TvdbID != 0 {
+			id, err := findShowByTvdbId(p.Series.TvdbID)
+			if err != nil {
+				return Content{}, err
+			}
+			tmdbId = id
+		}
+	}
+	if tmdbId == 0 {
+		return Content{}, errors.New("no tmdb id")
+	}
+	var content Content
+	if res := db.Where("type = ? AND tmdb_id = ?", contentType, tmdbId).Take(&content); res.Error != nil {
+		return Content{}, res.Error
+	}
+	return content, nil
+}
+
+// Sonarr sends a webhook for every imported episode, so users are only
+// notified once no more of a shows episodes have been imported for this long.
+const contentAvailableNotifyDelay = 2 * time.Minute
+
+type pendingContentAvailable struct {
+	content  Content
+	episodes []arr.WebhookEpisode
+	timer    *time.Timer
+}
+
+var (
+	pendingContentAvailables      = make(map[int]*pendingContentAvailable)
+	pendingContentAvailablesMutex sync.Mutex
+)
+
+// Data of CONTENT_AVAILABLE activities.
+type ContentAvailableActivityData struct {
+	Episodes []ContentAvailableEpisode `json:"episodes,omitempty"`
+}
+
+type ContentAvailableEpisode struct {
+	SeasonNumber  int `json:"seasonNumber"`
+	EpisodeNumber int `json:"episodeNumber"`
+}
+
+// Notify users that content is available after `contentAvailableNotifyDelay`,
+// batching up any more episodes imported before then.
+func queueContentAvailable(db *gorm.DB, content Content, episodes []arr.WebhookEpisode) {
+	pendingContentAvailablesMutex.Lock()
+	defer pendingContentAvailablesMutex.Unlock()
+	if n, ok := pendingContentAvailables[content.ID]; ok {
+		n.episodes = append(n.episodes, episodes...)
+		n.timer.Reset(contentAvailableNotifyDelay)
+		return
+	}
+	n := &pendingContentAvailable{content: content, episodes: episodes}
+	pendingContentAvailables[content.ID] = n
+	n.timer = time.AfterFunc(contentAvailableNotifyDelay, func() {
+		pendingContentAvailablesMutex.Lock()
+		// Reset can run us again after we have already notified.
+		if pendingContentAvailables[content.ID] != n {
+			pendingContentAvailablesMutex.Unlock()
+			return
+		}
+		delete(pendingContentAvailables, content.ID)
+		pendingContentAvailablesMutex.Unlock()
+		notifyContentAvailable(db, n.content, n.episodes)
+	})
+}
+
+// Tell users that requested or planned content that it is now available.
+// Users with it on their list get an activity, and everyone is emailed
+// if smtp is configured.
+func notifyContentAvailable(db *gorm.DB, content Content, episodes []arr.WebhookEpisode) {
+	addContentAvailableActivities(db, content, episodes)
+	if !Config.SMTP.IsConfigured() {
+		return
+	}
+	var users []User
+	res := db.Select("id", "username", "email").
+		Where("email != ''").
+		Where(
+			db.Where("id IN (?)", db.Model(&ContentRequest{}).Select("user_id").Where("content_id = ? AND status != ?", content.ID, CONTENT_REQUEST_DENIED)).
+				Or("id IN (?)", db.Model(&Watched{}).Select("user_id").Where("content_id = ? AND status = ?", content.ID, PLANNED)),
+		).
+		Find(&users)
+	if res.Error != nil {
+		slog.Error("notifyContentAvailable: Failed to get users to notify", "content_id", content.ID, "error", res.Error)
+		return
+	}
+	what := content.Title + " is"
+	if len(episodes) == 1 {
+		what = fmt.Sprintf("S%02dE%02d of %s is", episodes[0].SeasonNumber, episodes[0].EpisodeNumber, content.Title)
+	} else if len(episodes) > 1 {
+		what = fmt.Sprintf("%d new episodes of %s are", len(episodes), content.Title)
+	}
+	for _, u := range users {
+		body := "Hi " + u.Username + ",\n\n" + what + " now available."
+		if err := sendEmail(u.Email, content.Title+" is available", body); err != nil {
+			slog.Error("notifyContentAvailable: Failed to email user", "user_id", u.ID, "error", err)
+		}
+	}
+	slog.Info("notifyContentAvailable: Notified users", "content_id", content.ID, "count", len(users))
+}
+
+// Add a CONTENT_AVAILABLE activity to the watched entry of users that
+// requested or planned the content.
+func addContentAvailableActivities(db *gorm.DB, content Content, episodes []arr.WebhookEpisode) {
+	var watched []Watched
+	res := db.Select("id", "user_id").
+		Where("content_id = ?", content.ID).
+		Where(
+			db.Where("status = ?", PLANNED).
+				Or("user_id IN (?)", db.Model(&ContentRequest{}).Select("user_id").Where("content_id = ? AND status != ?", content.ID, CONTENT_REQUEST_DENIED)),
+		).
+		Find(&watched)
+	if res.Error != nil {
+		slog.Error("addContentAvailableActivities: Failed to get watched entries", "content_id", content.ID, "error", res.Error)
+		return
+	}
+	data := ContentAvailableActivityData{}
+	for _, e := range episodes {
+		data.Episodes = append(data.Episodes, ContentAvailableEpisode{SeasonNumber: e.SeasonNumber, EpisodeNumber: e.EpisodeNumber})
+	}
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("addContentAvailableActivities: Failed to marshal activity data", "error", err)
+		return
+	}
+	for _, w := range watched {
+		addActivity(db, w.UserID, ActivityAddRequest{WatchedID: w.ID, Type: CONTENT_AVAILABLE, Data: string(dataJson)})
+	}
+}
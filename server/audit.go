@@ -0,0 +1,284 @@
+// Audit log of admin actions and security events.
+// Entries are append-only, they can't be edited or removed through Watcharr.
+// Only login events are removed, once they are older than `auditLoginRetention`.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditAction string
+
+var (
+	AUDIT_CONFIG_UPDATE             AuditAction = "CONFIG_UPDATE"
+	AUDIT_CONFIG_PLEX_HOST_UPDATE   AuditAction = "CONFIG_PLEX_HOST_UPDATE"
+	AUDIT_CONFIG_SMTP_UPDATE        AuditAction = "CONFIG_SMTP_UPDATE"
+	AUDIT_CONFIG_SEERR_UPDATE       AuditAction = "CONFIG_SEERR_UPDATE"
+	AUDIT_CONFIG_METADATA_UPDATE    AuditAction = "CONFIG_METADATA_UPDATE"
+	AUDIT_CONFIG_TWITCH_UPDATE      AuditAction = "CONFIG_TWITCH_UPDATE"
+	AUDIT_JWT_ROTATE                AuditAction = "JWT_ROTATE"
+	AUDIT_TMDB_CACHE_PURGE          AuditAction = "TMDB_CACHE_PURGE"
+	AUDIT_SONARR_ADD                AuditAction = "SONARR_ADD"
+	AUDIT_SONARR_EDIT               AuditAction = "SONARR_EDIT"
+	AUDIT_SONARR_RM                 AuditAction = "SONARR_RM"
+	AUDIT_RADARR_ADD                AuditAction = "RADARR_ADD"
+	AUDIT_RADARR_EDIT               AuditAction = "RADARR_EDIT"
+	AUDIT_RADARR_RM                 AuditAction = "RADARR_RM"
+	AUDIT_ADMIN_TOKEN_USE           AuditAction = "ADMIN_TOKEN_USE"
+	AUDIT_USER_PERMISSIONS_UPDATE   AuditAction = "USER_PERMISSIONS_UPDATE"
+	AUDIT_USER_DISABLE              AuditAction = "USER_DISABLE"
+	AUDIT_USER_ENABLE               AuditAction = "USER_ENABLE"
+	AUDIT_USER_DELETE               AuditAction = "USER_DELETE"
+	AUDIT_USER_MERGE                AuditAction = "USER_MERGE"
+	AUDIT_USER_FORCE_PASSWORD_RESET AuditAction = "USER_FORCE_PASSWORD_RESET"
+	AUDIT_USER_PASSWORD_RESET_LINK  AuditAction = "USER_PASSWORD_RESET_LINK"
+	AUDIT_USER_SEERR_USER_UPDATE    AuditAction = "USER_SEERR_USER_UPDATE"
+	AUDIT_INVITE_CREATE             AuditAction = "INVITE_CREATE"
+	AUDIT_INVITE_DELETE             AuditAction = "INVITE_DELETE"
+	AUDIT_LOGIN_FAILED              AuditAction = "LOGIN_FAILED"
+	AUDIT_LOGIN_LOCKED              AuditAction = "LOGIN_LOCKED"
+	AUDIT_LOGIN_LOCKOUT_CLEAR       AuditAction = "LOGIN_LOCKOUT_CLEAR"
+	AUDIT_CONTENT_REQUEST_APPROVE   AuditAction = "CONTENT_REQUEST_APPROVE"
+	AUDIT_CONTENT_REQUEST_DENY      AuditAction = "CONTENT_REQUEST_DENY"
+)
+
+// How long failed login and lockout entries are kept.
+// Admin actions are kept forever.
+const auditLoginRetention = 90 * 24 * time.Hour
+
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	// User that performed the action, nil if unauthenticated (eg failed logins).
+	ActorID *uint `json:"actorId,omitempty"`
+	// Username of the actor at the time, kept incase they are deleted later.
+	ActorUsername string      `json:"actorUsername,omitempty"`
+	Action        AuditAction `gorm:"index;not null" json:"action"`
+	// What the action was performed on (eg a user id or server name).
+	Target string `json:"target,omitempty"`
+	// JSON object of changed fields to their before and after values.
+	// Secrets are redacted.
+	Changes AuditChanges `json:"changes,omitempty"`
+	IP      string       `json:"ip,omitempty"`
+}
+
+// Stored as a json string, returned as a json object.
+type AuditChanges string
+
+func (a AuditChanges) MarshalJSON() ([]byte, error) {
+	if a == "" {
+		return []byte("null"), nil
+	}
+	return []byte(a), nil
+}
+
+// A changed field in an audit log entry.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+type AuditLogPage struct {
+	Entries []AuditLog `json:"entries"`
+	Total   int64      `json:"total"`
+	Page    int        `json:"page"`
+	Limit   int        `json:"limit"`
+}
+
+// Keep audit logs append-only.
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("audit logs can't be modified")
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("audit logs can't be removed")
+}
+
+const auditRedacted = "[redacted]"
+
+// Endings of field names that hold secrets we shouldn't store
+// (eg TMDB_KEY, clientSecret, JWT_RETIRED_SECRETS, tvdbPin).
+var auditSecretFieldSuffixes = []string{"key", "secret", "secrets", "password", "token", "auth", "pin"}
+
+func isAuditSecretField(name string) bool {
+	n := strings.ToLower(name)
+	for _, s := range auditSecretFieldSuffixes {
+		if strings.HasSuffix(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot a value as it is right now, for diffing later.
+// Values are marshalled so later changes to v don't affect the snapshot.
+func auditSnapshot(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("auditSnapshot: Failed to marshal value", "error", err)
+		return nil
+	}
+	var s any
+	if err := json.Unmarshal(b, &s); err != nil {
+		slog.Error("auditSnapshot: Failed to unmarshal value", "error", err)
+		return nil
+	}
+	return s
+}
+
+// Diff two snapshots, adding changed fields to `changes` by their path.
+func auditDiff(path string, before any, after any, secret bool, changes map[string]AuditChange) {
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+	if bok && aok {
+		keys := map[string]bool{}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range keys {
+			auditDiff(auditPath(path, k), bm[k], am[k], secret || isAuditSecretField(k), changes)
+		}
+		return
+	}
+	bs, bok := before.([]any)
+	as, aok := after.([]any)
+	if bok && aok {
+		for i := 0; i < max(len(bs), len(as)); i++ {
+			var b, a any
+			if i < len(bs) {
+				b = bs[i]
+			}
+			if i < len(as) {
+				a = as[i]
+			}
+			auditDiff(auditPath(path, strconv.Itoa(i)), b, a, secret, changes)
+		}
+		return
+	}
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	if path == "" {
+		path = "value"
+	}
+	changes[path] = AuditChange{Before: auditRedact(before, secret), After: auditRedact(after, secret)}
+}
+
+func auditPath(path string, k string) string {
+	if path == "" {
+		return k
+	}
+	return path + "." + k
+}
+
+// Redact secrets from a snapshot value.
+func auditRedact(v any, secret bool) any {
+	if v == nil {
+		return nil
+	}
+	if secret {
+		return auditRedacted
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		r := map[string]any{}
+		for k, mv := range t {
+			r[k] = auditRedact(mv, isAuditSecretField(k))
+		}
+		return r
+	case []any:
+		r := []any{}
+		for _, sv := range t {
+			r = append(r, auditRedact(sv, false))
+		}
+		return r
+	}
+	return v
+}
+
+// Add an entry to the audit log.
+// `before` and `after` should be from `auditSnapshot` (or nil), only
+// their differences are stored. `c` is used to get the actor and ip,
+// and can be nil if there is no request.
+func addAuditLog(db *gorm.DB, c *gin.Context, action AuditAction, target string, before any, after any) {
+	entry := AuditLog{Action: action, Target: target}
+	if c != nil {
+		if userId := c.GetUint("userId"); userId != 0 {
+			entry.ActorID = &userId
+			entry.ActorUsername = c.GetString("username")
+		}
+		entry.IP = c.ClientIP()
+	}
+	if before != nil || after != nil {
+		changes := map[string]AuditChange{}
+		auditDiff("", before, after, false, changes)
+		if len(changes) > 0 {
+			b, err := json.Marshal(changes)
+			if err != nil {
+				slog.Error("addAuditLog: Failed to marshal changes", "action", action, "error", err)
+			} else {
+				entry.Changes = AuditChanges(b)
+			}
+		}
+	}
+	if res := db.Create(&entry); res.Error != nil {
+		slog.Error("addAuditLog: Failed to add audit log entry", "action", action, "target", target, "error", res.Error)
+		return
+	}
+	slog.Debug("addAuditLog: Audit log entry added", "action", action, "target", target)
+}
+
+// Get a page of audit log entries, newest first.
+// Optionally filtered by action.
+func getAuditLogs(db *gorm.DB, page int, limit int, action string) (AuditLogPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	q := db.Model(&AuditLog{})
+	if action != "" {
+		q = q.Where("action = ?", action)
+	}
+	resp := AuditLogPage{Entries: []AuditLog{}, Page: page, Limit: limit}
+	if res := q.Session(&gorm.Session{}).Count(&resp.Total); res.Error != nil {
+		slog.Error("getAuditLogs: Failed to count entries", "error", res.Error)
+		return AuditLogPage{}, errors.New("failed to get audit log")
+	}
+	res := q.Session(&gorm.Session{}).Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&resp.Entries)
+	if res.Error != nil {
+		slog.Error("getAuditLogs: Failed to get entries", "error", res.Error)
+		return AuditLogPage{}, errors.New("failed to get audit log")
+	}
+	return resp, nil
+}
+
+// Remove login events older than `auditLoginRetention`.
+// Raw query since our `BeforeDelete` hook blocks removing entries.
+func cleanupAuditLogs(db *gorm.DB) {
+	res := db.Exec(
+		"DELETE FROM audit_logs WHERE action IN (?, ?) AND created_at < ?",
+		AUDIT_LOGIN_FAILED, AUDIT_LOGIN_LOCKED, time.Now().Add(-auditLoginRetention),
+	)
+	if res.Error != nil {
+		slog.Error("cleanupAuditLogs: Failed to remove old login entries", "error", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		slog.Info("cleanupAuditLogs: Removed old login entries", "amount", res.RowsAffected)
+	}
+}
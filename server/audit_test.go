@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbondCo/Watcharr/game"
+	"gorm.io/gorm"
+)
+
+// Config with every credential set to `prefix` + its name.
+func auditTestConfig(prefix string) ServerConfig {
+	cred := func(name string) string { return prefix + name }
+	clientSecret := cred("twitch-client-secret")
+	return ServerConfig{
+		JWT_SECRET:          cred("jwt-secret"),
+		JWT_SECRET_ID:       "kid",
+		JWT_RETIRED_SECRETS: []RetiredJWTSecret{{ID: "retired-kid", Secret: cred("retired-jwt-secret"), ExpiresAt: time.Unix(0, 0)}},
+		TMDB_KEY:            cred("tmdb-key"),
+		ARR_WEBHOOK_SECRET:  cred("webhook-secret"),
+		SMTP:                SMTPSettings{Host: "smtp", Port: 25, Username: "watcharr", Password: cred("smtp-password")},
+		SONARR:              []SonarrSettings{{ArrSettings: ArrSettings{Name: "sonarr", ArrConnection: ArrConnection{Host: "sonarr", Key: cred("sonarr-key")}}}},
+		RADARR:              []RadarrSettings{{ArrSettings: ArrSettings{Name: "radarr", ArrConnection: ArrConnection{Host: "radarr", Key: cred("radarr-key")}}}},
+		TWITCH:              game.IGDB{ClientSecret: &clientSecret, AccessToken: cred("twitch-access-token")},
+		SEERR:               SeerrSettings{Host: prefix + "seerr", Key: cred("seerr-key")},
+		METADATA:            MetadataSettings{Providers: []string{"tvdb"}, TvdbKey: cred("tvdb-key"), TvdbPin: cred("tvdb-pin"), OmdbKey: cred("omdb-key")},
+	}
+}
+
+func TestAuditConfigChangesAreRedacted(t *testing.T) {
+	db := newTestDB(t, &AuditLog{})
+	addAuditLog(db, nil, AUDIT_CONFIG_UPDATE, "", auditSnapshot(auditTestConfig("old-")), auditSnapshot(auditTestConfig("new-")))
+	var entry AuditLog
+	if err := db.Take(&entry).Error; err != nil {
+		t.Fatal("failed to get audit log entry:", err)
+	}
+	var changes map[string]AuditChange
+	if err := json.Unmarshal([]byte(entry.Changes), &changes); err != nil {
+		t.Fatal("failed to unmarshal changes:", err)
+	}
+
+	tests := []struct {
+		path       string
+		wantBefore any
+		wantAfter  any
+	}{
+		{"JWT_SECRET", auditRedacted, auditRedacted},
+		{"JWT_RETIRED_SECRETS.0.Secret", auditRedacted, auditRedacted},
+		{"TMDB_KEY", auditRedacted, auditRedacted},
+		{"ARR_WEBHOOK_SECRET", auditRedacted, auditRedacted},
+		{"SMTP.password", auditRedacted, auditRedacted},
+		{"SONARR.0.key", auditRedacted, auditRedacted},
+		{"RADARR.0.key", auditRedacted, auditRedacted},
+		{"TWITCH.clientSecret", auditRedacted, auditRedacted},
+		{"TWITCH.accessToken", auditRedacted, auditRedacted},
+		{"SEERR.key", auditRedacted, auditRedacted},
+		{"METADATA.tvdbKey", auditRedacted, auditRedacted},
+		{"METADATA.tvdbPin", auditRedacted, auditRedacted},
+		{"METADATA.omdbKey", auditRedacted, auditRedacted},
+		// Everything else is kept.
+		{"SEERR.host", "old-seerr", "new-seerr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			c, ok := changes[tt.path]
+			if !ok {
+				t.Fatalf("no change recorded for %s", tt.path)
+			}
+			if c.Before != tt.wantBefore || c.After != tt.wantAfter {
+				t.Errorf("change = %+v, want before %v after %v", c, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+	// Catch any credential field the table above doesn't know of.
+	for path, c := range changes {
+		if path == "SEERR.host" {
+			continue
+		}
+		for _, v := range []any{c.Before, c.After} {
+			if s, ok := v.(string); ok && (strings.HasPrefix(s, "old-") || strings.HasPrefix(s, "new-")) {
+				t.Errorf("%s stored a credential: %q", path, s)
+			}
+		}
+	}
+}
+
+// All strings in a snapshot value.
+func auditStrings(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case map[string]any:
+		r := []string{}
+		for _, mv := range t {
+			r = append(r, auditStrings(mv)...)
+		}
+		return r
+	case []any:
+		r := []string{}
+		for _, sv := range t {
+			r = append(r, auditStrings(sv)...)
+		}
+		return r
+	}
+	return []string{}
+}
+
+// Whole structs that are added are redacted by their field names.
+func TestAuditAddedConfigIsRedacted(t *testing.T) {
+	db := newTestDB(t, &AuditLog{})
+	addAuditLog(db, nil, AUDIT_CONFIG_UPDATE, "", auditSnapshot(ServerConfig{}), auditSnapshot(auditTestConfig("new-")))
+	var entry AuditLog
+	if err := db.Take(&entry).Error; err != nil {
+		t.Fatal("failed to get audit log entry:", err)
+	}
+	var changes map[string]AuditChange
+	if err := json.Unmarshal([]byte(entry.Changes), &changes); err != nil {
+		t.Fatal("failed to unmarshal changes:", err)
+	}
+	if len(changes) == 0 {
+		t.Fatal("no changes recorded")
+	}
+	for path, c := range changes {
+		for _, s := range auditStrings(c.After) {
+			if strings.HasPrefix(s, "new-") && s != "new-seerr" {
+				t.Errorf("%s stored a credential: %q", path, s)
+			}
+		}
+	}
+	if changes["SEERR.host"].After != "new-seerr" {
+		t.Errorf("SEERR.host = %v, want %q", changes["SEERR.host"].After, "new-seerr")
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB, entry *AuditLog) error
+	}{
+		{"save", func(db *gorm.DB, entry *AuditLog) error {
+			entry.Target = "changed"
+			return db.Save(entry).Error
+		}},
+		{"update column", func(db *gorm.DB, entry *AuditLog) error {
+			return db.Model(entry).Update("target", "changed").Error
+		}},
+		{"batch update", func(db *gorm.DB, entry *AuditLog) error {
+			return db.Model(&AuditLog{}).Where("id = ?", entry.ID).Updates(map[string]any{"target": "changed"}).Error
+		}},
+		{"delete", func(db *gorm.DB, entry *AuditLog) error {
+			return db.Delete(entry).Error
+		}},
+		{"batch delete", func(db *gorm.DB, entry *AuditLog) error {
+			return db.Where("id = ?", entry.ID).Delete(&AuditLog{}).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &AuditLog{})
+			addAuditLog(db, nil, AUDIT_USER_DISABLE, "1", nil, nil)
+			var entry AuditLog
+			if err := db.Take(&entry).Error; err != nil {
+				t.Fatal("failed to get audit log entry:", err)
+			}
+			if err := tt.run(db, &entry); err == nil {
+				t.Error("audit log entry was modified without an error")
+			}
+			var got AuditLog
+			if err := db.Take(&got, entry.ID).Error; err != nil {
+				t.Fatal("audit log entry is gone:", err)
+			}
+			if got.Target != "1" {
+				t.Errorf("target = %q, want %q", got.Target, "1")
+			}
+		})
+	}
+}
@@ -1,19 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"log/slog"
-	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -27,9 +21,10 @@ import (
 type UserType uint8
 
 var (
-	// Assume watcharr user if none of these...
+	WATCHARR_USER UserType = 0
 	JELLYFIN_USER UserType = 1
 	PLEX_USER     UserType = 2
+	EMBY_USER     UserType = 3
 )
 
 // User Perms
@@ -51,15 +46,23 @@ type User struct {
 	AvatarID uint   `json:"-"`
 	Avatar   Image  `json:"avatar"`
 	Bio      string `json:"bio"`
+	// Optional, used to send the user password reset links.
+	Email string `json:"-"`
 	// The type of user/which auth service they originate from.
 	// Empty if from Watcharr, or the name of the service (eg. jellyfin)
-	Type UserType `gorm:"uniqueIndex:usr_name_to_type;not null;default:0" json:"type"`
-	// ID of user from the third party service, this will be used purely for lookup of user at signin.
-	ThirdPartyID string `json:"-"`
-	// Auth token from third party (jellyfin)
-	ThirdPartyAuth string `json:"-"`
-	Watched        []Watched
-	Permissions    int `gorm:"default:1" json:"-"`
+	// Logins are looked up through the users identities (see `UserIdentity`).
+	Type        UserType `gorm:"uniqueIndex:usr_name_to_type;not null;default:0" json:"type"`
+	Watched     []Watched
+	Permissions int `gorm:"default:1" json:"-"`
+	// If an admin has disabled this account. Disabled users can't login.
+	Disabled bool `gorm:"default:false" json:"-"`
+	// If the user must change their password after logging in (set by admins).
+	PasswordResetRequired bool `gorm:"default:false" json:"-"`
+	// Tokens issued before this are rejected (see `revokeUserSessions`).
+	SessionsRevokedAt *time.Time `json:"-"`
+	// Overseerr/Jellyseerr user to make requests as (set by admins).
+	// 0 to match them by their linked jellyfin/plex/emby identity.
+	SeerrUserID int `gorm:"default:0" json:"-"`
 	// All user settings cols, in another struct for reusability
 	UserSettings
 }
@@ -86,6 +89,13 @@ type UserSettings struct {
 	// even if the watched item state has since been changed.
 	// Also if user wants to show in watched stats.
 	IncludePreviouslyWatched *bool `gorm:"default:false" json:"includePreviouslyWatched"`
+	// If content added to the users planned list should automatically
+	// be requested (or sent to sonarr/radarr for admins).
+	AutoRequestPlanned *bool `gorm:"default:false" json:"autoRequestPlanned"`
+	// Language to show metadata in (eg `en-US`), empty for the servers default.
+	Language *string `json:"language"`
+	// Country to show watch providers for (eg `US`), empty for the servers default.
+	Country *string `json:"country"`
 }
 
 // We use a separate struct for registration to avoid confusion
@@ -94,6 +104,8 @@ type UserSettings struct {
 type UserRegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// Optional invite code, allows registering even when signup is disabled.
+	InviteCode string `json:"inviteCode"`
 }
 
 type UseAdminTokenRequest struct {
@@ -115,6 +127,8 @@ type JellyfinAuthResponse struct {
 
 type AuthResponse struct {
 	Token string `json:"token"`
+	// If the user must change their password before continuing.
+	PasswordResetRequired bool `json:"passwordResetRequired,omitempty"`
 }
 
 type AvailableAuthProvidersResponse struct {
@@ -166,9 +180,7 @@ func AuthRequired(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		// Parse token
-		token, err := jwt.ParseWithClaims(atoken, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		token, err := parseAuthToken(atoken)
 		if err != nil {
 			slog.Error("AuthRequired failed to parse token", "error", err)
 			c.AbortWithStatus(401)
@@ -185,6 +197,11 @@ func AuthRequired(db *gorm.DB) gin.HandlerFunc {
 				c.AbortWithStatus(401)
 				return
 			}
+			if isSessionRevoked(claims.UserID, claims.IssuedAt.Time) {
+				slog.Info("AuthRequired: Token was issued before the users sessions were revoked.. returning 401", "user_id", claims.UserID, "token_issued_at", claims.IssuedAt)
+				c.AbortWithStatus(401)
+				return
+			}
 			slog.Debug("Token is valid", "claims", claims)
 			c.Set("userId", claims.UserID)
 			c.Set("userType", claims.Type)
@@ -198,12 +215,27 @@ func AuthRequired(db *gorm.DB) gin.HandlerFunc {
 					c.AbortWithStatus(401)
 					return
 				}
-				slog.Debug("AuthRequired: fetched extra user info. Setting vars.", "userThirdPartyId", dbUser.ThirdPartyID, "userThirdPartyAuth", "lol this is censored dude")
-				c.Set("userThirdPartyId", dbUser.ThirdPartyID)
-				c.Set("userThirdPartyAuth", dbUser.ThirdPartyAuth)
+				if dbUser.Disabled {
+					slog.Info("AuthRequired: User is disabled.. returning 401", "user_id", dbUser.ID)
+					c.AbortWithStatus(401)
+					return
+				}
+				if dbUser.SessionsRevokedAt != nil && isRevokedAt(claims.IssuedAt.Time, *dbUser.SessionsRevokedAt) {
+					slog.Info("AuthRequired: Token was issued before the users sessions were revoked.. returning 401", "user_id", claims.UserID, "token_issued_at", claims.IssuedAt)
+					c.AbortWithStatus(401)
+					return
+				}
+				slog.Debug("AuthRequired: fetched extra user info. Setting vars.")
 				c.Set("username", dbUser.Username)
 				c.Set("userPermissions", dbUser.Permissions)
 			}
+			// Users an admin has forced to reset their password can
+			// do nothing else until they have changed it.
+			if isPasswordResetRequired(claims.UserID) && !strings.HasSuffix(c.FullPath(), "/auth/change_password") {
+				slog.Info("AuthRequired: User must change their password.. returning 403", "user_id", claims.UserID)
+				c.AbortWithStatusJSON(403, ErrorResponse{Error: "you must change your password"})
+				return
+			}
 			c.Next()
 		} else {
 			slog.Error("Token is **not** valid")
@@ -228,8 +260,51 @@ func AdminRequired() gin.HandlerFunc {
 	}
 }
 
+// Permission middleware, user must have `perm` (use after AuthRequired with extra info!)
+func PermissionRequired(perm int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.GetUint("userId")
+		perms := c.GetInt("userPermissions")
+		if hasPermission(perms, perm) {
+			slog.Debug("PermissionRequired: User has permission to access route", "user_id", userId, "perm", perm)
+			c.Next()
+			return
+		}
+		slog.Info("PermissionRequired: User denied permission to access route", "user_id", userId, "perm", perm)
+		c.AbortWithStatus(401)
+	}
+}
+
+// Sonarr/Radarr webhook middleware, the request must be sent with
+// ARR_WEBHOOK_SECRET as its basic auth password.
+func ArrWebhookAuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Config.ARR_WEBHOOK_SECRET == "" {
+			slog.Debug("ArrWebhookAuthRequired: Webhooks are disabled, ARR_WEBHOOK_SECRET not set")
+			c.AbortWithStatus(404)
+			return
+		}
+		_, pw, ok := c.Request.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(pw), []byte(Config.ARR_WEBHOOK_SECRET)) == 1 {
+			c.Next()
+			return
+		}
+		slog.Warn("ArrWebhookAuthRequired: Webhook sent with missing or incorrect secret", "ip", c.ClientIP())
+		c.AbortWithStatus(401)
+	}
+}
+
 func register(ur *UserRegisterRequest, initialPerm int, db *gorm.DB) (AuthResponse, error) {
-	if !Config.SIGNUP_ENABLED {
+	var invite *Token
+	if ur.InviteCode != "" {
+		inv, err := getValidInvite(db, ur.InviteCode)
+		if err != nil {
+			return AuthResponse{}, err
+		}
+		invite = &inv
+		// Invite permissions are given on top of the default permission.
+		initialPerm = initialPerm | PERM_NONE | inv.Permissions
+	} else if !Config.SIGNUP_ENABLED {
 		slog.Warn("Register called, but signing up is disabled.")
 		return AuthResponse{}, errors.New("registering is disabled")
 	}
@@ -249,16 +324,38 @@ func register(ur *UserRegisterRequest, initialPerm int, db *gorm.DB) (AuthRespon
 		user.Permissions = initialPerm
 	}
 
-	res := db.Create(&user)
-	if res.Error != nil {
+	// Create user, their login identity and count the invite use together, so
+	// a used up invite can't be used by multiple people registering at once.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// Username must be unique between watcharr logins too, since
+		// they may belong to users that originate from other services.
+		i := UserIdentity{UserID: user.ID, Type: WATCHARR_USER, ThirdPartyID: user.Username, Username: user.Username}
+		if err := tx.Create(&i).Error; err != nil {
+			return err
+		}
+		if invite != nil {
+			if err := useInvite(tx, invite.ID); err != nil {
+				return err
+			}
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
 		// If error is because unique contraint failed.. user already exists
-		if res.Error == gorm.ErrDuplicatedKey {
-			slog.Error("Registration failed", "error", res.Error.Error(), "error_pretty", "User already exists")
+		if err == gorm.ErrDuplicatedKey {
+			slog.Error("Registration failed", "error", err.Error(), "error_pretty", "User already exists")
 			return AuthResponse{}, errors.New("User already exists")
 		}
 		slog.Error("Registration failed", "error", err, "error_pretty", "Watcharr does not know why this failed, assume database operation failed")
 		return AuthResponse{}, errors.New("unknown error")
 	}
+	if invite != nil {
+		slog.Info("User registered with an invite", "username", user.Username, "invite_id", invite.ID)
+	}
 
 	// Gorm fills our user obj with the ID from db after insert,
 	// just ensure it actually has.
@@ -293,13 +390,12 @@ func registerFirstUser(user *UserRegisterRequest, db *gorm.DB) (AuthResponse, er
 
 func login(user *User, db *gorm.DB) (AuthResponse, error) {
 	slog.Debug("A User Is Logging In", "username", user.Username)
-	dbUser := new(User)
-	res := db.Where("username = ? AND (type IS NULL OR type = 0)", user.Username).Take(&dbUser)
-	if res.Error != nil {
-		slog.Error("Failed to select user from database for login", "error", res.Error)
-		return AuthResponse{}, errors.New("User does not exist")
+	dbUser, _, err := getIdentityUser(db, WATCHARR_USER, user.Username)
+	if err != nil {
+		slog.Error("Failed to select user from database for login", "error", err)
+		// Same error as a wrong password, so usernames can't be guessed.
+		return AuthResponse{}, errIncorrectLoginDetails
 	}
-
 	match, err := compareHash(user.Password, dbUser.Password)
 	if err != nil {
 		slog.Error("Failed to compare pass to hash for login", "error", err)
@@ -307,99 +403,40 @@ func login(user *User, db *gorm.DB) (AuthResponse, error) {
 	}
 	if !match {
 		slog.Error("User failed to provide correct password for login", "hash_matched", match)
-		return AuthResponse{}, errors.New("incorrect details")
+		return AuthResponse{}, errIncorrectLoginDetails
+	}
+	// Only after the password is checked, so this can't be used to find usernames.
+	if dbUser.Disabled {
+		slog.Info("login: User is disabled", "user_id", dbUser.ID)
+		return AuthResponse{}, errors.New("account disabled")
 	}
 
-	token, err := signJWT(dbUser)
+	token, err := signJWT(&dbUser)
 	if err != nil {
 		slog.Error("Failed to sign new jwt", "error", err)
 		return AuthResponse{}, errors.New("failed to get auth token")
 	}
-	return AuthResponse{Token: token}, nil
+	return AuthResponse{Token: token, PasswordResetRequired: dbUser.PasswordResetRequired}, nil
 }
 
-func loginJellyfin(user *User, db *gorm.DB) (AuthResponse, error) {
-	if Config.JELLYFIN_HOST == "" {
-		slog.Error("Request made to login via Jellyfin, but JELLYFIN_HOST has not been configured.")
-		return AuthResponse{}, errors.New("jellyfin login not enabled")
-	}
-
-	base, err := url.Parse(Config.JELLYFIN_HOST + "/Users/AuthenticateByName")
-	if err != nil {
-		slog.Error("Failed to parse AuthenticateByName api endpoint url", "error", err.Error())
-		return AuthResponse{}, errors.New("failed to parse api uri")
-	}
-
-	// Marshall struct as json
-	usrJSON, err := json.Marshal(JellyfinAuth{Username: user.Username, Pw: user.Password})
-	if err != nil {
-		slog.Error("Error marshalling JellyfinAuth JSON", "error", err.Error())
-		return AuthResponse{}, errors.New("failed to marshal json")
-	}
-	// Run auth request
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", base.String(), bytes.NewBuffer(usrJSON))
-	if err != nil {
-		slog.Error("Creating request to jellyfin for auth failed", "error", err)
-		return AuthResponse{}, errors.New("request failed")
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("X-Emby-Authorization", "MediaBrowser Client=\"Watcharr\", Device=\"HTTP\", DeviceId=\"WatcharrFor"+user.Username+"\", Version=\"10.8.0\"")
-	res, err := client.Do(req)
-	if err != nil {
-		slog.Error("making request to jellyfin for auth failed", "error", err)
-		return AuthResponse{}, errors.New("request failed")
-	}
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
+// Login via a Jellyfin compatible media server.
+func loginMediaServer(s MediaServer, user *User, db *gorm.DB) (AuthResponse, error) {
+	resp, err := authenticateMediaServer(s, user.Username, user.Password)
 	if err != nil {
-		slog.Error("Error reading jellyfin auth response", "error", err.Error())
 		return AuthResponse{}, err
 	}
-	if res.StatusCode != 200 {
-		slog.Error("Jellyfin auth non 200 status code", "status_code", res.StatusCode, "error", string(body))
-		return AuthResponse{}, errors.New("incorrect details")
-	}
-	// Process auth response
-	resp := new(JellyfinAuthResponse)
-	err = json.Unmarshal([]byte(body), &resp)
+	dbUser, err := getOrCreateIdentityUser(db, s.UserType, resp.User.ID, resp.AccessToken, resp.User.Name, nil)
 	if err != nil {
-		return AuthResponse{}, errors.New("failed to process response")
-	}
-	if resp.User.ID == "" {
-		return AuthResponse{}, errors.New("jellyfin returned empty user id")
-	}
-
-	dbUser := new(User)
-	dbRes := db.Where("third_party_id = ? AND type = ?", resp.User.ID, JELLYFIN_USER).Take(&dbUser)
-	if dbRes.Error != nil {
-		if errors.Is(dbRes.Error, gorm.ErrRecordNotFound) {
-			// Record not found, so we should create the user
-			// dbUser will be empty, so we can just reuse it for this purpose.
-			dbUser.ThirdPartyID = resp.User.ID
-			dbUser.ThirdPartyAuth = resp.AccessToken
-			dbUser.Username = resp.User.Name
-			dbUser.Type = JELLYFIN_USER
-
-			dbRes = db.Create(&dbUser)
-			if dbRes.Error != nil {
-				slog.Error("Failed to create new user in db from jellyfin response", "error", dbRes.Error)
-				return AuthResponse{}, errors.New("failed to create new user from jellyfin")
-			}
-		} else {
-			return AuthResponse{}, errors.New("error locating user in db")
-		}
+		return AuthResponse{}, err
 	}
-	// If user exists.. update their access token in db
-	if resp.AccessToken != "" {
-		slog.Debug("Jellyfin user login - updating user with new access token")
-		dbUser.ThirdPartyAuth = resp.AccessToken
-		db.Save(&dbUser)
+	if dbUser.Disabled {
+		slog.Info("loginMediaServer: User is disabled", "server", s.Name, "user_id", dbUser.ID)
+		return AuthResponse{}, errors.New("account disabled")
 	}
 
-	token, err := signJWT(dbUser)
+	token, err := signJWT(&dbUser)
 	if err != nil {
-		slog.Error("Failed to sign new (jellyfin login) jwt", "error", err)
+		slog.Error("Failed to sign new (media server login) jwt", "server", s.Name, "error", err)
 		return AuthResponse{}, errors.New("failed to get auth token")
 	}
 	return AuthResponse{Token: token}, nil
@@ -407,47 +444,26 @@ func loginJellyfin(user *User, db *gorm.DB) (AuthResponse, error) {
 
 // Login via Plex.
 func loginPlex(lr *PlexLoginRequest, db *gorm.DB) (AuthResponse, error) {
-	if Config.PLEX_HOST == "" || Config.PLEX_MACHINE_ID == "" {
-		slog.Error("Request made to login via Plex, but Plex authentication is disabled")
-		return AuthResponse{}, errors.New("plex login not enabled")
-	}
 	slog.Debug("A Plex User Is Logging In", "authtoken", lr.AuthToken)
-	account, err := fetchPlexAccountFromToken(lr.AuthToken)
+	account, err := getPlexAccount(lr.AuthToken)
 	if err != nil {
-		slog.Error("loginPlex: Could not fetch Plex account", "error", err)
-		return AuthResponse{}, errors.New("could not fetch plex acount")
-	}
-	if account.Username == "" || account.Id == 0 {
-		slog.Error("loginPlex: Username or id missing from account response:", "username", account.Username, "id", account.Id)
-		return AuthResponse{}, errors.New("data is missing from the plex account response")
-	}
-	dbUser := new(User)
-	dbRes := db.Where("third_party_id = ? AND type = ?", account.Id, PLEX_USER).Take(&dbUser)
-	if dbRes.Error != nil {
-		if errors.Is(dbRes.Error, gorm.ErrRecordNotFound) {
-			slog.Debug("loginPlex: New plex user attempted login.. creating Watcharr account now.")
-			if err := plexUserHasAccessToPlexHost(lr.AuthToken); err != nil {
-				slog.Error("loginPlex: Cannot register Plex user. Failed to verify they have access to our home plex server.", "error", err)
-				return AuthResponse{}, errors.New("failed to verify plex access")
-			}
-			// Record not found, so we should create the user
-			// dbUser will be empty, so we can just reuse it for this purpose.
-			dbUser.ThirdPartyID = strconv.FormatUint(account.Id, 10)
-			dbUser.ThirdPartyAuth = lr.AuthToken
-			dbUser.Username = account.Username
-			dbUser.Type = PLEX_USER
-
-			dbRes = db.Create(&dbUser)
-			if dbRes.Error != nil {
-				slog.Error("loginPlex: Failed to create new user in db from plex response", "error", dbRes.Error)
-				return AuthResponse{}, errors.New("failed to create new user from plex")
-			}
-		} else {
-			slog.Error("loginPlex: Failed to select user from database for login", "error", dbRes.Error)
-			return AuthResponse{}, errors.New("failed to locate user")
+		return AuthResponse{}, err
+	}
+	dbUser, err := getOrCreateIdentityUser(db, PLEX_USER, strconv.FormatUint(account.Id, 10), lr.AuthToken, account.Username, func() error {
+		if err := plexUserHasAccessToPlexHost(lr.AuthToken); err != nil {
+			slog.Error("loginPlex: Cannot register Plex user. Failed to verify they have access to our home plex server.", "error", err)
+			return errors.New("failed to verify plex access")
 		}
+		return nil
+	})
+	if err != nil {
+		return AuthResponse{}, err
+	}
+	if dbUser.Disabled {
+		slog.Info("loginPlex: User is disabled", "user_id", dbUser.ID)
+		return AuthResponse{}, errors.New("account disabled")
 	}
-	token, err := signJWT(dbUser)
+	token, err := signJWT(&dbUser)
 	if err != nil {
 		slog.Error("loginPlex: Failed to sign new jwt", "error", err)
 		return AuthResponse{}, errors.New("failed to get auth token")
@@ -496,8 +512,15 @@ func useAdminToken(req *UseAdminTokenRequest, db *gorm.DB, userId uint) error {
 	return nil
 }
 
+// Parse an auth token, verifying it was signed by one of our secrets.
+func parseAuthToken(atoken string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(atoken, &TokenClaims{}, getJWTVerificationKey, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
 func signJWT(user *User) (token string, err error) {
 	// Create new jwt with claim data
+	jwtSecretsMutex.RLock()
+	defer jwtSecretsMutex.RUnlock()
 	jwt := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
 		user.ID,
 		user.Username,
@@ -509,8 +532,11 @@ func signJWT(user *User) (token string, err error) {
 		},
 	})
 
+	// Set key id so we know which secret to verify with after it has been rotated.
+	jwt.Header["kid"] = Config.JWT_SECRET_ID
+
 	// Sign and get the complete encoded token as a string using the secret
-	return jwt.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return jwt.SignedString([]byte(Config.JWT_SECRET))
 }
 
 func hashPassword(password string, p *ArgonParams) (encodedHash string, err error) {
@@ -631,11 +657,12 @@ func userChangePassword(db *gorm.DB, pwds UserPasswordUpdateRequest, userId uint
 		return errors.New("failed to hash new password")
 	}
 	slog.Debug("userChangePassword new password hashed", "user_id", userId)
-	if err := db.Model(&User{}).Where("id = ?", userId).Update("password", hash).Error; err != nil {
+	if err := db.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{"password": hash, "password_reset_required": false}).Error; err != nil {
 		slog.Error("userChangePassword failed - failed to update password in database", "user_id", userId, "error", err)
 		return errors.New("failed to update password")
 	} else {
 		slog.Debug("userChangePassword password updated", "user_id", userId)
 	}
+	setPasswordResetRequired(userId, false)
 	return nil
 }
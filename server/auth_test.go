@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestArrWebhookAuthRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		// If basic auth is sent at all.
+		sendAuth bool
+		password string
+		want     int
+	}{
+		{"correct secret", "webhook-secret", true, "webhook-secret", http.StatusOK},
+		{"wrong secret", "webhook-secret", true, "guess", http.StatusUnauthorized},
+		{"empty password", "webhook-secret", true, "", http.StatusUnauthorized},
+		{"no auth", "webhook-secret", false, "", http.StatusUnauthorized},
+		{"webhooks disabled", "", true, "", http.StatusNotFound},
+		{"webhooks disabled without auth", "", false, "", http.StatusNotFound},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := Config.ARR_WEBHOOK_SECRET
+			Config.ARR_WEBHOOK_SECRET = tt.secret
+			t.Cleanup(func() { Config.ARR_WEBHOOK_SECRET = old })
+
+			r := gin.New()
+			r.POST("/webhook", ArrWebhookAuthRequired(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			if tt.sendAuth {
+				req.SetBasicAuth("sonarr", tt.password)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Automatic requests for planned content.
+// Users can opt in to having movies and shows they add to their planned
+// list requested for them. Admins have it sent straight to the servers
+// with AutoRequestPlanned enabled, users with PERM_REQUEST_CONTENT get
+// a request for an admin to approve, like requesting it themselves.
+// When seerr is the request backend, everyone gets a request made in seerr.
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+type AutoRequestOutcome string
+
+var (
+	// Sent to sonarr/radarr.
+	AUTO_REQUEST_SENT AutoRequestOutcome = "SENT"
+	// Content request created, waiting for an admin.
+	AUTO_REQUEST_REQUESTED AutoRequestOutcome = "REQUESTED"
+	AUTO_REQUEST_FAILED    AutoRequestOutcome = "FAILED"
+)
+
+// Data of AUTO_REQUESTED activities.
+type AutoRequestActivityData struct {
+	Outcome    AutoRequestOutcome `json:"outcome"`
+	ServerName string             `json:"serverName,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Get the first server with AutoRequestPlanned enabled for the content type.
+func getAutoRequestServer(contentType ContentType) (string, bool) {
+	if contentType == MOVIE {
+		for _, s := range Config.RADARR {
+			if s.AutoRequestPlanned {
+				return s.Name, true
+			}
+		}
+		return "", false
+	}
+	for _, s := range Config.SONARR {
+		if s.AutoRequestPlanned {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+// Request content a user just planned, if they have opted in and are allowed to.
+// The outcome is saved as an activity on their watched list item.
+func autoRequestPlanned(db *gorm.DB, userId uint, watchedId uint, content Content) {
+	seerrBackend := RequestBackendType(Config.REQUEST_BACKEND) == REQUEST_BACKEND_SEERR
+	serverName := ""
+	if seerrBackend {
+		if !Config.SEERR.AutoRequestPlanned {
+			return
+		}
+	} else {
+		var ok bool
+		serverName, ok = getAutoRequestServer(content.Type)
+		if !ok {
+			return
+		}
+	}
+	var user User
+	if res := db.Select("id", "username", "permissions", "auto_request_planned").Where("id = ?", userId).Take(&user); res.Error != nil {
+		slog.Error("autoRequestPlanned: Failed to get user", "user_id", userId, "error", res.Error)
+		return
+	}
+	if user.AutoRequestPlanned == nil || !*user.AutoRequestPlanned {
+		return
+	}
+	var data AutoRequestActivityData
+	if hasPermission(user.Permissions, PERM_ADMIN) && !seerrBackend {
+		download, err := sendContentRequestToArr(content, ContentRequestApproveRequest{ServerName: serverName}, user.Username)
+		if err != nil {
+			data = AutoRequestActivityData{Outcome: AUTO_REQUEST_FAILED, ServerName: serverName, Error: err.Error()}
+		} else {
+			download.UserID = userId
+			trackArrDownload(db, download)
+			data = AutoRequestActivityData{Outcome: AUTO_REQUEST_SENT, ServerName: serverName}
+		}
+	} else if hasPermission(user.Permissions, PERM_REQUEST_CONTENT) {
+		_, err := addContentRequest(db, userId, ContentRequestAddRequest{
+			ContentID:   content.TmdbID,
+			ContentType: content.Type,
+			Note:        "Automatically requested from planned list.",
+		})
+		if err != nil {
+			data = AutoRequestActivityData{Outcome: AUTO_REQUEST_FAILED, Error: err.Error()}
+		} else {
+			data = AutoRequestActivityData{Outcome: AUTO_REQUEST_REQUESTED}
+		}
+	} else {
+		slog.Debug("autoRequestPlanned: User doesn't have permission to request content", "user_id", userId)
+		return
+	}
+	slog.Info("autoRequestPlanned: Requested planned content", "user_id", userId, "content_id", content.ID, "outcome", data.Outcome)
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("autoRequestPlanned: Failed to marshal activity data", "error", err)
+		return
+	}
+	addActivity(db, userId, ActivityAddRequest{WatchedID: watchedId, Type: AUTO_REQUESTED, Data: string(dataJson)})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetAutoRequestServer(t *testing.T) {
+	old := Config
+	t.Cleanup(func() { Config = old })
+	Config.RADARR = []RadarrSettings{
+		{ArrSettings: ArrSettings{Name: "radarr"}},
+		{ArrSettings: ArrSettings{Name: "radarr-auto", AutoRequestPlanned: true}},
+	}
+	Config.SONARR = []SonarrSettings{{ArrSettings: ArrSettings{Name: "sonarr"}}}
+
+	tests := []struct {
+		contentType ContentType
+		want        string
+		wantOk      bool
+	}{
+		{MOVIE, "radarr-auto", true},
+		{SHOW, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.contentType), func(t *testing.T) {
+			got, ok := getAutoRequestServer(tt.contentType)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("getAutoRequestServer() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAutoRequestPlanned(t *testing.T) {
+	// Radarr that fails everything, so admin requests are seen failing at the arr.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	yes, no := true, false
+	tests := []struct {
+		name        string
+		permissions int
+		optedIn     *bool
+		// If the radarr server has AutoRequestPlanned enabled.
+		serverAuto  bool
+		wantOutcome AutoRequestOutcome
+		wantServer  string
+		wantRequest bool
+	}{
+		{name: "admin is sent to the arr", permissions: PERM_ADMIN, optedIn: &yes, serverAuto: true, wantOutcome: AUTO_REQUEST_FAILED, wantServer: "radarr"},
+		{name: "requester gets a request", permissions: PERM_REQUEST_CONTENT, optedIn: &yes, serverAuto: true, wantOutcome: AUTO_REQUEST_REQUESTED, wantRequest: true},
+		{name: "user without permission", permissions: PERM_NONE, optedIn: &yes, serverAuto: true},
+		{name: "requester opted out", permissions: PERM_REQUEST_CONTENT, optedIn: &no, serverAuto: true},
+		{name: "requester never opted in", permissions: PERM_REQUEST_CONTENT, serverAuto: true},
+		{name: "no server auto requests", permissions: PERM_REQUEST_CONTENT, optedIn: &yes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := Config
+			t.Cleanup(func() { Config = old })
+			Config.REQUEST_BACKEND = ""
+			Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{
+				Name:               "radarr",
+				AutoRequestPlanned: tt.serverAuto,
+				ArrConnection:      ArrConnection{Host: srv.URL, Key: "key"},
+			}}}
+
+			db := newTestDB(t, &Image{}, &User{}, &Content{}, &ContentRequest{}, &ArrDownload{}, &Activity{})
+			user := User{Username: "user", Permissions: tt.permissions, UserSettings: UserSettings{AutoRequestPlanned: tt.optedIn}}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatal("failed to create user:", err)
+			}
+			content := Content{TmdbID: 603, Title: "The Matrix", Type: MOVIE}
+			if err := db.Create(&content).Error; err != nil {
+				t.Fatal("failed to create content:", err)
+			}
+
+			autoRequestPlanned(db, user.ID, 1, content)
+
+			var activities []Activity
+			db.Where("type = ?", AUTO_REQUESTED).Find(&activities)
+			if tt.wantOutcome == "" {
+				if len(activities) != 0 {
+					t.Errorf("%d activities added, want none", len(activities))
+				}
+			} else {
+				if len(activities) != 1 {
+					t.Fatalf("%d activities added, want 1", len(activities))
+				}
+				var data AutoRequestActivityData
+				if err := json.Unmarshal([]byte(activities[0].Data), &data); err != nil {
+					t.Fatal("failed to unmarshal activity data:", err)
+				}
+				if data.Outcome != tt.wantOutcome || data.ServerName != tt.wantServer {
+					t.Errorf("activity = %+v, want outcome %s server %q", data, tt.wantOutcome, tt.wantServer)
+				}
+			}
+			var requests int64
+			db.Model(&ContentRequest{}).Count(&requests)
+			if (requests > 0) != tt.wantRequest {
+				t.Errorf("%d content requests made, want request %v", requests, tt.wantRequest)
+			}
+		})
+	}
+}
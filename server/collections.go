@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A TMDB collection (franchise) of movies, cached in the servers language.
+// Names and titles are translated when returned to users with another language.
+type Collection struct {
+	// TMDB collection id.
+	ID           int              `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	UpdatedAt    time.Time        `json:"updatedAt"`
+	Name         string           `json:"name"`
+	Overview     string           `json:"overview"`
+	PosterPath   string           `json:"posterPath"`
+	BackdropPath string           `json:"backdropPath"`
+	Parts        []CollectionPart `json:"parts"`
+}
+
+type CollectionPart struct {
+	CollectionID int    `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	TmdbID       int    `json:"tmdbId" gorm:"primaryKey;autoIncrement:false"`
+	Title        string `json:"title"`
+	PosterPath   string `json:"posterPath"`
+	// YYYY-MM-DD, empty if TMDB doesn't have one yet.
+	ReleaseDate string `json:"releaseDate"`
+}
+
+// A part of a collection, with what the user has done with it.
+type UserCollectionPart struct {
+	CollectionPart
+	// Empty if not on the users list.
+	Status WatchedStatus `json:"status,omitempty"`
+	Rating int8          `json:"rating,omitempty"`
+}
+
+type UserCollection struct {
+	Collection
+	Parts []UserCollectionPart `json:"parts"`
+	// Parts the user has finished.
+	Watched int `json:"watched"`
+	// Parts out now, unreleased parts can't be watched yet.
+	Released int `json:"released"`
+	Total    int `json:"total"`
+}
+
+// How long collections are cached before we check TMDB for new parts.
+const collectionMaxAge = 7 * 24 * time.Hour
+
+// Get a collection from our db, or fetch and cache it if we don't have
+// it or it's old. If updating fails, the old collection is returned.
+func getOrCacheCollection(db *gorm.DB, id int) (Collection, error) {
+	var c Collection
+	res := db.Preload("Parts").Where("id = ?", id).Find(&c)
+	if res.Error != nil {
+		slog.Error("getOrCacheCollection: Failed to get collection from db", "id", id, "error", res.Error)
+		return Collection{}, errors.New("failed to get collection")
+	}
+	if c.ID != 0 && time.Since(c.UpdatedAt) < collectionMaxAge {
+		return c, nil
+	}
+	resp := new(TMDBCollectionDetails)
+	err := tmdbRequest("/collection/"+strconv.Itoa(id), map[string]string{"language": getServerLanguage()}, &resp)
+	if err != nil {
+		slog.Error("getOrCacheCollection: Failed to complete collection details request!", "id", id, "error", err)
+		if c.ID != 0 {
+			return c, nil
+		}
+		return Collection{}, errors.New("failed to complete collection details request")
+	}
+	nc := Collection{
+		ID:           resp.ID,
+		Name:         resp.Name,
+		Overview:     resp.Overview,
+		PosterPath:   resp.PosterPath,
+		BackdropPath: resp.BackdropPath,
+		Parts:        []CollectionPart{},
+	}
+	for _, p := range resp.Parts {
+		nc.Parts = append(nc.Parts, CollectionPart{
+			CollectionID: resp.ID,
+			TmdbID:       p.ID,
+			Title:        p.Title,
+			PosterPath:   p.PosterPath,
+			ReleaseDate:  p.ReleaseDate,
+		})
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Parts are replaced, since they can be removed from collections.
+		if err := tx.Where("collection_id = ?", id).Delete(&CollectionPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&nc).Error
+	})
+	if err != nil {
+		slog.Error("getOrCacheCollection: Failed to save collection", "id", id, "error", err)
+		return Collection{}, errors.New("failed to cache collection")
+	}
+	return nc, nil
+}
+
+// Translate a collections name, overview and part titles into `language`.
+// The collection is left as it is if it can't be translated.
+func translateCollection(c Collection, language string) Collection {
+	if language == getServerLanguage() {
+		return c
+	}
+	resp := new(TMDBCollectionDetails)
+	err := tmdbRequest("/collection/"+strconv.Itoa(c.ID), map[string]string{"language": language}, &resp)
+	if err != nil {
+		slog.Error("translateCollection: Failed to get collection details", "id", c.ID, "language", language, "error", err)
+		return c
+	}
+	if resp.Name != "" {
+		c.Name = resp.Name
+	}
+	if resp.Overview != "" {
+		c.Overview = resp.Overview
+	}
+	titles := map[int]string{}
+	for _, p := range resp.Parts {
+		titles[p.ID] = p.Title
+	}
+	// Copied, so we aren't changing the parts of the collection passed to us.
+	parts := make([]CollectionPart, len(c.Parts))
+	for i, p := range c.Parts {
+		if t := titles[p.TmdbID]; t != "" {
+			p.Title = t
+		}
+		parts[i] = p
+	}
+	c.Parts = parts
+	return c
+}
+
+// Add the users watched status of each part to a collection.
+func getUserCollectionCompletion(db *gorm.DB, userId uint, c Collection) (UserCollection, error) {
+	ids := []int{}
+	for _, p := range c.Parts {
+		ids = append(ids, p.TmdbID)
+	}
+	var watched []Watched
+	res := db.Joins("Content").
+		Where("watcheds.user_id = ? AND Content.type = ? AND Content.tmdb_id IN ?", userId, MOVIE, ids).
+		Find(&watched)
+	if res.Error != nil {
+		slog.Error("getUserCollectionCompletion: Failed to get users watched parts", "user_id", userId, "collection_id", c.ID, "error", res.Error)
+		return UserCollection{}, errors.New("failed to get your watched parts of collection")
+	}
+	byTmdbId := map[int]Watched{}
+	for _, w := range watched {
+		if w.Content != nil {
+			byTmdbId[w.Content.TmdbID] = w
+		}
+	}
+	today := time.Now().Format("2006-01-02")
+	uc := UserCollection{Collection: c, Parts: []UserCollectionPart{}, Total: len(c.Parts)}
+	for _, p := range c.Parts {
+		up := UserCollectionPart{CollectionPart: p}
+		if w, ok := byTmdbId[p.TmdbID]; ok {
+			up.Status = w.Status
+			up.Rating = w.Rating
+			if w.Status == FINISHED {
+				uc.Watched++
+			}
+		}
+		if p.ReleaseDate != "" && p.ReleaseDate <= today {
+			uc.Released++
+		}
+		uc.Parts = append(uc.Parts, up)
+	}
+	// In release order, with unknown release dates last.
+	sort.SliceStable(uc.Parts, func(i, j int) bool {
+		a, b := uc.Parts[i].ReleaseDate, uc.Parts[j].ReleaseDate
+		if a == "" || b == "" {
+			return b == "" && a != ""
+		}
+		return a < b
+	})
+	return uc, nil
+}
+
+// Get every collection the user has a movie from on their list.
+func getUserCollections(db *gorm.DB, userId uint, language string) ([]UserCollection, error) {
+	var ids []int
+	res := db.Model(&Watched{}).
+		Joins("JOIN contents ON contents.id = watcheds.content_id").
+		Where("watcheds.user_id = ? AND contents.collection_id > 0", userId).
+		Distinct().
+		Pluck("contents.collection_id", &ids)
+	if res.Error != nil {
+		slog.Error("getUserCollections: Failed to get users collection ids", "user_id", userId, "error", res.Error)
+		return []UserCollection{}, errors.New("failed to get your collections")
+	}
+	ucs := []UserCollection{}
+	for _, id := range ids {
+		c, err := getOrCacheCollection(db, id)
+		if err != nil {
+			continue
+		}
+		uc, err := getUserCollectionCompletion(db, userId, translateCollection(c, language))
+		if err != nil {
+			return []UserCollection{}, err
+		}
+		ucs = append(ucs, uc)
+	}
+	sort.Slice(ucs, func(i, j int) bool {
+		return ucs[i].Name < ucs[j].Name
+	})
+	return ucs, nil
+}
+
+func getUserCollection(db *gorm.DB, userId uint, id int, language string) (UserCollection, error) {
+	c, err := getOrCacheCollection(db, id)
+	if err != nil {
+		return UserCollection{}, err
+	}
+	return getUserCollectionCompletion(db, userId, translateCollection(c, language))
+}
+
+// Add every part of a collection that isn't on the users list as PLANNED.
+// Parts that fail to be added are skipped, the rest are still added.
+func planCollection(db *gorm.DB, userId uint, id int) ([]Watched, error) {
+	// Titles aren't returned, so no need to translate them.
+	uc, err := getUserCollection(db, userId, id, getServerLanguage())
+	if err != nil {
+		return []Watched{}, err
+	}
+	added := []Watched{}
+	for _, p := range uc.Parts {
+		if p.Status != "" {
+			continue
+		}
+		w, err := addWatched(db, userId, WatchedAddRequest{Status: PLANNED, ContentID: p.TmdbID, ContentType: MOVIE}, ADDED_WATCHED)
+		if err != nil {
+			slog.Error("planCollection: Failed to add part", "user_id", userId, "collection_id", id, "tmdb_id", p.TmdbID, "error", err)
+			continue
+		}
+		added = append(added, w)
+	}
+	slog.Info("planCollection: Planned collection", "user_id", userId, "collection_id", id, "added", len(added))
+	return added, nil
+}
+
+// Fill in the collection of movies cached before we tracked them,
+// a few at a time so we don't hog the TMDB rate limit.
+// Movies that fail are marked as having no collection so we move on
+// to the next ones, they get it back next time their details are cached.
+func backfillContentCollections(db *gorm.DB) {
+	var movies []Content
+	res := db.Where("type = ? AND collection_id IS NULL", MOVIE).Limit(10).Find(&movies)
+	if res.Error != nil {
+		slog.Error("backfillContentCollections: Failed to get movies to backfill", "error", res.Error)
+		return
+	}
+	for _, m := range movies {
+		resp := new(TMDBMovieDetails)
+		err := tmdbRequest("/movie/"+strconv.Itoa(m.TmdbID), map[string]string{"language": getServerLanguage()}, &resp)
+		if err == nil {
+			if _, err = cacheContentMovie(db, *resp, true); err == nil {
+				continue
+			}
+		}
+		var tmdbErr *TMDBError
+		if !errors.As(err, &tmdbErr) || tmdbErr.StatusCode != 404 {
+			slog.Error("backfillContentCollections: Failed to backfill movie", "tmdb_id", m.TmdbID, "error", err)
+		}
+		if res := db.Model(&Content{}).Where("id = ?", m.ID).Update("collection_id", 0); res.Error != nil {
+			slog.Error("backfillContentCollections: Failed to mark movie as backfilled", "tmdb_id", m.TmdbID, "error", res.Error)
+		}
+	}
+}
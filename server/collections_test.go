@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetUserCollectionCompletion(t *testing.T) {
+	db := newTestDB(t, &Image{}, &User{}, &Content{}, &Game{}, &Watched{}, &WatchedSeason{}, &WatchedEpisode{}, &Activity{})
+	users := []User{{Username: "user"}, {Username: "other"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal("failed to create users:", err)
+	}
+	nextYear := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+	c := Collection{ID: 2344, Name: "The Matrix Collection", Parts: []CollectionPart{
+		{CollectionID: 2344, TmdbID: 4, Title: "Untitled"},
+		{CollectionID: 2344, TmdbID: 3, Title: "Future", ReleaseDate: nextYear},
+		{CollectionID: 2344, TmdbID: 1, Title: "The Matrix", ReleaseDate: "1999-03-31"},
+		{CollectionID: 2344, TmdbID: 2, Title: "The Matrix Reloaded", ReleaseDate: "2003-05-15"},
+	}}
+	contents := []Content{
+		{TmdbID: 1, Title: "The Matrix", Type: MOVIE},
+		{TmdbID: 2, Title: "The Matrix Reloaded", Type: MOVIE},
+		{TmdbID: 3, Title: "Future", Type: MOVIE},
+		{TmdbID: 4, Title: "Untitled", Type: MOVIE},
+		// Show with the same tmdb id as a part, which isn't part of the collection.
+		{TmdbID: 4, Title: "Some Show", Type: SHOW},
+	}
+	if err := db.Create(&contents).Error; err != nil {
+		t.Fatal("failed to create content:", err)
+	}
+	watched := []Watched{
+		{UserID: users[0].ID, ContentID: &contents[0].ID, Status: FINISHED, Rating: 9},
+		{UserID: users[0].ID, ContentID: &contents[1].ID, Status: WATCHING},
+		{UserID: users[0].ID, ContentID: &contents[2].ID, Status: PLANNED},
+		{UserID: users[0].ID, ContentID: &contents[4].ID, Status: FINISHED},
+		// Other users finishing a part doesn't count.
+		{UserID: users[1].ID, ContentID: &contents[3].ID, Status: FINISHED},
+	}
+	if err := db.Create(&watched).Error; err != nil {
+		t.Fatal("failed to create watched:", err)
+	}
+
+	got, err := getUserCollectionCompletion(db, users[0].ID, c)
+	if err != nil {
+		t.Fatal("getUserCollectionCompletion() error:", err)
+	}
+	if got.Watched != 1 || got.Released != 2 || got.Total != 4 {
+		t.Errorf("watched %d, released %d, total %d, want 1, 2, 4", got.Watched, got.Released, got.Total)
+	}
+	type part struct {
+		TmdbID int
+		Status WatchedStatus
+		Rating int8
+	}
+	gotParts := []part{}
+	for _, p := range got.Parts {
+		gotParts = append(gotParts, part{p.TmdbID, p.Status, p.Rating})
+	}
+	// In release order, unknown release dates last.
+	wantParts := []part{{1, FINISHED, 9}, {2, WATCHING, 0}, {3, PLANNED, 0}, {4, "", 0}}
+	if !reflect.DeepEqual(gotParts, wantParts) {
+		t.Errorf("parts = %+v, want %+v", gotParts, wantParts)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/sbondCo/Watcharr/game"
@@ -19,10 +20,30 @@ type ServerConfig struct {
 	// it strong, just like a very long, complicated password.
 	JWT_SECRET string `json:",omitempty"`
 
+	// Key id of JWT_SECRET, sent in the `kid` header of every
+	// token we sign. Generated automatically.
+	JWT_SECRET_ID string `json:",omitempty"`
+
+	// Previous JWT secrets that are no longer used for signing,
+	// but are still accepted when verifying tokens until they expire.
+	// Populated when JWT_SECRET is rotated from the web ui.
+	JWT_RETIRED_SECRETS []RetiredJWTSecret `json:",omitempty"`
+
+	// Tokens signed before kid headers were added don't have one.
+	// They are accepted as signed by this key id (the id generated for
+	// the secret that signed them) until JWT_LEGACY_EXPIRES_AT.
+	// Set automatically when upgrading a config without JWT_SECRET_ID.
+	JWT_LEGACY_SECRET_ID  string     `json:",omitempty"`
+	JWT_LEGACY_EXPIRES_AT *time.Time `json:",omitempty"`
+
 	// Optional: Point to your Jellyfin install
 	// to enable it as an auth provider.
 	JELLYFIN_HOST string `json:",omitempty"`
 
+	// Optional: Point to your Emby install
+	// to enable it as an auth provider.
+	EMBY_HOST string `json:",omitempty"`
+
 	// Enable/disable signup functionality.
 	// Set to `false` to disable registering an account.
 	SIGNUP_ENABLED bool
@@ -31,6 +52,24 @@ type ServerConfig struct {
 	// If unprovided, the default Watcharr API key will be used.
 	TMDB_KEY string `json:",omitempty"`
 
+	// Optional: Language metadata is shown in when users haven't chosen
+	// one (eg `en-US`), also used for content stored in the db. Defaults to en-US.
+	DEFAULT_LANGUAGE string `json:",omitempty"`
+
+	// Optional: Country watch providers are shown for when users
+	// haven't chosen one (eg `US`). Defaults to US.
+	DEFAULT_COUNTRY string `json:",omitempty"`
+
+	// Optional: Other metadata providers to use alongside TMDB.
+	METADATA MetadataSettings `json:",omitempty"`
+
+	// Optional: Url of the TMDB api, for using a proxy or mirror.
+	// Defaults to https://api.themoviedb.org/3.
+	TMDB_BASE_URL string `json:",omitempty"`
+
+	// Optional: Max size of the TMDB response cache in megabytes, defaults to 100.
+	TMDB_CACHE_MAX_SIZE int `json:",omitempty"`
+
 	// Optional: Point to Plex install to enable plex features.
 	PLEX_HOST string `json:",omitempty"`
 
@@ -40,10 +79,34 @@ type ServerConfig struct {
 	// Will be fetched automatically when PLEX_HOST is provided via web ui.
 	PLEX_MACHINE_ID string `json:",omitempty"`
 
+	// Optional: Public url of this Watcharr instance (eg https://watcharr.example.com).
+	// Used when building links that are sent to users, like password resets.
+	PUBLIC_URL string `json:",omitempty"`
+
+	// Optional: Ips/cidrs of reverse proxies we trust the X-Forwarded-For
+	// header from, used to find the real ip of clients (eg for login lockouts).
+	// Defaults to loopback and private network ranges, set to `[]` to
+	// trust none. Requires a restart.
+	TRUSTED_PROXIES *[]string `json:",omitempty"`
+
+	// Optional: Mail server to send emails (eg password resets) with.
+	SMTP SMTPSettings `json:",omitempty"`
+
 	SONARR []SonarrSettings `json:",omitempty"`
 	RADARR []RadarrSettings `json:",omitempty"`
 	TWITCH game.IGDB        `json:",omitempty"`
 
+	// Optional: Password sonarr/radarr must send (with basic auth)
+	// when calling our webhook endpoints. Webhooks are disabled when unset.
+	ARR_WEBHOOK_SECRET string `json:",omitempty"`
+
+	// Optional: Overseerr/Jellyseerr install to send content requests to.
+	SEERR SeerrSettings `json:",omitempty"`
+
+	// Where content requests go, `arr` (default, reviewed in Watcharr
+	// and sent to sonarr/radarr) or `seerr`.
+	REQUEST_BACKEND string `json:",omitempty"`
+
 	// Enable/disable debug logging. Useful for when trying
 	// to figure out exactly what the server is doing at a point
 	// of failure.
@@ -61,9 +124,12 @@ func (c *ServerConfig) GetSafe() ServerConfig {
 	return ServerConfig{
 		SIGNUP_ENABLED:  c.SIGNUP_ENABLED,
 		JELLYFIN_HOST:   c.JELLYFIN_HOST,
+		EMBY_HOST:       c.EMBY_HOST,
 		TMDB_KEY:        c.TMDB_KEY,
 		PLEX_HOST:       c.PLEX_HOST,
 		PLEX_MACHINE_ID: c.PLEX_MACHINE_ID,
+		PUBLIC_URL:      c.PUBLIC_URL,
+		SMTP:            c.SMTP, // Dont act safe, this contains smtp password, needed for config
 		DEBUG:           c.DEBUG,
 		SONARR:          c.SONARR, // Dont act safe, this contains sonarr api key, needed for config
 		RADARR:          c.RADARR, // Dont act safe, this contains radarr api key, needed for config
@@ -71,6 +137,14 @@ func (c *ServerConfig) GetSafe() ServerConfig {
 			ClientID:     c.TWITCH.ClientID,
 			ClientSecret: c.TWITCH.ClientSecret,
 		}, // Dont act safe, this contains twitch secrets, needed for config
+		ARR_WEBHOOK_SECRET:  c.ARR_WEBHOOK_SECRET,
+		SEERR:               c.SEERR, // Dont act safe, this contains seerr api key, needed for config
+		REQUEST_BACKEND:     c.REQUEST_BACKEND,
+		TMDB_BASE_URL:       c.TMDB_BASE_URL,
+		TMDB_CACHE_MAX_SIZE: c.TMDB_CACHE_MAX_SIZE,
+		DEFAULT_LANGUAGE:    c.DEFAULT_LANGUAGE,
+		DEFAULT_COUNTRY:     c.DEFAULT_COUNTRY,
+		METADATA:            c.METADATA, // Dont act safe, this contains provider api keys, needed for config
 	}
 }
 
@@ -106,9 +180,37 @@ func initFromConfig() error {
 	if Config.JWT_SECRET == "" {
 		log.Fatal("JWT_SECRET missing from config!")
 	}
+	// Configs from before key rotation was added won't have an id
+	// for their secret, generate one so we can start using kid headers.
+	if Config.JWT_SECRET_ID == "" {
+		kid, err := generateJWTKeyID()
+		if err != nil {
+			log.Fatal("Failed to generate JWT_SECRET_ID!", err)
+		}
+		legacyExpiresAt := time.Now().Add(legacyJWTGracePeriod)
+		Config.JWT_SECRET_ID = kid
+		Config.JWT_LEGACY_SECRET_ID = kid
+		Config.JWT_LEGACY_EXPIRES_AT = &legacyExpiresAt
+		if err := writeConfig(); err != nil {
+			log.Fatal("Failed to save generated JWT_SECRET_ID to config!", err)
+		}
+	}
+	if os.Getenv("JWT_SECRET") != "" {
+		slog.Warn("JWT_SECRET environment variable is set, but is no longer used. The JWT_SECRET from watcharr.json is used instead.")
+	}
+	loadMetadataProviders()
 	return nil
 }
 
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+func getTrustedProxies() []string {
+	if Config.TRUSTED_PROXIES != nil {
+		return *Config.TRUSTED_PROXIES
+	}
+	return defaultTrustedProxies
+}
+
 // Generate new barebones watcharr.json config file.
 // Generates a JWT_SECRET and set default config.
 func generateConfig() error {
@@ -116,8 +218,13 @@ func generateConfig() error {
 	if err != nil {
 		return err
 	}
+	kid, err := generateJWTKeyID()
+	if err != nil {
+		return err
+	}
 	cfg := ServerConfig{
-		JWT_SECRET: key,
+		JWT_SECRET:    key,
+		JWT_SECRET_ID: kid,
 		// Other defaults..
 		SIGNUP_ENABLED: true,
 	}
@@ -137,10 +244,42 @@ func updateConfig(k string, v any) error {
 	}
 	if k == "JELLYFIN_HOST" {
 		Config.JELLYFIN_HOST = v.(string)
+	} else if k == "EMBY_HOST" {
+		Config.EMBY_HOST = v.(string)
 	} else if k == "SIGNUP_ENABLED" {
 		Config.SIGNUP_ENABLED = v.(bool)
 	} else if k == "TMDB_KEY" {
 		Config.TMDB_KEY = v.(string)
+	} else if k == "DEFAULT_LANGUAGE" {
+		if l := v.(string); l != "" {
+			if err := validateLanguage(l); err != nil {
+				return err
+			}
+		}
+		Config.DEFAULT_LANGUAGE = v.(string)
+	} else if k == "DEFAULT_COUNTRY" {
+		if cc := v.(string); cc != "" {
+			if err := validateCountry(cc); err != nil {
+				return err
+			}
+		}
+		Config.DEFAULT_COUNTRY = v.(string)
+	} else if k == "TMDB_BASE_URL" {
+		Config.TMDB_BASE_URL = strings.TrimSuffix(v.(string), "/")
+	} else if k == "TMDB_CACHE_MAX_SIZE" {
+		size := int(v.(float64))
+		if size < 0 {
+			return errors.New("invalid cache size")
+		}
+		Config.TMDB_CACHE_MAX_SIZE = size
+	} else if k == "PUBLIC_URL" {
+		Config.PUBLIC_URL = strings.TrimSuffix(v.(string), "/")
+	} else if k == "ARR_WEBHOOK_SECRET" {
+		Config.ARR_WEBHOOK_SECRET = v.(string)
+	} else if k == "REQUEST_BACKEND" {
+		if err := updateConfigRequestBackend(v.(string)); err != nil {
+			return err
+		}
 	} else if k == "DEBUG" {
 		Config.DEBUG = v.(bool)
 		setLoggingLevel()
@@ -163,6 +302,10 @@ type ServerFeatures struct {
 	Sonarr bool `json:"sonarr"`
 	Radarr bool `json:"radarr"`
 	Games  bool `json:"games"`
+	// If the user can request content (to be approved by an admin, or in seerr).
+	ContentRequests bool `json:"contentRequests"`
+	// If the user can turn on automatically requesting planned content.
+	AutoRequestPlanned bool `json:"autoRequestPlanned"`
 }
 
 // Get enabled server functionality from Config.
@@ -174,7 +317,18 @@ func getEnabledFeatures(userPerms int) ServerFeatures {
 		f.Games = true
 	}
 	// https://github.com/sbondCo/Watcharr/issues/211
-	// Currently requesting permissions have not been setup, only admins for now.
+	// Users with the request permission can request content, which admins
+	// approve. Only admins can add directly to sonarr/radarr.
+	if hasPermission(userPerms, PERM_REQUEST_CONTENT) && requestBackendConfigured() {
+		f.ContentRequests = true
+		if RequestBackendType(Config.REQUEST_BACKEND) == REQUEST_BACKEND_SEERR {
+			f.AutoRequestPlanned = Config.SEERR.AutoRequestPlanned
+		} else {
+			_, movies := getAutoRequestServer(MOVIE)
+			_, shows := getAutoRequestServer(SHOW)
+			f.AutoRequestPlanned = movies || shows
+		}
+	}
 	if !hasPermission(userPerms, PERM_ADMIN) {
 		return f
 	}
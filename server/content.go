@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"path"
+	"strconv"
 	"time"
 
+	"github.com/sbondCo/Watcharr/metadata"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -36,6 +39,9 @@ type Content struct {
 	Runtime          uint32      `json:"runtime"`
 	NumberOfEpisodes uint32      `json:"numberOfEpisodes"`
 	NumberOfSeasons  uint32      `json:"numberOfSeasons"`
+	// TMDB collection (franchise) a movie is part of, 0 if none
+	// and nil if we haven't checked yet.
+	CollectionID *int `json:"collectionId,omitempty" gorm:"index"`
 }
 
 // onlyUpdate - If we should only update existing row if exists, or false to create/update if not exist.
@@ -72,6 +78,7 @@ func saveContent(db *gorm.DB, c *Content, onlyUpdate bool) error {
 				"runtime",
 				"number_of_episodes",
 				"number_of_seasons",
+				"collection_id",
 			}),
 		}).Create(&c)
 		if res.Error != nil {
@@ -160,6 +167,11 @@ func cacheContentMovie(db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (
 		Revenue:     content.Revenue,
 		Runtime:     content.Runtime,
 	}
+	collectionId := 0
+	if content.BelongsToCollection != nil {
+		collectionId = content.BelongsToCollection.ID
+	}
+	c.CollectionID = &collectionId
 
 	err = saveContent(db, &c, onlyUpdate)
 	if err != nil {
@@ -170,6 +182,50 @@ func cacheContentMovie(db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (
 	return c, nil
 }
 
+// Get content from our db, or fetch and cache it if we don't have it yet.
+func getOrCacheContent(db *gorm.DB, contentType ContentType, tmdbId int) (Content, error) {
+	var content Content
+	db.Where("type = ? AND tmdb_id = ?", contentType, tmdbId).Find(&content)
+
+	// Create content if not found from our db
+	if content == (Content{}) {
+		slog.Debug("Content not in db, fetching...")
+
+		resp, err := tmdbAPIRequest("/"+string(contentType)+"/"+strconv.Itoa(tmdbId), map[string]string{})
+		if err != nil {
+			slog.Error("getOrCacheContent content tmdb api request failed", "error", err)
+			return Content{}, errors.New("failed to find requested media")
+		}
+
+		if contentType == "movie" {
+			c := new(TMDBMovieDetails)
+			err := json.Unmarshal([]byte(resp), &c)
+			if err != nil {
+				slog.Error("Failed to unmarshal movie details", "error", err)
+				return Content{}, errors.New("failed to process movie details response")
+			}
+			content, err = cacheContentMovie(db, *c, false)
+			if err != nil {
+				slog.Error("getOrCacheContent failed to cache movie content", "content_id", tmdbId, "err", err)
+				return Content{}, errors.New("failed to cache content")
+			}
+		} else {
+			c := new(TMDBShowDetails)
+			err := json.Unmarshal(resp, &c)
+			if err != nil {
+				slog.Error("Failed to unmarshal tv details", "error", err)
+				return Content{}, errors.New("failed to process tv details response")
+			}
+			content, err = cacheContentTv(db, *c, false)
+			if err != nil {
+				slog.Error("getOrCacheContent failed to cache tv content", "content_id", tmdbId, "err", err)
+				return Content{}, errors.New("failed to cache content")
+			}
+		}
+	}
+	return content, nil
+}
+
 // Getting only region needed from api is not a feature yet
 // https://trello.com/c/75tR4cpF/106-add-watch-provider-region-filtering
 // When it is, this can be removed for that instead.
@@ -194,9 +250,9 @@ func transformProviders(c *interface{}, country string) {
 	}
 }
 
-func searchContent(query string) (TMDBSearchMultiResponse, error) {
+func searchContent(query string, language string) (TMDBSearchMultiResponse, error) {
 	resp := new(TMDBSearchMultiResponse)
-	err := tmdbRequest("/search/multi", map[string]string{"query": query, "page": "1"}, &resp)
+	err := tmdbRequest("/search/multi", map[string]string{"query": query, "page": "1", "language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete multi search request!", "error", err.Error())
 		return TMDBSearchMultiResponse{}, errors.New("failed to complete multi search request")
@@ -204,21 +260,27 @@ func searchContent(query string) (TMDBSearchMultiResponse, error) {
 	return *resp, nil
 }
 
-func movieDetails(db *gorm.DB, id string, country string, rParams map[string]string) (TMDBMovieDetails, error) {
+// `language` and `country` can be empty to use the servers defaults.
+func movieDetails(db *gorm.DB, id string, language string, country string, rParams map[string]string) (TMDBMovieDetails, error) {
 	resp := new(TMDBMovieDetails)
+	rParams["language"] = language
 	err := tmdbRequest("/movie/"+id, rParams, &resp)
 	if err != nil {
 		slog.Error("Failed to complete movie details request!", "error", err.Error())
 		return TMDBMovieDetails{}, errors.New("failed to complete movie details request")
 	}
+	enrichMovieDetails(resp, language)
 	transformProviders(&resp.WatchProviders, country)
-	go cacheContentMovie(db, *resp, true)
+	// Content in the db is kept in the servers language.
+	if language == "" || language == getServerLanguage() {
+		go cacheContentMovie(db, *resp, true)
+	}
 	return *resp, nil
 }
 
-func movieCredits(id string) (TMDBContentCredits, error) {
+func movieCredits(id string, language string) (TMDBContentCredits, error) {
 	resp := new(TMDBContentCredits)
-	err := tmdbRequest("/movie/"+id+"/credits", map[string]string{}, &resp)
+	err := tmdbRequest("/movie/"+id+"/credits", map[string]string{"language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete movie cast request!", "error", err.Error())
 		return TMDBContentCredits{}, errors.New("failed to complete movie cast request")
@@ -226,21 +288,27 @@ func movieCredits(id string) (TMDBContentCredits, error) {
 	return *resp, nil
 }
 
-func tvDetails(db *gorm.DB, id string, country string, rParams map[string]string) (TMDBShowDetails, error) {
+// `language` and `country` can be empty to use the servers defaults.
+func tvDetails(db *gorm.DB, id string, language string, country string, rParams map[string]string) (TMDBShowDetails, error) {
 	resp := new(TMDBShowDetails)
+	rParams["language"] = language
 	err := tmdbRequest("/tv/"+id, rParams, &resp)
 	if err != nil {
 		slog.Error("Failed to complete tv details request!", "error", err.Error())
 		return TMDBShowDetails{}, errors.New("failed to complete tv details request")
 	}
+	enrichShowDetails(resp, language)
 	transformProviders(&resp.WatchProviders, country)
-	go cacheContentTv(db, *resp, true)
+	// Content in the db is kept in the servers language.
+	if language == "" || language == getServerLanguage() {
+		go cacheContentTv(db, *resp, true)
+	}
 	return *resp, nil
 }
 
-func tvCredits(id string) (TMDBContentCredits, error) {
+func tvCredits(id string, language string) (TMDBContentCredits, error) {
 	resp := new(TMDBContentCredits)
-	err := tmdbRequest("/tv/"+id+"/credits", map[string]string{}, &resp)
+	err := tmdbRequest("/tv/"+id+"/credits", map[string]string{"language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete tv cast request!", "error", err.Error())
 		return TMDBContentCredits{}, errors.New("failed to complete tv cast request")
@@ -248,19 +316,48 @@ func tvCredits(id string) (TMDBContentCredits, error) {
 	return *resp, nil
 }
 
-func seasonDetails(tvId string, seasonNumber string) (TMDBSeasonDetails, error) {
+// Get the TVDB id of a show from its TMDB id.
+func getShowTvdbId(tmdbId int) (int, error) {
+	ids, err := tmdbMetadataProvider{}.ExternalIds(metadata.SHOW, metadata.ExternalIds{TmdbID: tmdbId})
+	if err != nil {
+		slog.Error("Failed to complete tv external ids request!", "tmdb_id", tmdbId, "error", err.Error())
+		return 0, errors.New("failed to complete tv external ids request")
+	}
+	if ids.TvdbID == 0 {
+		return 0, errors.New("show has no tvdb id")
+	}
+	return ids.TvdbID, nil
+}
+
+// Get the TMDB id of a show from its TVDB id.
+func findShowByTvdbId(tvdbId int) (int, error) {
+	id, err := tmdbMetadataProvider{}.getId(metadata.SHOW, metadata.ExternalIds{TvdbID: tvdbId})
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			return 0, errors.New("show not found")
+		}
+		slog.Error("Failed to complete find request!", "tvdb_id", tvdbId, "error", err.Error())
+		return 0, errors.New("failed to complete find request")
+	}
+	return id, nil
+}
+
+func seasonDetails(tvId string, seasonNumber string, language string) (TMDBSeasonDetails, error) {
 	resp := new(TMDBSeasonDetails)
-	err := tmdbRequest("/tv/"+tvId+"/season/"+seasonNumber, map[string]string{}, &resp)
+	err := tmdbRequest("/tv/"+tvId+"/season/"+seasonNumber, map[string]string{"language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete season details request!", "error", err.Error())
 		return TMDBSeasonDetails{}, errors.New("failed to complete season details request")
 	}
+	if id, err := strconv.Atoi(tvId); err == nil {
+		enrichSeasonDetails(id, resp, language)
+	}
 	return *resp, nil
 }
 
-func personDetails(id string) (TMDBPersonDetails, error) {
+func personDetails(id string, language string) (TMDBPersonDetails, error) {
 	resp := new(TMDBPersonDetails)
-	err := tmdbRequest("/person/"+id, map[string]string{}, &resp)
+	err := tmdbRequest("/person/"+id, map[string]string{"language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete person details request!", "error", err.Error())
 		return TMDBPersonDetails{}, errors.New("failed to complete person details request")
@@ -268,9 +365,9 @@ func personDetails(id string) (TMDBPersonDetails, error) {
 	return *resp, nil
 }
 
-func personCredits(id string) (TMDBPersonCombinedCredits, error) {
+func personCredits(id string, language string) (TMDBPersonCombinedCredits, error) {
 	resp := new(TMDBPersonCombinedCredits)
-	err := tmdbRequest("/person/"+id+"/combined_credits", map[string]string{}, &resp)
+	err := tmdbRequest("/person/"+id+"/combined_credits", map[string]string{"language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete person details request!", "error", err.Error())
 		return TMDBPersonCombinedCredits{}, errors.New("failed to complete person details request")
@@ -278,9 +375,12 @@ func personCredits(id string) (TMDBPersonCombinedCredits, error) {
 	return *resp, nil
 }
 
-func discoverMovies() (TMDBDiscoverMovies, error) {
+func discoverMovies(language string, country string, q DiscoverQuery) (TMDBDiscoverMovies, error) {
+	if err := q.validate(MOVIE); err != nil {
+		return TMDBDiscoverMovies{}, err
+	}
 	resp := new(TMDBDiscoverMovies)
-	err := tmdbRequest("/discover/movie", map[string]string{"page": "1"}, &resp)
+	err := tmdbRequest("/discover/movie", q.params(MOVIE, language, country), &resp)
 	if err != nil {
 		slog.Error("Failed to complete discover movies request!", "error", err.Error())
 		return TMDBDiscoverMovies{}, errors.New("failed to complete discover movies request")
@@ -288,9 +388,12 @@ func discoverMovies() (TMDBDiscoverMovies, error) {
 	return *resp, nil
 }
 
-func discoverTv() (TMDBDiscoverShows, error) {
+func discoverTv(language string, country string, q DiscoverQuery) (TMDBDiscoverShows, error) {
+	if err := q.validate(SHOW); err != nil {
+		return TMDBDiscoverShows{}, err
+	}
 	resp := new(TMDBDiscoverShows)
-	err := tmdbRequest("/discover/tv", map[string]string{"page": "1"}, &resp)
+	err := tmdbRequest("/discover/tv", q.params(SHOW, language, country), &resp)
 	if err != nil {
 		slog.Error("Failed to complete discover tv request!", "error", err.Error())
 		return TMDBDiscoverShows{}, errors.New("failed to complete discover tv request")
@@ -298,9 +401,13 @@ func discoverTv() (TMDBDiscoverShows, error) {
 	return *resp, nil
 }
 
-func allTrending() (TMDBTrendingAll, error) {
+func allTrending(language string, q DiscoverQuery) (TMDBTrendingAll, error) {
+	window := "day"
+	if q.Window != "" {
+		window = q.Window
+	}
 	resp := new(TMDBTrendingAll)
-	err := tmdbRequest("/trending/all/day", map[string]string{}, &resp)
+	err := tmdbRequest("/trending/all/"+window, map[string]string{"page": q.page(), "language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete all trending request!", "error", err.Error())
 		return TMDBTrendingAll{}, errors.New("failed to complete all trending request")
@@ -308,9 +415,9 @@ func allTrending() (TMDBTrendingAll, error) {
 	return *resp, nil
 }
 
-func upcomingMovies() (TMDBUpcomingMovies, error) {
+func upcomingMovies(language string, country string, q DiscoverQuery) (TMDBUpcomingMovies, error) {
 	resp := new(TMDBUpcomingMovies)
-	err := tmdbRequest("/movie/upcoming", map[string]string{"page": "1"}, &resp)
+	err := tmdbRequest("/movie/upcoming", map[string]string{"page": q.page(), "language": language, "region": country}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete upcoming movies request!", "error", err.Error())
 		return TMDBUpcomingMovies{}, errors.New("failed to complete upcoming movies request")
@@ -319,12 +426,12 @@ func upcomingMovies() (TMDBUpcomingMovies, error) {
 }
 
 // Theres no upcoming endpoint for tv ;( - using discover with future dates
-func upcomingTv() (TMDBUpcomingShows, error) {
+func upcomingTv(language string, q DiscoverQuery) (TMDBUpcomingShows, error) {
 	resp := new(TMDBUpcomingShows)
 	dFmt := "2006-01-02"
 	mind := time.Now().Format(dFmt)
 	maxd := time.Now().AddDate(0, 0, 15).Format(dFmt)
-	err := tmdbRequest("/discover/tv", map[string]string{"page": "1", "first_air_date.gte": mind, "first_air_date.lte": maxd, "sort_by": "popularity.desc", "with_type": "2|3"}, &resp)
+	err := tmdbRequest("/discover/tv", map[string]string{"page": q.page(), "first_air_date.gte": mind, "first_air_date.lte": maxd, "sort_by": "popularity.desc", "with_type": "2|3", "language": language}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete upcoming tv request!", "error", err.Error())
 		return TMDBUpcomingShows{}, errors.New("failed to complete upcoming tv request")
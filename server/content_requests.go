@@ -0,0 +1,437 @@
+// Content requests.
+// Users with PERM_REQUEST_CONTENT can request movies and shows, which
+// admins can approve (sending them to a sonarr/radarr server) or deny.
+// When Overseerr/Jellyseerr is the request backend, requests are sent
+// straight to it instead (see request_backend.go).
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+type ContentRequestStatus string
+
+var (
+	CONTENT_REQUEST_PENDING  ContentRequestStatus = "PENDING"
+	CONTENT_REQUEST_APPROVED ContentRequestStatus = "APPROVED"
+	CONTENT_REQUEST_DENIED   ContentRequestStatus = "DENIED"
+	// Backend failed to send the content on after approving it.
+	CONTENT_REQUEST_FAILED ContentRequestStatus = "FAILED"
+)
+
+// Availability of requested content, as reported by the request backend.
+type RequestMediaStatus string
+
+var (
+	REQUEST_MEDIA_UNKNOWN             RequestMediaStatus = "UNKNOWN"
+	REQUEST_MEDIA_PENDING             RequestMediaStatus = "PENDING"
+	REQUEST_MEDIA_PROCESSING          RequestMediaStatus = "PROCESSING"
+	REQUEST_MEDIA_PARTIALLY_AVAILABLE RequestMediaStatus = "PARTIALLY_AVAILABLE"
+	REQUEST_MEDIA_AVAILABLE           RequestMediaStatus = "AVAILABLE"
+)
+
+type ContentRequest struct {
+	GormModel
+	UserID    uint                 `gorm:"index;not null" json:"-"`
+	User      User                 `json:"-"`
+	ContentID int                  `gorm:"index;not null" json:"-"`
+	Content   Content              `json:"content"`
+	Status    ContentRequestStatus `gorm:"index;not null" json:"status"`
+	// Optional message from the requester.
+	Note string `json:"note,omitempty"`
+	// Admin that approved/denied the request.
+	ReviewedByID *uint      `json:"-"`
+	ReviewedAt   *time.Time `json:"reviewedAt,omitempty"`
+	// Optional reason for the decision, shown to the requester.
+	ReviewNote string `json:"reviewNote,omitempty"`
+	// Sonarr/Radarr server the content was sent to when approved.
+	ServerName string `json:"serverName,omitempty"`
+	// Download status, once approved.
+	Download *ArrDownload `gorm:"foreignKey:ContentRequestID" json:"download,omitempty"`
+	// Backend the request was made with, empty for requests from before backends.
+	Backend RequestBackendType `json:"backend,omitempty"`
+	// Id of the request in the backend, if it has its own (seerr).
+	BackendRequestID int `json:"-"`
+	// Set for backends that report availability (seerr).
+	MediaStatus RequestMediaStatus `json:"mediaStatus,omitempty"`
+	// User that made the request, only returned to admins.
+	Requester *PublicUser `gorm:"-" json:"requester,omitempty"`
+}
+
+type ContentRequestAddRequest struct {
+	// TMDB id of the content.
+	ContentID   int         `json:"contentId" binding:"required"`
+	ContentType ContentType `json:"contentType" binding:"required,oneof=movie tv"`
+	Note        string      `json:"note"`
+}
+
+type ContentRequestApproveRequest struct {
+	// Name of the sonarr (for shows) or radarr (for movies) server to send the content to.
+	ServerName string `json:"serverName" binding:"required"`
+	// Optional overrides of the servers defaults.
+	QualityProfile  int    `json:"qualityProfile"`
+	RootFolder      string `json:"rootFolder"` // path
+	LanguageProfile int    `json:"languageProfile"`
+	// Added to the servers tags.
+	Tags                []int  `json:"tags"`
+	MinimumAvailability string `json:"minimumAvailability" binding:"omitempty,oneof=announced inCinemas released"`
+	MonitorMode         string `json:"monitorMode" binding:"omitempty,oneof=all future firstSeason latestSeason"`
+	ReviewNote          string `json:"reviewNote"`
+}
+
+type ContentRequestDenyRequest struct {
+	ReviewNote string `json:"reviewNote"`
+}
+
+func getContentRequest(db *gorm.DB, id uint) (ContentRequest, error) {
+	var cr ContentRequest
+	if res := db.Preload("Content").Where("id = ?", id).Take(&cr); res.Error != nil {
+		slog.Error("getContentRequest: Failed to get request", "id", id, "error", res.Error)
+		return ContentRequest{}, errors.New("request not found")
+	}
+	return cr, nil
+}
+
+// Get the current users requests.
+func getUserContentRequests(db *gorm.DB, userId uint) ([]ContentRequest, error) {
+	requests := []ContentRequest{}
+	res := db.Preload("Content").Preload("Download").Where("user_id = ?", userId).Order("created_at DESC").Find(&requests)
+	if res.Error != nil {
+		slog.Error("getUserContentRequests: Failed to get requests", "user_id", userId, "error", res.Error)
+		return []ContentRequest{}, errors.New("failed to get requests")
+	}
+	return requests, nil
+}
+
+// Get all requests, optionally only ones with `status`.
+func getContentRequests(db *gorm.DB, status ContentRequestStatus) ([]ContentRequest, error) {
+	requests := []ContentRequest{}
+	q := db.Preload("Content").Preload("Download").Preload("User").Order("created_at DESC")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if res := q.Find(&requests); res.Error != nil {
+		slog.Error("getContentRequests: Failed to get requests", "error", res.Error)
+		return []ContentRequest{}, errors.New("failed to get requests")
+	}
+	for i, v := range requests {
+		if v.User.ID != 0 {
+			pu := v.User.GetSafe()
+			requests[i].Requester = &pu
+		}
+	}
+	return requests, nil
+}
+
+func addContentRequest(db *gorm.DB, userId uint, ar ContentRequestAddRequest) (ContentRequest, error) {
+	content, err := getOrCacheContent(db, ar.ContentType, ar.ContentID)
+	if err != nil {
+		return ContentRequest{}, err
+	}
+	// Only one open request per content, approved content is already on its way.
+	var existing int64
+	res := db.Model(&ContentRequest{}).
+		Where("content_id = ? AND status IN ?", content.ID, []ContentRequestStatus{CONTENT_REQUEST_PENDING, CONTENT_REQUEST_APPROVED}).
+		Count(&existing)
+	if res.Error != nil {
+		slog.Error("addContentRequest: Failed to check for existing requests", "error", res.Error)
+		return ContentRequest{}, errors.New("failed to add request")
+	}
+	if existing > 0 {
+		return ContentRequest{}, errors.New("this has already been requested")
+	}
+	cr := ContentRequest{UserID: userId, ContentID: content.ID, Content: content, Status: CONTENT_REQUEST_PENDING, Note: ar.Note}
+	backend := getRequestBackend()
+	if err := backend.Submit(db, &cr); err != nil {
+		return ContentRequest{}, err
+	}
+	if res := db.Omit("Content").Create(&cr); res.Error != nil {
+		slog.Error("addContentRequest: Failed to create request", "user_id", userId, "error", res.Error)
+		// Don't leave it in the backend, nobody would be able to cancel it.
+		if err := backend.Cancel(cr); err != nil {
+			slog.Error("addContentRequest: Failed to remove request from backend", "error", err)
+		}
+		return ContentRequest{}, errors.New("failed to add request")
+	}
+	slog.Info("addContentRequest: Content requested", "user_id", userId, "content_id", content.ID, "request_id", cr.ID)
+	return cr, nil
+}
+
+// Cancel one of the current users pending requests.
+func cancelContentRequest(db *gorm.DB, userId uint, id uint) error {
+	var cr ContentRequest
+	res := db.Where("id = ? AND user_id = ? AND status = ?", id, userId, CONTENT_REQUEST_PENDING).Take(&cr)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return errors.New("pending request not found")
+		}
+		slog.Error("cancelContentRequest: Failed to get request", "id", id, "user_id", userId, "error", res.Error)
+		return errors.New("failed to cancel request")
+	}
+	if err := getRequestBackendByType(cr.Backend).Cancel(cr); err != nil {
+		return err
+	}
+	if res := db.Delete(&cr); res.Error != nil {
+		slog.Error("cancelContentRequest: Failed to delete request", "id", id, "user_id", userId, "error", res.Error)
+		return errors.New("failed to cancel request")
+	}
+	return nil
+}
+
+// Make sure a request is one Watcharr admins can review.
+func ensureReviewable(cr ContentRequest) error {
+	if !getRequestBackendByType(cr.Backend).ReviewedInWatcharr() {
+		return errors.New("request must be reviewed in overseerr/jellyseerr")
+	}
+	if cr.Status != CONTENT_REQUEST_PENDING {
+		return errors.New("request has already been reviewed")
+	}
+	return nil
+}
+
+func approveContentRequest(db *gorm.DB, adminId uint, id uint, ar ContentRequestApproveRequest) (ContentRequest, error) {
+	cr, err := getContentRequest(db, id)
+	if err != nil {
+		return ContentRequest{}, err
+	}
+	if err := ensureReviewable(cr); err != nil {
+		return ContentRequest{}, err
+	}
+	// Claim the request before sending it anywhere, so two admins
+	// approving at once can't both add the content to their arr.
+	cr, err = reviewContentRequest(db, cr, adminId, CONTENT_REQUEST_APPROVED, ar.ReviewNote, ar.ServerName)
+	if err != nil {
+		return ContentRequest{}, err
+	}
+	var requester User
+	if res := db.Select("username").Where("id = ?", cr.UserID).Take(&requester); res.Error != nil {
+		slog.Error("approveContentRequest: Failed to get requester", "user_id", cr.UserID, "error", res.Error)
+	}
+	download, err := sendContentRequestToArr(cr.Content, ar, requester.Username)
+	if err != nil {
+		// Put it back so it can be approved again.
+		res := db.Model(&ContentRequest{}).Where("id = ?", cr.ID).Updates(map[string]interface{}{
+			"status":         CONTENT_REQUEST_PENDING,
+			"reviewed_by_id": nil,
+			"reviewed_at":    nil,
+			"review_note":    "",
+			"server_name":    "",
+		})
+		if res.Error != nil {
+			slog.Error("approveContentRequest: Failed to put request back to pending", "id", cr.ID, "error", res.Error)
+		}
+		return ContentRequest{}, err
+	}
+	download.UserID = cr.UserID
+	download.ContentRequestID = &cr.ID
+	trackArrDownload(db, download)
+	go notifyContentRequestStatus(db, cr)
+	return cr, nil
+}
+
+func denyContentRequest(db *gorm.DB, adminId uint, id uint, dr ContentRequestDenyRequest) (ContentRequest, error) {
+	cr, err := getContentRequest(db, id)
+	if err != nil {
+		return ContentRequest{}, err
+	}
+	if err := ensureReviewable(cr); err != nil {
+		return ContentRequest{}, err
+	}
+	cr, err = reviewContentRequest(db, cr, adminId, CONTENT_REQUEST_DENIED, dr.ReviewNote, "")
+	if err != nil {
+		return ContentRequest{}, err
+	}
+	go notifyContentRequestStatus(db, cr)
+	return cr, nil
+}
+
+// Save an admins decision on a request.
+// Only updates requests that are still pending, so if another admin
+// reviewed it first (even since `ensureReviewable`), this errors.
+func reviewContentRequest(db *gorm.DB, cr ContentRequest, adminId uint, status ContentRequestStatus, note string, serverName string) (ContentRequest, error) {
+	now := time.Now()
+	res := db.Model(&ContentRequest{}).Where("id = ? AND status = ?", cr.ID, CONTENT_REQUEST_PENDING).Updates(map[string]interface{}{
+		"status":         status,
+		"reviewed_by_id": adminId,
+		"reviewed_at":    now,
+		"review_note":    note,
+		"server_name":    serverName,
+	})
+	if res.Error != nil {
+		slog.Error("reviewContentRequest: Failed to update request", "id", cr.ID, "error", res.Error)
+		return ContentRequest{}, errors.New("failed to update request")
+	}
+	if res.RowsAffected == 0 {
+		return ContentRequest{}, errors.New("request has already been reviewed")
+	}
+	cr.Status = status
+	cr.ReviewedByID = &adminId
+	cr.ReviewedAt = &now
+	cr.ReviewNote = note
+	cr.ServerName = serverName
+	slog.Info("reviewContentRequest: Request reviewed", "id", cr.ID, "status", status, "by_user_id", adminId)
+	return cr, nil
+}
+
+// Email the requester about their requests new status,
+// if smtp is setup and they have an email.
+// Users can always see their requests status in Watcharr.
+func notifyContentRequestStatus(db *gorm.DB, cr ContentRequest) {
+	if !Config.SMTP.IsConfigured() {
+		return
+	}
+	var user User
+	if res := db.Select("id", "username", "email").Where("id = ?", cr.UserID).Take(&user); res.Error != nil {
+		slog.Error("notifyContentRequestStatus: Failed to get requester", "user_id", cr.UserID, "error", res.Error)
+		return
+	}
+	if user.Email == "" {
+		return
+	}
+	body := "Hi " + user.Username + ",\n\n"
+	if cr.Status == CONTENT_REQUEST_APPROVED {
+		body += "Your request for " + cr.Content.Title + " has been approved, it will be available once it has been downloaded."
+	} else {
+		body += "Your request for " + cr.Content.Title + " has been denied."
+	}
+	if cr.ReviewNote != "" {
+		body += "\n\nNote from the admin: " + cr.ReviewNote
+	}
+	if err := sendEmail(user.Email, "Watcharr request "+string(cr.Status), body); err != nil {
+		slog.Error("notifyContentRequestStatus: Failed to email requester", "user_id", cr.UserID, "error", err)
+	}
+}
+
+// Add requested content to the chosen sonarr/radarr server,
+// using the servers defaults for anything not overridden.
+// `requester` is the username of who requested it, for tagging.
+// Returns the download to track, without its user.
+func sendContentRequestToArr(content Content, ar ContentRequestApproveRequest, requester string) (ArrDownload, error) {
+	year := 0
+	if content.ReleaseDate != nil {
+		year = content.ReleaseDate.Year()
+	}
+	if content.Type == MOVIE {
+		server, err := getRadarr(ar.ServerName)
+		if err != nil {
+			return ArrDownload{}, err
+		}
+		radarr := server.client(arr.RADARR)
+		rr := arr.RadarrRequest{
+			ArrRequest: arr.ArrRequest{
+				ServerName:      server.Name,
+				QualityProfile:  ar.QualityProfile,
+				RootFolder:      ar.RootFolder,
+				AutomaticSearch: server.AutomaticSearch,
+				Title:           content.Title,
+				Year:            year,
+			},
+			TMDBID:              content.TmdbID,
+			MinimumAvailability: ar.MinimumAvailability,
+		}
+		if rr.QualityProfile == 0 {
+			rr.QualityProfile = server.QualityProfile
+		}
+		if rr.MinimumAvailability == "" {
+			rr.MinimumAvailability = server.MinimumAvailability
+		}
+		rr.Tags = getArrRequestTags(radarr, server.ArrSettings, ar.Tags, requester)
+		if rr.RootFolder == "" {
+			rr.RootFolder, err = getArrRootFolderPath(radarr, server.RootFolder)
+			if err != nil {
+				return ArrDownload{}, err
+			}
+		}
+		if err := ensureNotOnArr(radarr, server.Name, rr.TMDBID); err != nil {
+			return ArrDownload{}, err
+		}
+		arrId, err := radarr.AddContent(radarr.BuildAddMovieBody(rr))
+		if err != nil {
+			slog.Error("sendContentRequestToArr: Failed to add movie to radarr", "server", server.Name, "tmdb_id", content.TmdbID, "error", err)
+			return ArrDownload{}, errors.New("failed to add movie to radarr: " + err.Error())
+		}
+		return ArrDownload{ArrType: arr.RADARR, ServerName: server.Name, ArrID: arrId, Title: content.Title}, nil
+	}
+	server, err := getSonarr(ar.ServerName)
+	if err != nil {
+		return ArrDownload{}, err
+	}
+	show := new(TMDBShowDetails)
+	if err := tmdbRequest("/tv/"+strconv.Itoa(content.TmdbID), map[string]string{"append_to_response": "external_ids,keywords"}, &show); err != nil {
+		slog.Error("sendContentRequestToArr: Failed to get show details", "tmdb_id", content.TmdbID, "error", err)
+		return ArrDownload{}, errors.New("failed to get show details")
+	}
+	if show.ExternalIds.TvdbID == 0 {
+		return ArrDownload{}, errors.New("show has no tvdb id, sonarr needs one to add it")
+	}
+	// Monitor every season except specials.
+	seasons := []arr.SonarrSeasons{}
+	for _, s := range show.Seasons {
+		seasons = append(seasons, arr.SonarrSeasons{SeasonNumber: s.SeasonNumber, Monitored: s.SeasonNumber != 0})
+	}
+	sonarr := server.client(arr.SONARR)
+	sr := arr.SonarrRequest{
+		ArrRequest: arr.ArrRequest{
+			ServerName:      server.Name,
+			QualityProfile:  ar.QualityProfile,
+			RootFolder:      ar.RootFolder,
+			AutomaticSearch: server.AutomaticSearch,
+			Title:           content.Title,
+			Year:            year,
+		},
+		TVDBID:          show.ExternalIds.TvdbID,
+		LanguageProfile: ar.LanguageProfile,
+		SeriesType:      "standard",
+		Seasons:         seasons,
+		MonitorMode:     ar.MonitorMode,
+		IsAnime:         isAnimeShow(*show),
+	}
+	if sr.QualityProfile == 0 {
+		sr.QualityProfile = server.QualityProfile
+	}
+	if sr.MonitorMode == "" {
+		sr.MonitorMode = server.MonitorMode
+	}
+	sr.Tags = getArrRequestTags(sonarr, server.ArrSettings, ar.Tags, requester)
+	if sr.LanguageProfile == 0 {
+		sr.LanguageProfile = server.LanguageProfile
+	}
+	if sr.RootFolder == "" {
+		sr.RootFolder, err = getArrRootFolderPath(sonarr, server.RootFolder)
+		if err != nil {
+			return ArrDownload{}, err
+		}
+	}
+	if sr.IsAnime {
+		sr.Anime, err = getSonarrAnimeOptions(sonarr, server)
+		if err != nil {
+			return ArrDownload{}, err
+		}
+		// Admins overrides still win over the servers anime defaults.
+		if ar.QualityProfile != 0 {
+			sr.Anime.QualityProfile = ar.QualityProfile
+		}
+		if ar.LanguageProfile != 0 {
+			sr.Anime.LanguageProfile = ar.LanguageProfile
+		}
+		if ar.RootFolder != "" {
+			sr.Anime.RootFolder = ar.RootFolder
+		}
+	}
+	if err := ensureNotOnArr(sonarr, server.Name, sr.TVDBID); err != nil {
+		return ArrDownload{}, err
+	}
+	arrId, err := sonarr.AddContent(sonarr.BuildAddShowBody(sr))
+	if err != nil {
+		slog.Error("sendContentRequestToArr: Failed to add show to sonarr", "server", server.Name, "tmdb_id", content.TmdbID, "error", err)
+		return ArrDownload{}, errors.New("failed to add show to sonarr: " + err.Error())
+	}
+	return ArrDownload{ArrType: arr.SONARR, ServerName: server.Name, ArrID: arrId, Title: content.Title}, nil
+}
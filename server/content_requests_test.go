@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Db with a movie that a user has requested.
+func newContentRequestDB(t *testing.T) (*gorm.DB, ContentRequest) {
+	t.Helper()
+	db := newTestDB(t, &Image{}, &User{}, &Content{}, &ContentRequest{}, &ArrDownload{})
+	user := User{Username: "requester"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+	content := Content{TmdbID: 603, Title: "The Matrix", Type: MOVIE}
+	if err := db.Create(&content).Error; err != nil {
+		t.Fatal("failed to create content:", err)
+	}
+	cr := ContentRequest{UserID: user.ID, ContentID: content.ID, Status: CONTENT_REQUEST_PENDING}
+	if err := db.Create(&cr).Error; err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+	return db, cr
+}
+
+func TestReviewContentRequestOnlyOnce(t *testing.T) {
+	db, cr := newContentRequestDB(t)
+	// Both admins loaded the request while it was pending.
+	if _, err := reviewContentRequest(db, cr, 1, CONTENT_REQUEST_APPROVED, "", "radarr"); err != nil {
+		t.Fatal("first review failed:", err)
+	}
+	if _, err := reviewContentRequest(db, cr, 2, CONTENT_REQUEST_DENIED, "too late", ""); err == nil {
+		t.Error("second review succeeded")
+	}
+	got, err := getContentRequest(db, cr.ID)
+	if err != nil {
+		t.Fatal("getContentRequest() error:", err)
+	}
+	if got.Status != CONTENT_REQUEST_APPROVED || got.ReviewedByID == nil || *got.ReviewedByID != 1 {
+		t.Errorf("request = %s by %v, want %s by 1", got.Status, got.ReviewedByID, CONTENT_REQUEST_APPROVED)
+	}
+}
+
+func TestApproveContentRequestFailureRevertsClaim(t *testing.T) {
+	db, cr := newContentRequestDB(t)
+	old := Config.RADARR
+	Config.RADARR = nil
+	t.Cleanup(func() { Config.RADARR = old })
+
+	// No radarr servers, so sending it on fails after the request is claimed.
+	if _, err := approveContentRequest(db, 1, cr.ID, ContentRequestApproveRequest{ServerName: "radarr", ReviewNote: "enjoy"}); err == nil {
+		t.Fatal("approveContentRequest() succeeded without a radarr server")
+	}
+	got, err := getContentRequest(db, cr.ID)
+	if err != nil {
+		t.Fatal("getContentRequest() error:", err)
+	}
+	if got.Status != CONTENT_REQUEST_PENDING {
+		t.Errorf("status = %s, want %s", got.Status, CONTENT_REQUEST_PENDING)
+	}
+	if got.ReviewedByID != nil || got.ReviewedAt != nil || got.ReviewNote != "" || got.ServerName != "" {
+		t.Errorf("review wasn't cleared: %+v", got)
+	}
+	var downloads int64
+	db.Model(&ArrDownload{}).Count(&downloads)
+	if downloads != 0 {
+		t.Errorf("%d downloads tracked, want 0", downloads)
+	}
+	// It can still be reviewed.
+	if _, err := denyContentRequest(db, 2, cr.ID, ContentRequestDenyRequest{}); err != nil {
+		t.Error("request couldn't be reviewed again:", err)
+	}
+}
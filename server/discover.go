@@ -0,0 +1,179 @@
+// Discover, trending and upcoming content from TMDB, with filters and
+// optionally without content already on the users list.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Query params accepted by the discover, trending and upcoming routes.
+// Anything left empty isn't sent to TMDB, so their defaults are used.
+type DiscoverQuery struct {
+	Page int `form:"page" binding:"omitempty,min=1,max=500"`
+	// Comma (and) or pipe (or) separated TMDB genre ids.
+	Genres   string `form:"genres"`
+	YearFrom int    `form:"yearFrom" binding:"omitempty,min=1800,max=3000"`
+	YearTo   int    `form:"yearTo" binding:"omitempty,min=1800,max=3000"`
+	// Minimum vote average (0-10).
+	MinRating float64 `form:"minRating" binding:"omitempty,min=0,max=10"`
+	// Minimum vote count, stops content with a single 10/10 vote from showing.
+	MinVotes         int    `form:"minVotes" binding:"omitempty,min=0"`
+	OriginalLanguage string `form:"originalLanguage"`
+	// Pipe separated TMDB watch provider ids, in the users region.
+	Providers string `form:"providers"`
+	// In minutes.
+	RuntimeMin int    `form:"runtimeMin" binding:"omitempty,min=0"`
+	RuntimeMax int    `form:"runtimeMax" binding:"omitempty,min=0"`
+	SortBy     string `form:"sortBy"`
+	// Only for trending, `day` (default) or `week`.
+	Window string `form:"window" binding:"omitempty,oneof=day week"`
+	// Remove content already on the users list from results.
+	HideOnList bool `form:"hideOnList"`
+}
+
+var (
+	tmdbIdListRegex       = regexp.MustCompile(`^\d+([,|]\d+)*$`)
+	originalLanguageRegex = regexp.MustCompile(`^[a-z]{2}$`)
+	discoverSortBy        = map[ContentType][]string{
+		MOVIE: {"popularity", "vote_average", "vote_count", "primary_release_date", "revenue", "title"},
+		SHOW:  {"popularity", "vote_average", "vote_count", "first_air_date", "name"},
+	}
+)
+
+func (q *DiscoverQuery) validate(t ContentType) error {
+	if q.Genres != "" && !tmdbIdListRegex.MatchString(q.Genres) {
+		return errors.New("invalid genres")
+	}
+	if q.Providers != "" && !tmdbIdListRegex.MatchString(q.Providers) {
+		return errors.New("invalid providers")
+	}
+	if q.OriginalLanguage != "" && !originalLanguageRegex.MatchString(q.OriginalLanguage) {
+		return errors.New("invalid original language")
+	}
+	if q.YearFrom != 0 && q.YearTo != 0 && q.YearFrom > q.YearTo {
+		return errors.New("yearFrom can't be after yearTo")
+	}
+	if q.RuntimeMax != 0 && q.RuntimeMin > q.RuntimeMax {
+		return errors.New("runtimeMin can't be more than runtimeMax")
+	}
+	if q.SortBy != "" && t != "" {
+		for _, s := range discoverSortBy[t] {
+			if q.SortBy == s+".asc" || q.SortBy == s+".desc" {
+				return nil
+			}
+		}
+		return errors.New("invalid sortBy")
+	}
+	return nil
+}
+
+// Page to request, TMDB pages start at 1.
+func (q *DiscoverQuery) page() string {
+	if q.Page < 1 {
+		return "1"
+	}
+	return strconv.Itoa(q.Page)
+}
+
+// Build the params for a TMDB discover request of content type `t`.
+func (q *DiscoverQuery) params(t ContentType, language string, country string) map[string]string {
+	p := map[string]string{"page": q.page(), "language": language}
+	dateField := "primary_release_date"
+	if t == SHOW {
+		dateField = "first_air_date"
+	}
+	if q.Genres != "" {
+		p["with_genres"] = q.Genres
+	}
+	if q.YearFrom != 0 {
+		p[dateField+".gte"] = strconv.Itoa(q.YearFrom) + "-01-01"
+	}
+	if q.YearTo != 0 {
+		p[dateField+".lte"] = strconv.Itoa(q.YearTo) + "-12-31"
+	}
+	if q.MinRating != 0 {
+		p["vote_average.gte"] = strconv.FormatFloat(q.MinRating, 'f', -1, 64)
+	}
+	if q.MinVotes != 0 {
+		p["vote_count.gte"] = strconv.Itoa(q.MinVotes)
+	}
+	if q.OriginalLanguage != "" {
+		p["with_original_language"] = q.OriginalLanguage
+	}
+	if q.Providers != "" {
+		p["with_watch_providers"] = q.Providers
+		p["watch_region"] = country
+	}
+	if q.RuntimeMin != 0 {
+		p["with_runtime.gte"] = strconv.Itoa(q.RuntimeMin)
+	}
+	if q.RuntimeMax != 0 {
+		p["with_runtime.lte"] = strconv.Itoa(q.RuntimeMax)
+	}
+	if q.SortBy != "" {
+		p["sort_by"] = q.SortBy
+	}
+	return p
+}
+
+// Get tmdb ids of all content of type `t` on a users list.
+func getOnListTmdbIds(db *gorm.DB, userId uint, t ContentType) (map[int]bool, error) {
+	var ids []int
+	res := db.Model(&Watched{}).
+		Joins("JOIN contents ON contents.id = watcheds.content_id").
+		Where("watcheds.user_id = ? AND contents.type = ?", userId, t).
+		Pluck("contents.tmdb_id", &ids)
+	if res.Error != nil {
+		slog.Error("getOnListTmdbIds: Failed to get users list content", "user_id", userId, "error", res.Error)
+		return nil, errors.New("failed to get content on your list")
+	}
+	onList := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		onList[id] = true
+	}
+	return onList, nil
+}
+
+// Remove the results that `hide` returns true for, by their index
+// (TMDB results are anonymous structs, so can't be passed by type).
+// Results are removed after TMDB has paged them, so pages can come back
+// with less than 20 results. Page and total counts are left as TMDB gave them.
+func hideResults[T any](results []T, hide func(i int) bool) []T {
+	kept := make([]T, 0, len(results))
+	for i, v := range results {
+		if !hide(i) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (r *TMDBDiscoverMovies) hideOnList(onList map[int]bool) {
+	r.Results = hideResults(r.Results, func(i int) bool { return onList[r.Results[i].ID] })
+}
+
+func (r *TMDBDiscoverShows) hideOnList(onList map[int]bool) {
+	r.Results = hideResults(r.Results, func(i int) bool { return onList[r.Results[i].ID] })
+}
+
+func (r *TMDBUpcomingMovies) hideOnList(onList map[int]bool) {
+	r.Results = hideResults(r.Results, func(i int) bool { return onList[r.Results[i].ID] })
+}
+
+func (r *TMDBUpcomingShows) hideOnList(onList map[int]bool) {
+	r.Results = hideResults(r.Results, func(i int) bool { return onList[r.Results[i].ID] })
+}
+
+// Trending is mixed, so needs both movies and shows on the users list.
+func (r *TMDBTrendingAll) hideOnList(movies map[int]bool, shows map[int]bool) {
+	r.Results = hideResults(r.Results, func(i int) bool {
+		v := r.Results[i]
+		return (v.MediaType == string(MOVIE) && movies[v.ID]) || (v.MediaType == string(SHOW) && shows[v.ID])
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverQueryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       DiscoverQuery
+		t       ContentType
+		wantErr string
+	}{
+		{"empty", DiscoverQuery{}, MOVIE, ""},
+		{"single genre", DiscoverQuery{Genres: "28"}, MOVIE, ""},
+		{"and genres", DiscoverQuery{Genres: "28,12"}, MOVIE, ""},
+		{"or genres", DiscoverQuery{Genres: "28|12"}, MOVIE, ""},
+		{"mixed genres", DiscoverQuery{Genres: "28,12|16"}, MOVIE, ""},
+		{"genre name", DiscoverQuery{Genres: "action"}, MOVIE, "invalid genres"},
+		{"trailing genre separator", DiscoverQuery{Genres: "28,"}, MOVIE, "invalid genres"},
+		{"genres with params injected", DiscoverQuery{Genres: "28&api_key=x"}, MOVIE, "invalid genres"},
+		{"providers", DiscoverQuery{Providers: "8|337"}, SHOW, ""},
+		{"invalid providers", DiscoverQuery{Providers: "netflix"}, SHOW, "invalid providers"},
+		{"original language", DiscoverQuery{OriginalLanguage: "ja"}, MOVIE, ""},
+		{"original language with region", DiscoverQuery{OriginalLanguage: "ja-JP"}, MOVIE, "invalid original language"},
+		{"uppercase original language", DiscoverQuery{OriginalLanguage: "JA"}, MOVIE, "invalid original language"},
+		{"year range", DiscoverQuery{YearFrom: 1990, YearTo: 2000}, MOVIE, ""},
+		{"same year", DiscoverQuery{YearFrom: 2000, YearTo: 2000}, MOVIE, ""},
+		{"only year from", DiscoverQuery{YearFrom: 2000}, MOVIE, ""},
+		{"backwards year range", DiscoverQuery{YearFrom: 2000, YearTo: 1990}, MOVIE, "yearFrom can't be after yearTo"},
+		{"runtime range", DiscoverQuery{RuntimeMin: 60, RuntimeMax: 120}, MOVIE, ""},
+		{"only runtime min", DiscoverQuery{RuntimeMin: 60}, MOVIE, ""},
+		{"backwards runtime range", DiscoverQuery{RuntimeMin: 120, RuntimeMax: 60}, MOVIE, "runtimeMin can't be more than runtimeMax"},
+		{"movie sort", DiscoverQuery{SortBy: "primary_release_date.desc"}, MOVIE, ""},
+		{"show sort", DiscoverQuery{SortBy: "first_air_date.asc"}, SHOW, ""},
+		{"show sort for movies", DiscoverQuery{SortBy: "first_air_date.asc"}, MOVIE, "invalid sortBy"},
+		{"sort without direction", DiscoverQuery{SortBy: "popularity"}, MOVIE, "invalid sortBy"},
+		{"unknown sort", DiscoverQuery{SortBy: "budget.desc"}, MOVIE, "invalid sortBy"},
+		// Trending and upcoming don't sort, so aren't checked.
+		{"sort without content type", DiscoverQuery{SortBy: "anything"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.validate(tt.t)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("validate() error = %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscoverQueryParams(t *testing.T) {
+	tests := []struct {
+		name string
+		q    DiscoverQuery
+		t    ContentType
+		want map[string]string
+	}{
+		{
+			name: "defaults",
+			q:    DiscoverQuery{},
+			t:    MOVIE,
+			want: map[string]string{"page": "1", "language": "en-US"},
+		},
+		{
+			name: "page",
+			q:    DiscoverQuery{Page: 3},
+			t:    MOVIE,
+			want: map[string]string{"page": "3", "language": "en-US"},
+		},
+		{
+			name: "movie years use release date",
+			q:    DiscoverQuery{YearFrom: 1990, YearTo: 1999},
+			t:    MOVIE,
+			want: map[string]string{"page": "1", "language": "en-US", "primary_release_date.gte": "1990-01-01", "primary_release_date.lte": "1999-12-31"},
+		},
+		{
+			name: "show years use first air date",
+			q:    DiscoverQuery{YearFrom: 2010},
+			t:    SHOW,
+			want: map[string]string{"page": "1", "language": "en-US", "first_air_date.gte": "2010-01-01"},
+		},
+		{
+			name: "providers are in the users country",
+			q:    DiscoverQuery{Providers: "8|337"},
+			t:    SHOW,
+			want: map[string]string{"page": "1", "language": "en-US", "with_watch_providers": "8|337", "watch_region": "US"},
+		},
+		{
+			name: "everything",
+			q: DiscoverQuery{
+				Genres:           "28,12",
+				MinRating:        7.5,
+				MinVotes:         100,
+				OriginalLanguage: "ko",
+				RuntimeMin:       60,
+				RuntimeMax:       150,
+				SortBy:           "vote_average.desc",
+				// Not sent to TMDB.
+				Window:     "week",
+				HideOnList: true,
+			},
+			t: MOVIE,
+			want: map[string]string{
+				"page":                   "1",
+				"language":               "en-US",
+				"with_genres":            "28,12",
+				"vote_average.gte":       "7.5",
+				"vote_count.gte":         "100",
+				"with_original_language": "ko",
+				"with_runtime.gte":       "60",
+				"with_runtime.lte":       "150",
+				"sort_by":                "vote_average.desc",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.q.params(tt.t, "en-US", "US")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("params() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHideResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []int
+		hide    map[int]bool
+		want    []int
+	}{
+		{"nothing hidden", []int{1, 2, 3}, map[int]bool{}, []int{1, 2, 3}},
+		{"some hidden", []int{1, 2, 3, 4}, map[int]bool{2: true, 4: true}, []int{1, 3}},
+		{"all hidden", []int{1, 2}, map[int]bool{1: true, 2: true}, []int{}},
+		{"no results", []int{}, map[int]bool{1: true}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hideResults(tt.results, func(i int) bool { return tt.hide[tt.results[i]] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hideResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Sending emails via a configured SMTP server.
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SMTPSettings struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Address emails are sent from (eg watcharr@example.com).
+	From string `json:"from,omitempty"`
+}
+
+// If enough smtp config has been provided to send emails.
+func (s *SMTPSettings) IsConfigured() bool {
+	return s.Host != "" && s.Port != 0 && s.From != ""
+}
+
+func saveSMTPConfig(s SMTPSettings) error {
+	if s.Host != "" && (s.Port <= 0 || s.Port > 65535) {
+		return errors.New("invalid port")
+	}
+	if strings.ContainsAny(s.From, "\r\n") {
+		return errors.New("invalid from address")
+	}
+	Config.SMTP = s
+	err := writeConfig()
+	if err != nil {
+		slog.Error("saveSMTPConfig failed to write config", "error", err)
+		return errors.New("failed to save config")
+	}
+	return nil
+}
+
+// Send a plain text email.
+func sendEmail(to string, subject string, body string) error {
+	s := Config.SMTP
+	if !s.IsConfigured() {
+		return errors.New("smtp not configured")
+	}
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var err error
+	if s.Port == 465 {
+		// Implicit TLS, which smtp.SendMail doesn't support.
+		err = sendEmailTLS(addr, auth, s.From, to, []byte(msg))
+	} else {
+		// Uses STARTTLS if the server supports it.
+		err = smtp.SendMail(addr, auth, s.From, []string{to}, []byte(msg))
+	}
+	if err != nil {
+		slog.Error("sendEmail: Failed to send email", "to", to, "error", err)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	slog.Debug("sendEmail: Email sent", "to", to, "subject", subject)
+	return nil
+}
+
+func sendEmailTLS(addr string, auth smtp.Auth, from string, to string, msg []byte) error {
+	host, _, _ := net.SplitHostPort(addr)
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -119,7 +119,7 @@ func (i *IGDB) refreshToken(ctx context.Context) {
 			slog.Info("IGDB refreshToken: Token expired (or is near expiry date)")
 			r, err := i.getNewAccessToken()
 			if err != nil {
-				slog.Error("IGDB refreshToken: Error refreshing token (retrying in 60s):", err)
+				slog.Error("IGDB refreshToken: Error refreshing token (retrying in 60s)", "error", err)
 				exp = time.After(60 * time.Second)
 			} else {
 				slog.Info("IGDB refreshToken: Token successfully refreshed")
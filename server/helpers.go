@@ -14,3 +14,13 @@ func generateString(len int) (string, error) {
 	}
 	return b64.StdEncoding.EncodeToString([]byte(key)), nil
 }
+
+// Generate a random string that is safe to use in urls.
+func generateURLSafeString(len int) (string, error) {
+	key := make([]byte, len)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return b64.RawURLEncoding.EncodeToString(key), nil
+}
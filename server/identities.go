@@ -0,0 +1,484 @@
+// Auth identities (Watcharr, Jellyfin, Plex, Emby) linked to a user.
+// A user can login with any of their identities, one of each type.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	// Which auth service this identity is from.
+	Type UserType `gorm:"uniqueIndex:idnt_type_to_tp_id;not null" json:"type"`
+	// ID of user in the auth service, used for lookup at signin.
+	// For Watcharr identities, this is the username they login with.
+	ThirdPartyID string `gorm:"uniqueIndex:idnt_type_to_tp_id;not null" json:"-"`
+	// Auth token from the auth service (jellyfin/plex/emby).
+	ThirdPartyAuth string `json:"-"`
+	// Username in the auth service.
+	Username string `json:"username"`
+}
+
+type LinkWatcharrIdentityRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UserMergeRequest struct {
+	// User whose data will be moved, this user is removed afterwards.
+	SourceUserID uint `json:"sourceUserId" binding:"required"`
+	// User that will receive the source users data.
+	TargetUserID uint `json:"targetUserId" binding:"required"`
+}
+
+func (t UserType) String() string {
+	switch t {
+	case WATCHARR_USER:
+		return "watcharr"
+	case JELLYFIN_USER:
+		return "jellyfin"
+	case PLEX_USER:
+		return "plex"
+	case EMBY_USER:
+		return "emby"
+	}
+	return "unknown"
+}
+
+// Create identities for users from before identities were separate,
+// from the third party columns that used to be on the users table.
+// Those columns are dropped afterwards. Safe to run again if dropping
+// them failed, identities that already exist are left alone.
+func migrateUserIdentities(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&User{}, "third_party_id") {
+		return nil
+	}
+	type legacyUser struct {
+		ID             uint
+		Username       string
+		Type           UserType
+		ThirdPartyID   string
+		ThirdPartyAuth string
+	}
+	var users []legacyUser
+	res := db.Raw("SELECT id, username, type, third_party_id, third_party_auth FROM users WHERE deleted_at IS NULL").Scan(&users)
+	if res.Error != nil {
+		return res.Error
+	}
+	slog.Info("migrateUserIdentities: Moving user auth details into identities", "amount", len(users))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, u := range users {
+			i := UserIdentity{
+				UserID:         u.ID,
+				Type:           u.Type,
+				ThirdPartyID:   u.ThirdPartyID,
+				ThirdPartyAuth: u.ThirdPartyAuth,
+				Username:       u.Username,
+			}
+			if u.Type == WATCHARR_USER {
+				i.ThirdPartyID = u.Username
+			}
+			if i.ThirdPartyID == "" {
+				// Nothing to look them up by at login, they will have to be
+				// linked to their account again by an admin (or merged).
+				slog.Warn("migrateUserIdentities: User has no third party id, they will be unable to login until an identity is linked", "user_id", u.ID, "username", u.Username, "type", u.Type.String())
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&i).Error; err != nil {
+				return err
+			}
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.Migrator().DropColumn(&User{}, "third_party_id"); err != nil {
+		return err
+	}
+	if err := db.Migrator().DropColumn(&User{}, "third_party_auth"); err != nil {
+		return err
+	}
+	// Sqlite recreates the table to drop columns, which loses its indexes.
+	return db.AutoMigrate(&User{})
+}
+
+func getUserIdentities(db *gorm.DB, userId uint) ([]UserIdentity, error) {
+	identities := []UserIdentity{}
+	if res := db.Where("user_id = ?", userId).Find(&identities); res.Error != nil {
+		slog.Error("getUserIdentities: Failed to get identities", "user_id", userId, "error", res.Error)
+		return []UserIdentity{}, errors.New("failed to get identities")
+	}
+	return identities, nil
+}
+
+// Get a users identity of type `t`.
+func getUserIdentity(db *gorm.DB, userId uint, t UserType) (UserIdentity, error) {
+	var i UserIdentity
+	if res := db.Where("user_id = ? AND type = ?", userId, t).Take(&i); res.Error != nil {
+		return UserIdentity{}, res.Error
+	}
+	return i, nil
+}
+
+// If a user can login with a Watcharr username and password.
+func userHasPassword(db *gorm.DB, userId uint) bool {
+	_, err := getUserIdentity(db, userId, WATCHARR_USER)
+	return err == nil
+}
+
+// Get the user that owns an identity.
+func getIdentityUser(db *gorm.DB, t UserType, thirdPartyId string) (User, UserIdentity, error) {
+	var i UserIdentity
+	if res := db.Where("type = ? AND third_party_id = ?", t, thirdPartyId).Take(&i); res.Error != nil {
+		return User{}, UserIdentity{}, res.Error
+	}
+	var user User
+	if res := db.Where("id = ?", i.UserID).Take(&user); res.Error != nil {
+		return User{}, UserIdentity{}, res.Error
+	}
+	return user, i, nil
+}
+
+// Get the user an identity belongs to (updating the identities auth token),
+// or create a new user for it if we haven't seen it before.
+// `beforeCreate` is ran before a new user is created, return an error to stop it.
+func getOrCreateIdentityUser(db *gorm.DB, t UserType, thirdPartyId string, thirdPartyAuth string, username string, beforeCreate func() error) (User, error) {
+	user, i, err := getIdentityUser(db, t, thirdPartyId)
+	if err == nil {
+		if thirdPartyAuth != "" && thirdPartyAuth != i.ThirdPartyAuth {
+			slog.Debug("getOrCreateIdentityUser: Updating identity with new access token", "type", t, "user_id", user.ID)
+			if err := db.Model(&i).Update("third_party_auth", thirdPartyAuth).Error; err != nil {
+				slog.Error("getOrCreateIdentityUser: Failed to update identity access token", "error", err)
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Error("getOrCreateIdentityUser: Failed to select identity from database", "type", t, "error", err)
+		return User{}, errors.New("error locating user in db")
+	}
+	if beforeCreate != nil {
+		if err := beforeCreate(); err != nil {
+			return User{}, err
+		}
+	}
+	slog.Debug("getOrCreateIdentityUser: New identity.. creating Watcharr account now.", "type", t)
+	user = User{Username: username, Type: t}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		i := UserIdentity{UserID: user.ID, Type: t, ThirdPartyID: thirdPartyId, ThirdPartyAuth: thirdPartyAuth, Username: username}
+		if err := tx.Create(&i).Error; err != nil {
+			return err
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		slog.Error("getOrCreateIdentityUser: Failed to create new user", "type", t, "error", err)
+		return User{}, errors.New("failed to create new user from " + t.String())
+	}
+	return user, nil
+}
+
+// Link a new identity to a user.
+func linkIdentity(db *gorm.DB, i UserIdentity) error {
+	if _, err := getUserIdentity(db, i.UserID, i.Type); err == nil {
+		return errors.New("you already have a " + i.Type.String() + " account linked")
+	}
+	if res := db.Create(&i); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrDuplicatedKey) {
+			return errors.New("this " + i.Type.String() + " account is already linked to another user, ask an admin to merge your accounts")
+		}
+		slog.Error("linkIdentity: Failed to create identity", "user_id", i.UserID, "type", i.Type, "error", res.Error)
+		return errors.New("failed to link account")
+	}
+	slog.Info("linkIdentity: Identity linked to user", "user_id", i.UserID, "type", i.Type)
+	return nil
+}
+
+// Add a Watcharr username and password login to a user.
+func linkWatcharrIdentity(db *gorm.DB, userId uint, lr LinkWatcharrIdentityRequest) (UserIdentity, error) {
+	if userHasPassword(db, userId) {
+		return UserIdentity{}, errors.New("you already have a watcharr login")
+	}
+	hash, err := hashPassword(lr.Password, GetPassArgonParams())
+	if err != nil {
+		slog.Error("linkWatcharrIdentity: Failed to hash password", "user_id", userId, "error", err)
+		return UserIdentity{}, errors.New("failed to hash password")
+	}
+	if _, _, err := getIdentityUser(db, WATCHARR_USER, lr.Username); err == nil {
+		return UserIdentity{}, errors.New("username already taken")
+	}
+	i := UserIdentity{UserID: userId, Type: WATCHARR_USER, ThirdPartyID: lr.Username, Username: lr.Username}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := linkIdentity(tx, i); err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("password", hash).Error; err != nil {
+			slog.Error("linkWatcharrIdentity: Failed to set password", "user_id", userId, "error", err)
+			return errors.New("failed to set password")
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		return UserIdentity{}, err
+	}
+	return getUserIdentity(db, userId, WATCHARR_USER)
+}
+
+// Link the media server (jellyfin/emby) account with the provided credentials to a user.
+func linkMediaServerIdentity(db *gorm.DB, s MediaServer, userId uint, ja JellyfinAuth) (UserIdentity, error) {
+	resp, err := authenticateMediaServer(s, ja.Username, ja.Pw)
+	if err != nil {
+		return UserIdentity{}, err
+	}
+	i := UserIdentity{UserID: userId, Type: s.UserType, ThirdPartyID: resp.User.ID, ThirdPartyAuth: resp.AccessToken, Username: resp.User.Name}
+	if err := linkIdentity(db, i); err != nil {
+		return UserIdentity{}, err
+	}
+	return getUserIdentity(db, userId, s.UserType)
+}
+
+// Link the Plex account for the provided auth token to a user.
+func linkPlexIdentity(db *gorm.DB, userId uint, lr PlexLoginRequest) (UserIdentity, error) {
+	account, err := getPlexAccount(lr.AuthToken)
+	if err != nil {
+		return UserIdentity{}, err
+	}
+	if err := plexUserHasAccessToPlexHost(lr.AuthToken); err != nil {
+		slog.Error("linkPlexIdentity: Failed to verify user has access to our home plex server.", "error", err)
+		return UserIdentity{}, errors.New("failed to verify plex access")
+	}
+	i := UserIdentity{UserID: userId, Type: PLEX_USER, ThirdPartyID: strconv.FormatUint(account.Id, 10), ThirdPartyAuth: lr.AuthToken, Username: account.Username}
+	if err := linkIdentity(db, i); err != nil {
+		return UserIdentity{}, err
+	}
+	return getUserIdentity(db, userId, PLEX_USER)
+}
+
+// Remove an identity from a user.
+// Users must always be left with at least one identity to login with.
+func unlinkIdentity(db *gorm.DB, userId uint, identityId uint) error {
+	identities, err := getUserIdentities(db, userId)
+	if err != nil {
+		return err
+	}
+	var identity *UserIdentity
+	for _, v := range identities {
+		if v.ID == identityId {
+			identity = &v
+			break
+		}
+	}
+	if identity == nil {
+		return errors.New("identity not found")
+	}
+	if len(identities) <= 1 {
+		return errors.New("you can't unlink your only login")
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&UserIdentity{}, identity.ID).Error; err != nil {
+			return err
+		}
+		// Password is only used by the watcharr identity.
+		if identity.Type == WATCHARR_USER {
+			if err := tx.Model(&User{}).Where("id = ?", userId).Update("password", "").Error; err != nil {
+				return err
+			}
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		slog.Error("unlinkIdentity: Failed to unlink identity", "user_id", userId, "identity_id", identityId, "error", err)
+		return errors.New("failed to unlink account")
+	}
+	slog.Info("unlinkIdentity: Identity unlinked from user", "user_id", userId, "type", identity.Type)
+	return nil
+}
+
+// Merge the source user into the target user.
+// The source users identities, watched list and follows are moved to
+// the target user, then the source user is removed.
+// When both users have watched the same content, the target users
+// watched item is kept and the source users activity is added to it.
+func mergeUsers(db *gorm.DB, mr UserMergeRequest) error {
+	sourceId, targetId := mr.SourceUserID, mr.TargetUserID
+	if sourceId == targetId {
+		return errors.New("can't merge a user into itself")
+	}
+	source, err := getUserForAdmin(db, sourceId)
+	if err != nil {
+		return err
+	}
+	if _, err := getUserForAdmin(db, targetId); err != nil {
+		return err
+	}
+	sourceIdentities, err := getUserIdentities(db, sourceId)
+	if err != nil {
+		return err
+	}
+	sourceHasPassword := false
+	for _, v := range sourceIdentities {
+		if _, err := getUserIdentity(db, targetId, v.Type); err == nil {
+			return errors.New("both users have a " + v.Type.String() + " account linked, unlink one first")
+		}
+		if v.Type == WATCHARR_USER {
+			sourceHasPassword = true
+		}
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&UserIdentity{}).Where("user_id = ?", sourceId).Update("user_id", targetId).Error; err != nil {
+			return err
+		}
+		// Bring the sources password along with their watcharr login.
+		if sourceHasPassword {
+			if err := tx.Model(&User{}).Where("id = ?", targetId).Update("password", source.Password).Error; err != nil {
+				return err
+			}
+		}
+		if err := mergeWatched(tx, sourceId, targetId); err != nil {
+			return err
+		}
+		if err := mergeFollows(tx, sourceId, targetId); err != nil {
+			return err
+		}
+		for _, m := range []any{&ContentRequest{}, &ArrDownload{}} {
+			if err := tx.Unscoped().Model(m).Where("user_id = ?", sourceId).Update("user_id", targetId).Error; err != nil {
+				return err
+			}
+		}
+		return purgeUser(tx, sourceId)
+	})
+	if err != nil {
+		slog.Error("mergeUsers: Failed to merge users", "source_user_id", sourceId, "target_user_id", targetId, "error", err)
+		return errors.New("failed to merge users")
+	}
+	slog.Info("mergeUsers: Users merged", "source_user_id", sourceId, "target_user_id", targetId)
+	return nil
+}
+
+func mergeWatched(tx *gorm.DB, sourceId uint, targetId uint) error {
+	var sourceWatched []Watched
+	if err := tx.Where("user_id = ?", sourceId).Find(&sourceWatched).Error; err != nil {
+		return err
+	}
+	for _, sw := range sourceWatched {
+		var tw Watched
+		err := gorm.ErrRecordNotFound
+		if sw.ContentID != nil {
+			err = tx.Unscoped().Where("user_id = ? AND content_id = ?", targetId, *sw.ContentID).Take(&tw).Error
+		} else if sw.GameID != nil {
+			err = tx.Unscoped().Where("user_id = ? AND game_id = ?", targetId, *sw.GameID).Take(&tw).Error
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// Targets removed watched items are in the way of the unique index, clear them out.
+		if err == nil && tw.DeletedAt.Valid {
+			if err := purgeWatchedItem(tx, tw.ID); err != nil {
+				return err
+			}
+			err = gorm.ErrRecordNotFound
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Target hasn't watched this, move the whole item over.
+			if err := tx.Model(&Watched{}).Where("id = ?", sw.ID).Update("user_id", targetId).Error; err != nil {
+				return err
+			}
+			for _, m := range []any{&Activity{}, &WatchedSeason{}, &WatchedEpisode{}} {
+				if err := tx.Unscoped().Model(m).Where("watched_id = ?", sw.ID).Update("user_id", targetId).Error; err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// Both watched it, keep the targets item but bring over the sources history.
+		if err := tx.Unscoped().Model(&Activity{}).Where("watched_id = ?", sw.ID).Updates(map[string]interface{}{"watched_id": tw.ID, "user_id": targetId}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Model(&WatchedSeason{}).
+			Where("watched_id = ? AND season_number NOT IN (?)", sw.ID, tx.Unscoped().Model(&WatchedSeason{}).Select("season_number").Where("watched_id = ?", tw.ID)).
+			Updates(map[string]interface{}{"watched_id": tw.ID, "user_id": targetId})
+		if res.Error != nil {
+			return res.Error
+		}
+		var targetEpisodes []WatchedEpisode
+		if err := tx.Unscoped().Where("watched_id = ?", tw.ID).Find(&targetEpisodes).Error; err != nil {
+			return err
+		}
+		var sourceEpisodes []WatchedEpisode
+		if err := tx.Unscoped().Where("watched_id = ?", sw.ID).Find(&sourceEpisodes).Error; err != nil {
+			return err
+		}
+	episodeLoop:
+		for _, se := range sourceEpisodes {
+			for _, te := range targetEpisodes {
+				if se.SeasonNumber == te.SeasonNumber && se.EpisodeNumber == te.EpisodeNumber {
+					continue episodeLoop
+				}
+			}
+			if err := tx.Unscoped().Model(&WatchedEpisode{}).Where("id = ?", se.ID).Updates(map[string]interface{}{"watched_id": tw.ID, "user_id": targetId}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Hard delete a watched item and everything attached to it.
+func purgeWatchedItem(tx *gorm.DB, watchedId uint) error {
+	for _, m := range []any{&Activity{}, &WatchedSeason{}, &WatchedEpisode{}} {
+		if err := tx.Unscoped().Where("watched_id = ?", watchedId).Delete(m).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("id = ?", watchedId).Delete(&Watched{}).Error
+}
+
+func mergeFollows(tx *gorm.DB, sourceId uint, targetId uint) error {
+	var follows []Follow
+	if err := tx.Where("user_id = ? OR followed_user_id = ?", sourceId, sourceId).Find(&follows).Error; err != nil {
+		return err
+	}
+	for _, f := range follows {
+		nf := Follow{UserID: f.UserID, FollowedUserID: f.FollowedUserID, CreatedAt: f.CreatedAt}
+		if nf.UserID == sourceId {
+			nf.UserID = targetId
+		}
+		if nf.FollowedUserID == sourceId {
+			nf.FollowedUserID = targetId
+		}
+		// Users can't follow themselves.
+		if nf.UserID == nf.FollowedUserID {
+			continue
+		}
+		var count int64
+		if err := tx.Model(&Follow{}).Where("user_id = ? AND followed_user_id = ?", nf.UserID, nf.FollowedUserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Create(&nf).Error; err != nil {
+			return err
+		}
+	}
+	// Sources follows are removed when the source user is purged.
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// In memory db with `models` migrated.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal("failed to open db:", err)
+	}
+	// Every connection would get its own in memory db.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal("failed to get sql db:", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal("failed to migrate db:", err)
+	}
+	return db
+}
+
+// In memory db with the users table as it was before identities.
+func newLegacyUsersDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, &Image{}, &User{}, &UserIdentity{})
+	for _, col := range []string{"third_party_id", "third_party_auth"} {
+		if err := db.Exec("ALTER TABLE users ADD COLUMN `" + col + "` text").Error; err != nil {
+			t.Fatal("failed to add legacy column:", err)
+		}
+	}
+	return db
+}
+
+func TestMigrateUserIdentities(t *testing.T) {
+	type legacyUser struct {
+		username       string
+		userType       UserType
+		thirdPartyId   string
+		thirdPartyAuth string
+	}
+	tests := []struct {
+		name  string
+		users []legacyUser
+		// Identities that already exist, from a previous run that failed to drop the columns.
+		existing []UserIdentity
+		// Identities expected afterwards, by username.
+		want map[string]UserIdentity
+	}{
+		{
+			name:  "watcharr user uses username as third party id",
+			users: []legacyUser{{"alice", WATCHARR_USER, "", ""}},
+			want:  map[string]UserIdentity{"alice": {Type: WATCHARR_USER, ThirdPartyID: "alice"}},
+		},
+		{
+			name:  "third party user keeps its ids",
+			users: []legacyUser{{"bob", JELLYFIN_USER, "jf-1", "jf-token"}},
+			want:  map[string]UserIdentity{"bob": {Type: JELLYFIN_USER, ThirdPartyID: "jf-1", ThirdPartyAuth: "jf-token"}},
+		},
+		{
+			name: "user without third party id is skipped",
+			users: []legacyUser{
+				{"carol", PLEX_USER, "", ""},
+				{"dave", EMBY_USER, "emby-1", ""},
+			},
+			want: map[string]UserIdentity{"dave": {Type: EMBY_USER, ThirdPartyID: "emby-1"}},
+		},
+		{
+			name:     "existing identities are left alone when rerun",
+			users:    []legacyUser{{"erin", JELLYFIN_USER, "jf-2", "new-token"}},
+			existing: []UserIdentity{{UserID: 1, Type: JELLYFIN_USER, ThirdPartyID: "jf-2", ThirdPartyAuth: "old-token", Username: "erin"}},
+			want:     map[string]UserIdentity{"erin": {Type: JELLYFIN_USER, ThirdPartyID: "jf-2", ThirdPartyAuth: "old-token"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newLegacyUsersDB(t)
+			for _, u := range tt.users {
+				err := db.Exec(
+					"INSERT INTO users (created_at, updated_at, username, password, type, third_party_id, third_party_auth) VALUES (datetime('now'), datetime('now'), ?, '', ?, ?, ?)",
+					u.username, u.userType, u.thirdPartyId, u.thirdPartyAuth,
+				).Error
+				if err != nil {
+					t.Fatal("failed to insert legacy user:", err)
+				}
+			}
+			for _, i := range tt.existing {
+				if err := db.Create(&i).Error; err != nil {
+					t.Fatal("failed to insert existing identity:", err)
+				}
+			}
+
+			if err := migrateUserIdentities(db); err != nil {
+				t.Fatal("migrateUserIdentities() error:", err)
+			}
+			if db.Migrator().HasColumn(&User{}, "third_party_id") {
+				t.Error("third_party_id column wasn't dropped")
+			}
+			var identities []UserIdentity
+			if err := db.Find(&identities).Error; err != nil {
+				t.Fatal("failed to get identities:", err)
+			}
+			if len(identities) != len(tt.want) {
+				t.Fatalf("got %d identities, want %d", len(identities), len(tt.want))
+			}
+			for _, i := range identities {
+				w, ok := tt.want[i.Username]
+				if !ok {
+					t.Errorf("unexpected identity for %q", i.Username)
+					continue
+				}
+				if i.Type != w.Type || i.ThirdPartyID != w.ThirdPartyID || i.ThirdPartyAuth != w.ThirdPartyAuth {
+					t.Errorf("identity for %q = %+v, want %+v", i.Username, i, w)
+				}
+			}
+
+			// Nothing left to migrate.
+			if err := migrateUserIdentities(db); err != nil {
+				t.Error("migrateUserIdentities() second run error:", err)
+			}
+		})
+	}
+}
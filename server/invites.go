@@ -0,0 +1,109 @@
+// Invite codes let admins allow new users to register,
+// even when signing up is disabled.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InviteCreateRequest struct {
+	// How many users can register with this invite, 0 for unlimited.
+	MaxUses int `json:"maxUses" binding:"min=0"`
+	// How many hours the invite is valid for, 0 for no expiry.
+	ExpiresInHours int `json:"expiresInHours" binding:"min=0"`
+	// Permissions given to users that register with this invite.
+	Permissions int `json:"permissions"`
+}
+
+func createInvite(db *gorm.DB, userId uint, ir InviteCreateRequest) (Token, error) {
+	// Only allow permissions admins could grant manually.
+	allowedPerms := 0
+	for _, p := range grantablePermissions {
+		allowedPerms |= p
+	}
+	if ir.Permissions&^allowedPerms != 0 {
+		return Token{}, errors.New("invalid permissions")
+	}
+	code, err := generateURLSafeString(12)
+	if err != nil {
+		slog.Error("createInvite: Failed to generate string!", "error", err)
+		return Token{}, errors.New("failed to generate invite code")
+	}
+	invite := Token{
+		Type:        TOKENTYPE_INVITE,
+		Value:       code,
+		UserID:      userId,
+		MaxUses:     ir.MaxUses,
+		Permissions: ir.Permissions,
+	}
+	if ir.ExpiresInHours > 0 {
+		exp := time.Now().Add(time.Duration(ir.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &exp
+	}
+	if res := db.Create(&invite); res.Error != nil {
+		slog.Error("createInvite: Failed to insert invite into db!", "error", res.Error)
+		return Token{}, errors.New("failed to create invite")
+	}
+	slog.Info("createInvite: Invite created", "invite_id", invite.ID, "created_by", userId, "max_uses", invite.MaxUses, "expires_at", invite.ExpiresAt, "permissions", invite.Permissions)
+	return invite, nil
+}
+
+func getInvites(db *gorm.DB) ([]Token, error) {
+	invites := []Token{}
+	if res := db.Where("type = ?", TOKENTYPE_INVITE).Find(&invites); res.Error != nil {
+		slog.Error("getInvites: Failed to get invites from db!", "error", res.Error)
+		return []Token{}, errors.New("failed to get invites")
+	}
+	return invites, nil
+}
+
+func deleteInvite(db *gorm.DB, id uint) error {
+	res := db.Where("id = ? AND type = ?", id, TOKENTYPE_INVITE).Delete(&Token{})
+	if res.Error != nil {
+		slog.Error("deleteInvite: Failed to delete invite!", "id", id, "error", res.Error)
+		return errors.New("failed to delete invite")
+	}
+	if res.RowsAffected < 1 {
+		return errors.New("invite not found")
+	}
+	return nil
+}
+
+// Get an invite by its code, only if it can still be used.
+func getValidInvite(db *gorm.DB, code string) (Token, error) {
+	var invite Token
+	res := db.Where("value = ? AND type = ?", code, TOKENTYPE_INVITE).Take(&invite)
+	if res.Error != nil {
+		slog.Info("getValidInvite failed", "error", "invite not found in db")
+		return Token{}, errors.New("invalid invite code")
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		slog.Info("getValidInvite failed", "error", "invite has expired", "invite_id", invite.ID)
+		return Token{}, errors.New("invalid invite code")
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		slog.Info("getValidInvite failed", "error", "invite has been used up", "invite_id", invite.ID)
+		return Token{}, errors.New("invalid invite code")
+	}
+	return invite, nil
+}
+
+// Count a use of an invite.
+// Errors if the invite was used up or expired in the meantime.
+func useInvite(tx *gorm.DB, id uint) error {
+	res := tx.Model(&Token{}).
+		Where("id = ? AND type = ? AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)", id, TOKENTYPE_INVITE, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected < 1 {
+		return errors.New("invite can no longer be used")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUseInvite(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		invite Token
+		// How many times the invite should be usable.
+		wantUses int
+	}{
+		{"single use", Token{MaxUses: 1}, 1},
+		{"multi use", Token{MaxUses: 3}, 3},
+		{"already exhausted", Token{MaxUses: 2, Uses: 2}, 0},
+		{"expired", Token{MaxUses: 5, ExpiresAt: &past}, 0},
+		{"expired unlimited", Token{ExpiresAt: &past}, 0},
+		{"not expired yet", Token{MaxUses: 1, ExpiresAt: &future}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &Token{})
+			invite := tt.invite
+			invite.Type = TOKENTYPE_INVITE
+			invite.Value = "code"
+			invite.UserID = 1
+			if err := db.Create(&invite).Error; err != nil {
+				t.Fatal("failed to create invite:", err)
+			}
+			for i := 0; i < tt.wantUses; i++ {
+				if err := useInvite(db, invite.ID); err != nil {
+					t.Fatalf("use %d failed: %v", i+1, err)
+				}
+			}
+			if err := useInvite(db, invite.ID); err == nil {
+				t.Errorf("use %d succeeded, want it to fail", tt.wantUses+1)
+			}
+			var got Token
+			if err := db.Take(&got, invite.ID).Error; err != nil {
+				t.Fatal("failed to get invite:", err)
+			}
+			if want := tt.invite.Uses + tt.wantUses; got.Uses != want {
+				t.Errorf("uses = %d, want %d", got.Uses, want)
+			}
+		})
+	}
+}
+
+func TestUseInviteUnlimited(t *testing.T) {
+	db := newTestDB(t, &Token{})
+	invite := Token{Type: TOKENTYPE_INVITE, Value: "code", UserID: 1}
+	if err := db.Create(&invite).Error; err != nil {
+		t.Fatal("failed to create invite:", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := useInvite(db, invite.ID); err != nil {
+			t.Fatalf("use %d failed: %v", i+1, err)
+		}
+	}
+}
+
+// Other token types can't be counted as invite uses.
+func TestUseInviteOnlyInvites(t *testing.T) {
+	db := newTestDB(t, &Token{})
+	token := Token{Type: TOKENTYPE_PASSWORD_RESET, Value: "code", UserID: 1}
+	if err := db.Create(&token).Error; err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if err := useInvite(db, token.ID); err == nil {
+		t.Error("useInvite() succeeded on a password reset token")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type JellyfinItemSearchResponse struct {
@@ -46,40 +47,96 @@ type JFContentFindResponse struct {
 	Url        string `json:"url"`
 }
 
-// Jellyfin access middleware, ensures user is a jellyfin user.
+// A Jellyfin compatible media server.
+// Emby shares most of its api with Jellyfin, so both are
+// supported by the same code, configured by one of these.
+type MediaServer struct {
+	// Name used in logs, errors and routes (eg. jellyfin).
+	Name string
+	// Type of users (and identities) from this server.
+	UserType UserType
+	// Web ui page for an item, `id` and `serverId` query params are added to it.
+	itemPagePath string
+	// Activity added for content imported by a sync.
+	syncedActivity ActivityType
+	// Activity added for the last played date of content imported by a sync.
+	syncedWatchDateActivity ActivityType
+}
+
+var (
+	JellyfinServer = MediaServer{
+		Name:                    "jellyfin",
+		UserType:                JELLYFIN_USER,
+		itemPagePath:            "/web/index.html#!/details",
+		syncedActivity:          IMPORTED_WATCHED_JF,
+		syncedWatchDateActivity: IMPORTED_ADDED_WATCHED_JF,
+	}
+	EmbyServer = MediaServer{
+		Name:                    "emby",
+		UserType:                EMBY_USER,
+		itemPagePath:            "/web/index.html#!/item",
+		syncedActivity:          IMPORTED_WATCHED_EMBY,
+		syncedWatchDateActivity: IMPORTED_ADDED_WATCHED_EMBY,
+	}
+)
+
+// Configured host of the server, empty if disabled.
+func (s MediaServer) Host() string {
+	switch s.UserType {
+	case JELLYFIN_USER:
+		return Config.JELLYFIN_HOST
+	case EMBY_USER:
+		return Config.EMBY_HOST
+	}
+	return ""
+}
+
+// Media server access middleware, ensures user has a linked account on server `s`.
 // To be ran after AuthRequired middleware with extra data.
-func JellyfinAccessRequired() gin.HandlerFunc {
+// Sets the users server id and token as userThirdPartyId and userThirdPartyAuth.
+func MediaServerAccessRequired(db *gorm.DB, s MediaServer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		slog.Debug("JellyfinAccessRequired middleware hit", "user_id", userId)
-		userType := c.MustGet("userType").(UserType)
-		userThirdPartyId := c.MustGet("userThirdPartyId").(string)
-		userThirdPartyAuth := c.MustGet("userThirdPartyAuth").(string)
-		if Config.JELLYFIN_HOST == "" {
-			slog.Error("JellyfinAccessRequired: Request made to login via Jellyfin, but JELLYFIN_HOST has not been configured.")
+		slog.Debug("MediaServerAccessRequired middleware hit", "server", s.Name, "user_id", userId)
+		if s.Host() == "" {
+			slog.Error("MediaServerAccessRequired: Request made to media server, but its host has not been configured.", "server", s.Name)
 			c.AbortWithStatus(401)
 			return
 		}
-		if userType != JELLYFIN_USER || userThirdPartyId == "" {
-			slog.Error("JellyfinAccessRequired: User is not a jellyfin user..", "user_type", userType, "user_third_party_id", userThirdPartyId)
+		identity, err := getUserIdentity(db, userId, s.UserType)
+		if err != nil || identity.ThirdPartyID == "" {
+			slog.Error("MediaServerAccessRequired: User has no account linked for server..", "server", s.Name, "user_id", userId, "error", err)
 			c.AbortWithStatus(401)
 			return
 		}
-		if userThirdPartyAuth == "" {
-			slog.Error("JellyfinAccessRequired: User has no thirdPartyAuth token..")
+		if identity.ThirdPartyAuth == "" {
+			slog.Error("MediaServerAccessRequired: User has no thirdPartyAuth token..", "server", s.Name)
 			c.AbortWithStatus(401)
 			return
 		}
+		c.Set("userThirdPartyId", identity.ThirdPartyID)
+		c.Set("userThirdPartyAuth", identity.ThirdPartyAuth)
+		c.Next()
+	}
+}
+
+// Authorization header value, the same format is accepted by Jellyfin and Emby.
+func mediaServerAuthHeader(username string, userToken string) string {
+	authHeader := "MediaBrowser Client=\"Watcharr\", Device=\"HTTP\", DeviceId=\"WatcharrFor" + username + "\", Version=\"10.8.0\""
+	if userToken != "" {
+		authHeader += ", Token=\"" + userToken + "\""
 	}
+	return authHeader
 }
 
-func jellyfinAPIRequest(method string, ep string, p map[string]string, username string, userToken string, resp interface{}) error {
-	if Config.JELLYFIN_HOST == "" {
-		slog.Error("jellyfinAPIRequest: JELLYFIN_HOST not configured.")
-		return errors.New("jellyfin not enabled")
+func mediaServerAPIRequest(s MediaServer, method string, ep string, p map[string]string, username string, userToken string, resp interface{}) error {
+	host := s.Host()
+	if host == "" {
+		slog.Error("mediaServerAPIRequest: Host not configured.", "server", s.Name)
+		return errors.New(s.Name + " not enabled")
 	}
-	slog.Debug("jellyfinAPIRequest", "endpoint", ep, "params", p)
-	base, err := url.Parse(Config.JELLYFIN_HOST)
+	slog.Debug("mediaServerAPIRequest", "server", s.Name, "endpoint", ep, "params", p)
+	base, err := url.Parse(host)
 	if err != nil {
 		return errors.New("failed to parse api uri")
 	}
@@ -100,28 +157,28 @@ func jellyfinAPIRequest(method string, ep string, p map[string]string, username
 	client := &http.Client{}
 	req, err := http.NewRequest(method, base.String(), bytes.NewBuffer([]byte{}))
 	if err != nil {
-		slog.Error("Creating request to jellyfin failed", "error", err)
+		slog.Error("Creating request to media server failed", "server", s.Name, "error", err)
 		return errors.New("request failed")
 	}
 	req.Header.Add("Content-Type", "application/json")
-	authHeader := "MediaBrowser Client=\"Watcharr\", Device=\"HTTP\", DeviceId=\"WatcharrFor" + username + "\", Version=\"10.8.0\""
+	req.Header.Add("X-Emby-Authorization", mediaServerAuthHeader(username, userToken))
+	// Emby only reads the token from its own header.
 	if userToken != "" {
-		authHeader += ", Token=\"" + userToken + "\""
+		req.Header.Add("X-Emby-Token", userToken)
 	}
-	req.Header.Add("X-Emby-Authorization", authHeader)
 	res, err := client.Do(req)
 	if err != nil {
-		slog.Error("making request to jellyfin for auth failed", "error", err)
+		slog.Error("making request to media server failed", "server", s.Name, "error", err)
 		return errors.New("request failed")
 	}
 	body, err := io.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		slog.Error("Error reading jellyfin auth response", "error", err.Error())
+		slog.Error("Error reading media server response", "server", s.Name, "error", err.Error())
 		return err
 	}
 	if res.StatusCode != 200 {
-		slog.Error("Jellyfin auth non 200 status code", "status_code", res.StatusCode, "error", string(body))
+		slog.Error("Media server non 200 status code", "server", s.Name, "status_code", res.StatusCode, "error", string(body))
 		return errors.New("incorrect details")
 	}
 	// Unmarshal response
@@ -132,7 +189,68 @@ func jellyfinAPIRequest(method string, ep string, p map[string]string, username
 	return nil
 }
 
-func jellyfinContentFind(
+// Authenticate a user with a media server.
+func authenticateMediaServer(s MediaServer, username string, pw string) (JellyfinAuthResponse, error) {
+	host := s.Host()
+	if host == "" {
+		slog.Error("Request made to login via media server, but its host has not been configured.", "server", s.Name)
+		return JellyfinAuthResponse{}, errors.New(s.Name + " login not enabled")
+	}
+
+	base, err := url.Parse(host + "/Users/AuthenticateByName")
+	if err != nil {
+		slog.Error("Failed to parse AuthenticateByName api endpoint url", "server", s.Name, "error", err.Error())
+		return JellyfinAuthResponse{}, errors.New("failed to parse api uri")
+	}
+
+	// Marshall struct as json
+	usrJSON, err := json.Marshal(JellyfinAuth{Username: username, Pw: pw})
+	if err != nil {
+		slog.Error("Error marshalling JellyfinAuth JSON", "error", err.Error())
+		return JellyfinAuthResponse{}, errors.New("failed to marshal json")
+	}
+	// Run auth request
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", base.String(), bytes.NewBuffer(usrJSON))
+	if err != nil {
+		slog.Error("Creating request to media server for auth failed", "server", s.Name, "error", err)
+		return JellyfinAuthResponse{}, errors.New("request failed")
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Emby-Authorization", mediaServerAuthHeader(username, ""))
+	res, err := client.Do(req)
+	if err != nil {
+		slog.Error("making request to media server for auth failed", "server", s.Name, "error", err)
+		return JellyfinAuthResponse{}, errors.New("request failed")
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		slog.Error("Error reading media server auth response", "server", s.Name, "error", err.Error())
+		return JellyfinAuthResponse{}, err
+	}
+	if res.StatusCode != 200 {
+		slog.Error("Media server auth non 200 status code", "server", s.Name, "status_code", res.StatusCode, "error", string(body))
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+			return JellyfinAuthResponse{}, errIncorrectLoginDetails
+		}
+		return JellyfinAuthResponse{}, errors.New(s.Name + " auth failed")
+	}
+	// Process auth response
+	var resp JellyfinAuthResponse
+	err = json.Unmarshal([]byte(body), &resp)
+	if err != nil {
+		return JellyfinAuthResponse{}, errors.New("failed to process response")
+	}
+	if resp.User.ID == "" {
+		return JellyfinAuthResponse{}, errors.New(s.Name + " returned empty user id")
+	}
+	return resp, nil
+}
+
+// Find content on a media server, so users can play it there.
+func mediaServerContentFind(
+	s MediaServer,
 	userId uint,
 	userType UserType,
 	username string,
@@ -151,7 +269,8 @@ func jellyfinContentFind(
 	}
 
 	resp := new(JellyfinItemSearchResponse)
-	err := jellyfinAPIRequest(
+	err := mediaServerAPIRequest(
+		s,
 		"GET",
 		"/Users/"+userThirdPartyId+"/Items",
 		map[string]string{
@@ -173,18 +292,18 @@ func jellyfinContentFind(
 		&resp,
 	)
 	if err != nil {
-		slog.Error("jellyfinContentFind: Jellyfin API request failed", "error", err)
-		return JFContentFindResponse{}, errors.New("failed to get jellyfin response")
+		slog.Error("mediaServerContentFind: API request failed", "server", s.Name, "error", err)
+		return JFContentFindResponse{}, errors.New("failed to get " + s.Name + " response")
 	}
 
-	// Find true match from jf search results
+	// Find true match from search results
 	ret := new(JFContentFindResponse)
 	ret.HasContent = false
 	ret.Url = ""
 	for _, i := range resp.Items {
 		if i.ProviderIds.Tmdb == contentTmdbId {
 			ret.HasContent = true
-			ret.Url = Config.JELLYFIN_HOST + "/web/index.html#!/details?id=" + i.Id + "&serverId=" + i.ServerID
+			ret.Url = s.Host() + s.itemPagePath + "?id=" + i.Id + "&serverId=" + i.ServerID
 		}
 	}
 	return *ret, nil
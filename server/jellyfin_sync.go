@@ -34,11 +34,12 @@ type JellyfinSyncResponse struct {
 	JobId string `json:"jobId"`
 }
 
-// Perform the jellyfin sync.
-// Gets each type of media separately from jellyfin and attempts to import them.
+// Perform the media server (jellyfin/emby) sync.
+// Gets each type of media separately from the server and attempts to import them.
 // Errors are added silently to the job.
-func startJellyfinSync(
+func startMediaServerSync(
 	db *gorm.DB,
+	s MediaServer,
 	jobId string,
 	userId uint,
 	username string,
@@ -48,7 +49,8 @@ func startJellyfinSync(
 	// Get played movies
 	updateJobCurrentTask(jobId, userId, "syncing movies")
 	playedMovies := new(JellyfinItemSearchResponse)
-	err := jellyfinAPIRequest(
+	err := mediaServerAPIRequest(
+		s,
 		"GET",
 		"/Users/"+userThirdPartyId+"/Items",
 		map[string]string{
@@ -62,25 +64,25 @@ func startJellyfinSync(
 		&playedMovies,
 	)
 	if err != nil {
-		slog.Error("jellyfinSyncWatched: Jellyfin API request failed", "error", err)
-		addJobError(jobId, userId, "failed to get jellyfin response for movies")
+		slog.Error("mediaServerSyncWatched: API request failed", "server", s.Name, "error", err)
+		addJobError(jobId, userId, "failed to get "+s.Name+" response for movies")
 	} else {
 		if len(playedMovies.Items) <= 0 {
-			slog.Info("jellyfinSyncWatched: User has no played movies.", "user_id", userId)
+			slog.Info("mediaServerSyncWatched: User has no played movies.", "user_id", userId)
 		} else {
 			for _, v := range playedMovies.Items {
-				slog.Info("jellyfinSyncWatched: Importing played movie.", "movie_name", v.Name, "user_id", userId)
-				slog.Debug("jellyfinSyncWatched: Importing played movie.", "full_item", v, "user_id", userId)
+				slog.Info("mediaServerSyncWatched: Importing played movie.", "movie_name", v.Name, "user_id", userId)
+				slog.Debug("mediaServerSyncWatched: Importing played movie.", "full_item", v, "user_id", userId)
 
 				// 1. Ensure we have a tmdbId
 				if v.ProviderIds.Tmdb == "" {
-					slog.Error("jellyfinSyncWatched: Movie to import does not have a tmdb id.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Movie to import does not have a tmdb id.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "movie could not be imported (no tmdbId present): "+v.Name)
 					continue
 				}
 				tmdbId, err := strconv.Atoi(v.ProviderIds.Tmdb)
 				if err != nil {
-					slog.Error("jellyfinSyncWatched: Movie to import does not have a parseable (to int) tmdb id.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Movie to import does not have a parseable (to int) tmdb id.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "movie could not be imported (tmdbId was not parseable): "+v.Name)
 					continue
 				}
@@ -93,20 +95,20 @@ func startJellyfinSync(
 					ContentID:   tmdbId,
 					ContentType: MOVIE,
 					WatchedDate: v.UserData.LastPlayedDate,
-				}, IMPORTED_WATCHED_JF)
+				}, s.syncedActivity)
 				if err != nil {
 					if err.Error() == "content already on watched list" {
-						slog.Error("jellyfinSyncWatched: Unique constraint hit.. content must already be on watch list.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
+						slog.Error("mediaServerSyncWatched: Unique constraint hit.. content must already be on watch list.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
 					} else {
-						slog.Error("jellyfinSyncWatched: Movie failed to import.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
+						slog.Error("mediaServerSyncWatched: Movie failed to import.", "movie_name", v.Name, "movie_ids", v.ProviderIds, "user_id", userId)
 						addJobError(jobId, userId, "movie could not be imported (failed when adding to watched list): "+v.Name)
 					}
 				} else {
-					// 3. Add IMPORTED_ADDED_WATCHED_JF activity
+					// 3. Add the servers synced watch date activity
 					if !v.UserData.LastPlayedDate.IsZero() {
-						_, err := addActivity(db, userId, ActivityAddRequest{WatchedID: w.ID, Type: IMPORTED_ADDED_WATCHED_JF, CustomDate: &v.UserData.LastPlayedDate})
+						_, err := addActivity(db, userId, ActivityAddRequest{WatchedID: w.ID, Type: s.syncedWatchDateActivity, CustomDate: &v.UserData.LastPlayedDate})
 						if err != nil {
-							slog.Error("jellyfinSyncWatched: Failed to add dateswatched activity.", "movie_name", v.Name,
+							slog.Error("mediaServerSyncWatched: Failed to add dateswatched activity.", "movie_name", v.Name,
 								"movie_ids", v.ProviderIds, "user_id", userId, "date", v.UserData.LastPlayedDate, "error", err)
 						}
 					}
@@ -119,7 +121,8 @@ func startJellyfinSync(
 	// Can't rely on IsPlayed filter, since we want to get partially played series too.
 	updateJobCurrentTask(jobId, userId, "syncing series")
 	allSeries := new(JellyfinItemSearchResponse)
-	err = jellyfinAPIRequest(
+	err = mediaServerAPIRequest(
+		s,
 		"GET",
 		"/Users/"+userThirdPartyId+"/Items",
 		map[string]string{
@@ -133,32 +136,32 @@ func startJellyfinSync(
 		&allSeries,
 	)
 	if err != nil {
-		slog.Error("jellyfinSyncWatched: Jellyfin API request failed", "error", err)
-		addJobError(jobId, userId, "failed to get jellyfin response for series")
+		slog.Error("mediaServerSyncWatched: API request failed", "server", s.Name, "error", err)
+		addJobError(jobId, userId, "failed to get "+s.Name+" response for series")
 	} else {
 		if len(allSeries.Items) <= 0 {
-			slog.Info("jellyfinSyncWatched: No series found.", "user_id", userId)
+			slog.Info("mediaServerSyncWatched: No series found.", "user_id", userId)
 		} else {
 			// Import series
 			for _, v := range allSeries.Items {
-				slog.Info("jellyfinSyncWatched: Processing series.", "series_name", v.Name, "user_id", userId)
-				slog.Debug("jellyfinSyncWatched: Processing series.", "full_item", v, "user_id", userId)
+				slog.Info("mediaServerSyncWatched: Processing series.", "series_name", v.Name, "user_id", userId)
+				slog.Debug("mediaServerSyncWatched: Processing series.", "full_item", v, "user_id", userId)
 
 				// 1. Make sure show is watched or at least partially watched
 				if !v.UserData.Played && v.UserData.PlayedPercentage <= 0 && v.RecursiveItemCount == v.UserData.UnplayedItemCount {
-					slog.Debug("jellyfinSyncWatched: Skipping unwatched series:", "series_name", v.Name, "user_id", userId)
+					slog.Debug("mediaServerSyncWatched: Skipping unwatched series:", "series_name", v.Name, "user_id", userId)
 					continue
 				}
 
 				// 1.1. Ensure we have a tmdbId
 				if v.ProviderIds.Tmdb == "" {
-					slog.Error("jellyfinSyncWatched: Series to import does not have a tmdb id.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Series to import does not have a tmdb id.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "series could not be imported (no tmdbId present): "+v.Name)
 					continue
 				}
 				tmdbId, err := strconv.Atoi(v.ProviderIds.Tmdb)
 				if err != nil {
-					slog.Error("jellyfinSyncWatched: Series to import does not have a parseable (to int) tmdb id.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Series to import does not have a parseable (to int) tmdb id.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "series could not be imported (tmdbId was not parseable): "+v.Name)
 					continue
 				}
@@ -171,21 +174,21 @@ func startJellyfinSync(
 					ContentID:   tmdbId,
 					ContentType: SHOW,
 					WatchedDate: v.UserData.LastPlayedDate,
-				}, IMPORTED_WATCHED_JF)
+				}, s.syncedActivity)
 				if err != nil {
 					if err.Error() == "content already on watched list" {
-						slog.Info("jellyfinSyncWatched: Unique constraint hit.. content must already be on watch list.",
+						slog.Info("mediaServerSyncWatched: Unique constraint hit.. content must already be on watch list.",
 							"series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId, "watched_id", w.ID)
 					} else {
-						slog.Error("jellyfinSyncWatched: Series failed to import.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+						slog.Error("mediaServerSyncWatched: Series failed to import.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 						addJobError(jobId, userId, "series could not be imported (failed when adding to watched list): "+v.Name)
 					}
 				} else {
 					// 3. Add IMPORTED_ADDED_WATCHED activity (only if no err above, show also must not have already been on our list)
 					if !v.UserData.LastPlayedDate.IsZero() {
-						_, err := addActivity(db, userId, ActivityAddRequest{WatchedID: w.ID, Type: IMPORTED_ADDED_WATCHED_JF, CustomDate: &v.UserData.LastPlayedDate})
+						_, err := addActivity(db, userId, ActivityAddRequest{WatchedID: w.ID, Type: s.syncedWatchDateActivity, CustomDate: &v.UserData.LastPlayedDate})
 						if err != nil {
-							slog.Error("jellyfinSyncWatched: Failed to add dateswatched activity.", "series_name", v.Name,
+							slog.Error("mediaServerSyncWatched: Failed to add dateswatched activity.", "series_name", v.Name,
 								"series_ids", v.ProviderIds, "user_id", userId, "date", v.UserData.LastPlayedDate, "error", err)
 						}
 					}
@@ -194,7 +197,8 @@ func startJellyfinSync(
 				// 4. Import watched seasons for this serie
 				// Get all show seasons (filtering isPlayed doesn't seem to be a thing, so we will have to do that ourselves)
 				seriesSeasons := new(JellyfinSeriesSeasonsResponse)
-				err = jellyfinAPIRequest(
+				err = mediaServerAPIRequest(
+					s,
 					"GET",
 					"/Shows/"+v.Id+"/Seasons",
 					map[string]string{
@@ -207,15 +211,15 @@ func startJellyfinSync(
 					&seriesSeasons,
 				)
 				if err != nil {
-					slog.Error("jellyfinSyncWatched: Failed to fetch series seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Failed to fetch series seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "series seasons could not be imported (request failed): "+v.Name)
 				} else if len(seriesSeasons.Items) <= 0 {
-					slog.Info("jellyfinSyncWatched: Series has no seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Info("mediaServerSyncWatched: Series has no seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 				} else {
 					for _, vs := range seriesSeasons.Items {
-						slog.Debug("jellyfinSyncWatched: Processing a season.", "full_item", v, "user_id", userId)
+						slog.Debug("mediaServerSyncWatched: Processing a season.", "full_item", v, "user_id", userId)
 						if !vs.UserData.Played {
-							slog.Debug("jellyfinSyncWatched: Skipping import of unplayed season.", "series_name", v.Name, "season_num", vs.IndexNumber, "user_id", userId)
+							slog.Debug("mediaServerSyncWatched: Skipping import of unplayed season.", "series_name", v.Name, "season_num", vs.IndexNumber, "user_id", userId)
 							continue
 						}
 						updateJobCurrentTask(jobId, userId, "syncing "+v.Name+" season "+strconv.Itoa(vs.IndexNumber))
@@ -227,7 +231,7 @@ func startJellyfinSync(
 							addActivityDate: vs.UserData.LastPlayedDate,
 						})
 						if err != nil {
-							slog.Error("jellyfinSyncWatched: Failed to fetch series seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+							slog.Error("mediaServerSyncWatched: Failed to fetch series seasons.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 							addJobError(jobId, userId, "series season could not be imported (addWatchedSeason request failed): "+v.Name+" season "+strconv.Itoa(vs.IndexNumber))
 						}
 					}
@@ -236,7 +240,8 @@ func startJellyfinSync(
 				// 5. Import watched episodes for this serie
 				// Gets all show episodes (filtering isPlayed doesn't seem to be a thing, so we will have to do that ourselves)
 				seriesEpisodes := new(JellyfinSeriesEpisodesResponse)
-				err = jellyfinAPIRequest(
+				err = mediaServerAPIRequest(
+					s,
 					"GET",
 					"/Shows/"+v.Id+"/Episodes",
 					map[string]string{
@@ -249,15 +254,15 @@ func startJellyfinSync(
 					&seriesEpisodes,
 				)
 				if err != nil {
-					slog.Error("jellyfinSyncWatched: Failed to fetch series episodes.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Error("mediaServerSyncWatched: Failed to fetch series episodes.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 					addJobError(jobId, userId, "series episodes could not be imported (request failed): "+v.Name)
 				} else if len(seriesEpisodes.Items) <= 0 {
-					slog.Info("jellyfinSyncWatched: Series has no episodes.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
+					slog.Info("mediaServerSyncWatched: Series has no episodes.", "series_name", v.Name, "series_ids", v.ProviderIds, "user_id", userId)
 				} else {
 					for _, vs := range seriesEpisodes.Items {
-						slog.Debug("jellyfinSyncWatched: Processing an episode.", "full_item", v, "user_id", userId)
+						slog.Debug("mediaServerSyncWatched: Processing an episode.", "full_item", v, "user_id", userId)
 						if !vs.UserData.Played {
-							slog.Debug("jellyfinSyncWatched: Skipping import of unplayed episode.", "series_name", v.Name, "season_num", vs.ParentIndexNumber, "episode_num", vs.IndexNumber, "user_id", userId)
+							slog.Debug("mediaServerSyncWatched: Skipping import of unplayed episode.", "series_name", v.Name, "season_num", vs.ParentIndexNumber, "episode_num", vs.IndexNumber, "user_id", userId)
 							continue
 						}
 						updateJobCurrentTask(jobId, userId, "syncing "+v.Name+" season "+strconv.Itoa(vs.ParentIndexNumber)+" episode "+strconv.Itoa(vs.IndexNumber))
@@ -270,7 +275,7 @@ func startJellyfinSync(
 							addActivityDate: vs.UserData.LastPlayedDate,
 						})
 						if err != nil {
-							slog.Error("jellyfinSyncWatched: Failed to import series episode.", "series_name", v.Name, "season_num", vs.ParentIndexNumber, "episode_num", vs.IndexNumber, "user_id", userId)
+							slog.Error("mediaServerSyncWatched: Failed to import series episode.", "series_name", v.Name, "season_num", vs.ParentIndexNumber, "episode_num", vs.IndexNumber, "user_id", userId)
 							addJobError(jobId, userId, "series episode could not be imported (addWatchedEpisode request failed): "+v.Name+" "+vs.Name)
 						}
 					}
@@ -282,24 +287,26 @@ func startJellyfinSync(
 	updateJobStatus(jobId, userId, JOB_DONE)
 }
 
-func jellyfinSyncWatched(
+func mediaServerSyncWatched(
 	db *gorm.DB,
+	s MediaServer,
 	userId uint,
 	userType UserType,
 	username string,
 	userThirdPartyId string,
 	userThirdPartyAuth string,
 ) (JellyfinSyncResponse, error) {
-	jobId, err := addJob("jf_sync", userId)
+	jobId, err := addJob(s.Name+"_sync", userId)
 	if err != nil {
-		slog.Error("jellyfinSyncWatched: Failed to create a job", "error", err)
+		slog.Error("mediaServerSyncWatched: Failed to create a job", "error", err)
 		return JellyfinSyncResponse{}, errors.New("failed to create job")
 	}
 
 	updateJobStatus(jobId, userId, JOB_RUNNING)
 
-	go startJellyfinSync(
+	go startMediaServerSync(
 		db,
+		s,
 		jobId,
 		userId,
 		username,
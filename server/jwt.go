@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// A JWT secret that has been rotated out.
+// Tokens signed with it are still accepted until ExpiresAt.
+type RetiredJWTSecret struct {
+	ID        string
+	Secret    string
+	ExpiresAt time.Time
+}
+
+type JWTRotateRequest struct {
+	// How many hours tokens signed with the current secret should
+	// still be accepted for. Defaults to `defaultJWTGracePeriod` if not provided.
+	GracePeriodHours *int `json:"gracePeriodHours" binding:"omitempty,min=0"`
+}
+
+type JWTRotateResponse struct {
+	// Key id of the newly generated secret.
+	NewKeyID string `json:"newKeyId"`
+	// When the previous secret will stop being accepted.
+	OldKeyExpiresAt time.Time `json:"oldKeyExpiresAt"`
+}
+
+const (
+	defaultJWTGracePeriod = 7 * 24 * time.Hour
+	// How long tokens without a kid header (signed before key rotation
+	// was added) are still accepted for after upgrading.
+	legacyJWTGracePeriod = 30 * 24 * time.Hour
+)
+
+var (
+	// Guards JWT_SECRET, JWT_SECRET_ID and JWT_RETIRED_SECRETS in our Config,
+	// since they can be rotated while requests are being authenticated.
+	jwtSecretsMutex sync.RWMutex
+	// Only warn about legacy tokens once, they are used on every request.
+	legacyJWTWarning sync.Once
+)
+
+func generateJWTKeyID() (string, error) {
+	return generateString(12)
+}
+
+// Keyfunc for jwt parsing.
+// Finds the secret matching the tokens `kid` header, which is either our
+// current JWT_SECRET or a retired secret that hasn't expired yet.
+// Tokens without a kid are accepted as signed by the legacy secret,
+// until its grace period is over.
+func getJWTVerificationKey(token *jwt.Token) (interface{}, error) {
+	jwtSecretsMutex.RLock()
+	defer jwtSecretsMutex.RUnlock()
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		if Config.JWT_LEGACY_SECRET_ID == "" || Config.JWT_LEGACY_EXPIRES_AT == nil {
+			return nil, errors.New("token has no kid header")
+		}
+		if time.Now().After(*Config.JWT_LEGACY_EXPIRES_AT) {
+			return nil, errors.New("token has no kid header and legacy tokens are no longer accepted")
+		}
+		legacyJWTWarning.Do(func() {
+			slog.Warn("Accepting auth tokens without a kid header. This is deprecated, users will be logged out when it stops.", "accepted_until", *Config.JWT_LEGACY_EXPIRES_AT)
+		})
+		kid = Config.JWT_LEGACY_SECRET_ID
+	}
+	if kid == Config.JWT_SECRET_ID {
+		return []byte(Config.JWT_SECRET), nil
+	}
+	for _, v := range Config.JWT_RETIRED_SECRETS {
+		if v.ID == kid {
+			if time.Now().After(v.ExpiresAt) {
+				return nil, errors.New("token signed with expired key")
+			}
+			return []byte(v.Secret), nil
+		}
+	}
+	return nil, errors.New("token signed with unknown key")
+}
+
+// Generate a new JWT_SECRET and retire the current one.
+// The retired secret will still verify tokens until the grace period is over.
+func rotateJWTSecret(gracePeriod time.Duration) (JWTRotateResponse, error) {
+	newSecret, err := generateString(64)
+	if err != nil {
+		slog.Error("rotateJWTSecret: Failed to generate new secret", "error", err)
+		return JWTRotateResponse{}, errors.New("failed to generate new secret")
+	}
+	newKid, err := generateJWTKeyID()
+	if err != nil {
+		slog.Error("rotateJWTSecret: Failed to generate new key id", "error", err)
+		return JWTRotateResponse{}, errors.New("failed to generate new key id")
+	}
+
+	jwtSecretsMutex.Lock()
+	defer jwtSecretsMutex.Unlock()
+	prevSecret := Config.JWT_SECRET
+	prevKid := Config.JWT_SECRET_ID
+	prevRetired := Config.JWT_RETIRED_SECRETS
+
+	oldExpiresAt := time.Now().Add(gracePeriod)
+	retired := []RetiredJWTSecret{}
+	for _, v := range Config.JWT_RETIRED_SECRETS {
+		if time.Now().Before(v.ExpiresAt) {
+			retired = append(retired, v)
+		}
+	}
+	if gracePeriod > 0 {
+		retired = append(retired, RetiredJWTSecret{ID: prevKid, Secret: prevSecret, ExpiresAt: oldExpiresAt})
+	}
+	Config.JWT_SECRET = newSecret
+	Config.JWT_SECRET_ID = newKid
+	Config.JWT_RETIRED_SECRETS = retired
+	if err := writeConfig(); err != nil {
+		slog.Error("rotateJWTSecret: Failed to write config.. reverting to previous secret", "error", err)
+		Config.JWT_SECRET = prevSecret
+		Config.JWT_SECRET_ID = prevKid
+		Config.JWT_RETIRED_SECRETS = prevRetired
+		return JWTRotateResponse{}, errors.New("failed to save config")
+	}
+	slog.Info("rotateJWTSecret: JWT secret rotated", "new_kid", newKid, "old_kid", prevKid, "old_kid_expires_at", oldExpiresAt)
+	return JWTRotateResponse{NewKeyID: newKid, OldKeyExpiresAt: oldExpiresAt}, nil
+}
+
+// Remove retired secrets that have passed their grace period.
+func cleanupRetiredJWTSecrets() {
+	jwtSecretsMutex.Lock()
+	defer jwtSecretsMutex.Unlock()
+	retired := []RetiredJWTSecret{}
+	for _, v := range Config.JWT_RETIRED_SECRETS {
+		if time.Now().Before(v.ExpiresAt) {
+			retired = append(retired, v)
+		}
+	}
+	legacyExpired := Config.JWT_LEGACY_EXPIRES_AT != nil && time.Now().After(*Config.JWT_LEGACY_EXPIRES_AT)
+	if legacyExpired {
+		slog.Info("cleanupRetiredJWTSecrets: Legacy token grace period is over")
+		Config.JWT_LEGACY_SECRET_ID = ""
+		Config.JWT_LEGACY_EXPIRES_AT = nil
+	}
+	if len(retired) == len(Config.JWT_RETIRED_SECRETS) && !legacyExpired {
+		return
+	}
+	if len(retired) != len(Config.JWT_RETIRED_SECRETS) {
+		slog.Info("cleanupRetiredJWTSecrets: Removing expired secrets", "amount", len(Config.JWT_RETIRED_SECRETS)-len(retired))
+		Config.JWT_RETIRED_SECRETS = retired
+	}
+	if err := writeConfig(); err != nil {
+		slog.Error("cleanupRetiredJWTSecrets: Failed to write config", "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Use a known set of secrets for the test, restoring the real config after.
+// Runs in a temp dir so rotating can write the config.
+func setupJWTConfig(t *testing.T) {
+	t.Helper()
+	old := Config
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("failed to get working dir:", err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(dir+"/data", 0755); err != nil {
+		t.Fatal("failed to create data dir:", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal("failed to change dir:", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		Config = old
+	})
+	Config = ServerConfig{JWT_SECRET: "current-secret", JWT_SECRET_ID: "current"}
+}
+
+func signTestJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, TokenClaims{
+		UserID:           1,
+		Username:         "user",
+		RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now()), Issuer: "watcharr"},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+	return signed
+}
+
+func TestParseAuthToken(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name    string
+		retired []RetiredJWTSecret
+		// Legacy secret id and when tokens without a kid stop being accepted.
+		legacyId        string
+		legacyExpiresAt *time.Time
+		token           func(t *testing.T) string
+		wantValid       bool
+	}{
+		{
+			name: "current kid",
+			token: func(t *testing.T) string {
+				return signTestJWT(t, jwt.SigningMethodHS256, "current", []byte("current-secret"))
+			},
+			wantValid: true,
+		},
+		{
+			name: "current kid with wrong secret",
+			token: func(t *testing.T) string {
+				return signTestJWT(t, jwt.SigningMethodHS256, "current", []byte("guessed-secret"))
+			},
+			wantValid: false,
+		},
+		{
+			name:      "retired kid before it expires",
+			retired:   []RetiredJWTSecret{{ID: "old", Secret: "old-secret", ExpiresAt: future}},
+			token:     func(t *testing.T) string { return signTestJWT(t, jwt.SigningMethodHS256, "old", []byte("old-secret")) },
+			wantValid: true,
+		},
+		{
+			name:      "retired kid after it expires",
+			retired:   []RetiredJWTSecret{{ID: "old", Secret: "old-secret", ExpiresAt: past}},
+			token:     func(t *testing.T) string { return signTestJWT(t, jwt.SigningMethodHS256, "old", []byte("old-secret")) },
+			wantValid: false,
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				return signTestJWT(t, jwt.SigningMethodHS256, "made-up", []byte("current-secret"))
+			},
+			wantValid: false,
+		},
+		{
+			name:            "no kid inside legacy grace period",
+			legacyId:        "current",
+			legacyExpiresAt: &future,
+			token:           func(t *testing.T) string { return signTestJWT(t, jwt.SigningMethodHS256, "", []byte("current-secret")) },
+			wantValid:       true,
+		},
+		{
+			name:            "no kid after legacy grace period",
+			legacyId:        "current",
+			legacyExpiresAt: &past,
+			token:           func(t *testing.T) string { return signTestJWT(t, jwt.SigningMethodHS256, "", []byte("current-secret")) },
+			wantValid:       false,
+		},
+		{
+			name:      "no kid without a legacy secret",
+			token:     func(t *testing.T) string { return signTestJWT(t, jwt.SigningMethodHS256, "", []byte("current-secret")) },
+			wantValid: false,
+		},
+		{
+			name: "hs512 with the current secret",
+			token: func(t *testing.T) string {
+				return signTestJWT(t, jwt.SigningMethodHS512, "current", []byte("current-secret"))
+			},
+			wantValid: false,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return signTestJWT(t, jwt.SigningMethodNone, "current", jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantValid: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupJWTConfig(t)
+			Config.JWT_RETIRED_SECRETS = tt.retired
+			Config.JWT_LEGACY_SECRET_ID = tt.legacyId
+			Config.JWT_LEGACY_EXPIRES_AT = tt.legacyExpiresAt
+
+			token, err := parseAuthToken(tt.token(t))
+			valid := err == nil && token.Valid
+			if valid != tt.wantValid {
+				t.Errorf("parseAuthToken() valid = %v (error: %v), want %v", valid, err, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestRotateJWTSecret(t *testing.T) {
+	setupJWTConfig(t)
+	before := signTestJWT(t, jwt.SigningMethodHS256, "current", []byte("current-secret"))
+
+	resp, err := rotateJWTSecret(time.Hour)
+	if err != nil {
+		t.Fatal("rotateJWTSecret() error:", err)
+	}
+	if resp.NewKeyID == "" || resp.NewKeyID == "current" || Config.JWT_SECRET == "current-secret" {
+		t.Fatalf("secret wasn't rotated, new kid %q", resp.NewKeyID)
+	}
+	after := signTestJWT(t, jwt.SigningMethodHS256, resp.NewKeyID, []byte(Config.JWT_SECRET))
+	for name, token := range map[string]string{"old key": before, "new key": after} {
+		if _, err := parseAuthToken(token); err != nil {
+			t.Errorf("%s: token rejected after rotating: %v", name, err)
+		}
+	}
+
+	// Still inside the grace period, so cleanup keeps the old key.
+	cleanupRetiredJWTSecrets()
+	if _, err := parseAuthToken(before); err != nil {
+		t.Error("old key rejected before its grace period is over:", err)
+	}
+
+	Config.JWT_RETIRED_SECRETS[0].ExpiresAt = time.Now().Add(-time.Second)
+	cleanupRetiredJWTSecrets()
+	if len(Config.JWT_RETIRED_SECRETS) != 0 {
+		t.Errorf("expired key wasn't cleaned up, %d retired keys left", len(Config.JWT_RETIRED_SECRETS))
+	}
+	if _, err := parseAuthToken(before); err == nil {
+		t.Error("old key accepted after its grace period is over")
+	}
+	if _, err := parseAuthToken(after); err != nil {
+		t.Error("new key rejected after cleanup:", err)
+	}
+}
+
+func TestRotateJWTSecretWithoutGracePeriod(t *testing.T) {
+	setupJWTConfig(t)
+	before := signTestJWT(t, jwt.SigningMethodHS256, "current", []byte("current-secret"))
+	if _, err := rotateJWTSecret(0); err != nil {
+		t.Fatal("rotateJWTSecret() error:", err)
+	}
+	if _, err := parseAuthToken(before); err == nil {
+		t.Error("old key accepted after rotating without a grace period")
+	}
+}
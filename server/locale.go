@@ -0,0 +1,104 @@
+// Languages and countries.
+// Users can choose which language metadata from TMDB is in, and which
+// country watch providers are shown for. The servers DEFAULT_LANGUAGE
+// and DEFAULT_COUNTRY are used for anything they haven't set.
+// Content we store (eg titles in watched lists) is always in the servers language.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ISO 639-1 code, optionally with an ISO 3166-1 region (eg `en` or `en-US`).
+	languageRegex = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+	// ISO 3166-1 code (eg `US`).
+	countryRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// How long users languages and countries are cached for, they're needed
+// on every content request so we don't want to hit the db each time.
+const userWhereaboutsTTL = 5 * time.Minute
+
+// Users chosen language and country (empty if not set), by user id.
+var userWhereaboutsCache sync.Map
+
+type userWhereabouts struct {
+	language string
+	country  string
+	expires  time.Time
+}
+
+func validateLanguage(l string) error {
+	if !languageRegex.MatchString(l) {
+		return errors.New("invalid language, expected a code like en-US")
+	}
+	return nil
+}
+
+func validateCountry(c string) error {
+	if !countryRegex.MatchString(c) {
+		return errors.New("invalid country, expected a code like US")
+	}
+	return nil
+}
+
+func getServerLanguage() string {
+	if Config.DEFAULT_LANGUAGE != "" {
+		return Config.DEFAULT_LANGUAGE
+	}
+	return "en-US"
+}
+
+func getServerCountry() string {
+	if Config.DEFAULT_COUNTRY != "" {
+		return Config.DEFAULT_COUNTRY
+	}
+	return "US"
+}
+
+// Get a users language and country, falling back to the servers defaults.
+func getUserWhereabouts(db *gorm.DB, userId uint) (string, string) {
+	language := getServerLanguage()
+	country := getServerCountry()
+	if userId == 0 {
+		return language, country
+	}
+	var w userWhereabouts
+	if v, ok := userWhereaboutsCache.Load(userId); ok && time.Now().Before(v.(userWhereabouts).expires) {
+		w = v.(userWhereabouts)
+	} else {
+		var user User
+		if res := db.Select("language", "country").Where("id = ?", userId).Take(&user); res.Error != nil {
+			slog.Error("getUserWhereabouts: Failed to get user", "user_id", userId, "error", res.Error)
+			return language, country
+		}
+		w = userWhereabouts{expires: time.Now().Add(userWhereaboutsTTL)}
+		if user.Language != nil {
+			w.language = *user.Language
+		}
+		if user.Country != nil {
+			w.country = *user.Country
+		}
+		userWhereaboutsCache.Store(userId, w)
+	}
+	if w.language != "" {
+		language = w.language
+	}
+	if w.country != "" {
+		country = w.country
+	}
+	return language, country
+}
+
+// Remove a user from the whereabouts cache, call after changing their language or country.
+func forgetUserWhereabouts(userId uint) {
+	userWhereaboutsCache.Delete(userId)
+}
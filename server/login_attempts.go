@@ -0,0 +1,236 @@
+// Brute-force protection for logins.
+// Failed logins are tracked per ip and per username, after a few
+// failures further attempts are locked out for an exponentially
+// growing amount of time.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LoginLockoutType string
+
+var (
+	LOGIN_LOCKOUT_IP       LoginLockoutType = "ip"
+	LOGIN_LOCKOUT_USERNAME LoginLockoutType = "username"
+)
+
+type loginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Failed login tracking shown to admins.
+type LoginLockout struct {
+	Type        LoginLockoutType `json:"type"`
+	Key         string           `json:"key"`
+	Failures    int              `json:"failures"`
+	LastFailure time.Time        `json:"lastFailure"`
+	LockedUntil *time.Time       `json:"lockedUntil,omitempty"`
+}
+
+type LoginLockoutClearRequest struct {
+	// Leave both empty to clear all lockouts.
+	Type LoginLockoutType `json:"type"`
+	Key  string           `json:"key"`
+}
+
+var errIncorrectLoginDetails = errors.New("incorrect details")
+
+const (
+	// Failures allowed before lockouts start.
+	// Ips get more since multiple users can share one.
+	loginFreeFailuresUsername = 5
+	loginFreeFailuresIP       = 20
+	loginLockoutBase          = 30 * time.Second
+	loginLockoutMax           = time.Hour
+	// How long after the last failure we forget about an ip/username.
+	loginAttemptsWindow = time.Hour
+)
+
+var (
+	loginAttemptsByIP       = make(map[string]*loginAttempts)
+	loginAttemptsByUsername = make(map[string]*loginAttempts)
+	loginAttemptsMutex      sync.Mutex
+)
+
+// Username key includes the provider, since the same
+// username can exist once per auth provider.
+func loginUsernameKey(provider string, username string) string {
+	return provider + ":" + strings.ToLower(username)
+}
+
+// Exponential lockout duration for the amount of failures over the free amount.
+func loginLockoutDuration(failures int, free int) time.Duration {
+	over := failures - free
+	if over <= 0 {
+		return 0
+	}
+	d := time.Duration(float64(loginLockoutBase) * math.Pow(2, float64(over-1)))
+	if d > loginLockoutMax || d <= 0 {
+		return loginLockoutMax
+	}
+	return d
+}
+
+// Returns how long until the ip or username can login again, 0 if it can now.
+func loginLockedFor(ip string, usernameKey string) time.Duration {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	var wait time.Duration
+	if a, ok := loginAttemptsByIP[ip]; ok {
+		wait = max(wait, time.Until(a.LockedUntil))
+	}
+	if a, ok := loginAttemptsByUsername[usernameKey]; ok {
+		wait = max(wait, time.Until(a.LockedUntil))
+	}
+	return max(wait, 0)
+}
+
+// Returns the usernames failures so far and if the ip or
+// username is now locked out.
+func recordLoginFailure(ip string, usernameKey string) (int, bool) {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	now := time.Now()
+	record := func(m map[string]*loginAttempts, key string, free int) *loginAttempts {
+		a, ok := m[key]
+		if !ok || now.Sub(a.LastFailure) > loginAttemptsWindow {
+			a = &loginAttempts{}
+			m[key] = a
+		}
+		a.Failures++
+		a.LastFailure = now
+		if d := loginLockoutDuration(a.Failures, free); d > 0 {
+			a.LockedUntil = now.Add(d)
+		}
+		return a
+	}
+	ipa := record(loginAttemptsByIP, ip, loginFreeFailuresIP)
+	ua := record(loginAttemptsByUsername, usernameKey, loginFreeFailuresUsername)
+	slog.Warn("Failed login", "ip", ip, "username", usernameKey, "ip_failures", ipa.Failures, "username_failures", ua.Failures)
+	if ipa.LockedUntil.After(now) || ua.LockedUntil.After(now) {
+		slog.Warn("Login locked out", "ip", ip, "username", usernameKey, "ip_locked_until", ipa.LockedUntil, "username_locked_until", ua.LockedUntil)
+		return ua.Failures, true
+	}
+	return ua.Failures, false
+}
+
+// Successful logins reset the usernames failures.
+// The ip is left alone, so one valid account can't be used to
+// reset an ip that is guessing passwords for others.
+func recordLoginSuccess(usernameKey string) {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	delete(loginAttemptsByUsername, usernameKey)
+}
+
+// Run a login function with brute-force protection and respond with its result.
+func handleProtectedLogin(c *gin.Context, db *gorm.DB, provider string, username string, login func() (AuthResponse, error)) {
+	ip := c.ClientIP()
+	key := loginUsernameKey(provider, username)
+	if wait := loginLockedFor(ip, key); wait > 0 {
+		secs := int(math.Ceil(wait.Seconds()))
+		slog.Warn("Login attempted while locked out", "ip", ip, "username", key, "retry_after", secs)
+		c.Header("Retry-After", strconv.Itoa(secs))
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: fmt.Sprintf("too many failed login attempts, try again in %d seconds", secs)})
+		return
+	}
+	response, err := login()
+	if err != nil {
+		if errors.Is(err, errIncorrectLoginDetails) {
+			failures, locked := recordLoginFailure(ip, key)
+			// Only the first failure in a row is audited, the rest
+			// would just be noise. Lockouts are audited instead.
+			if failures == 1 {
+				addAuditLog(db, c, AUDIT_LOGIN_FAILED, key, nil, nil)
+			}
+			if locked {
+				addAuditLog(db, c, AUDIT_LOGIN_LOCKED, key, nil, nil)
+			}
+		}
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+	recordLoginSuccess(key)
+	c.JSON(http.StatusOK, response)
+}
+
+// Get all tracked ips and usernames that have failed logins.
+func getLoginLockouts() []LoginLockout {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	now := time.Now()
+	lockouts := []LoginLockout{}
+	add := func(t LoginLockoutType, m map[string]*loginAttempts) {
+		for k, a := range m {
+			l := LoginLockout{Type: t, Key: k, Failures: a.Failures, LastFailure: a.LastFailure}
+			if a.LockedUntil.After(now) {
+				lu := a.LockedUntil
+				l.LockedUntil = &lu
+			}
+			lockouts = append(lockouts, l)
+		}
+	}
+	add(LOGIN_LOCKOUT_IP, loginAttemptsByIP)
+	add(LOGIN_LOCKOUT_USERNAME, loginAttemptsByUsername)
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LastFailure.After(lockouts[j].LastFailure)
+	})
+	return lockouts
+}
+
+// Clear a lockout, or all of them if no type and key are passed.
+func clearLoginLockout(r LoginLockoutClearRequest) error {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	if r.Type == "" && r.Key == "" {
+		loginAttemptsByIP = make(map[string]*loginAttempts)
+		loginAttemptsByUsername = make(map[string]*loginAttempts)
+		slog.Info("clearLoginLockout: Cleared all lockouts")
+		return nil
+	}
+	var m map[string]*loginAttempts
+	switch r.Type {
+	case LOGIN_LOCKOUT_IP:
+		m = loginAttemptsByIP
+	case LOGIN_LOCKOUT_USERNAME:
+		m = loginAttemptsByUsername
+	default:
+		return errors.New("invalid lockout type")
+	}
+	if _, ok := m[r.Key]; !ok {
+		return errors.New("lockout not found")
+	}
+	delete(m, r.Key)
+	slog.Info("clearLoginLockout: Cleared lockout", "type", r.Type, "key", r.Key)
+	return nil
+}
+
+// Forget ips and usernames that haven't failed a login in a while.
+func cleanupLoginAttempts() {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	now := time.Now()
+	for _, m := range []map[string]*loginAttempts{loginAttemptsByIP, loginAttemptsByUsername} {
+		for k, a := range m {
+			if now.After(a.LockedUntil) && now.Sub(a.LastFailure) > loginAttemptsWindow {
+				delete(m, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func resetLoginAttempts() {
+	loginAttemptsMutex.Lock()
+	defer loginAttemptsMutex.Unlock()
+	loginAttemptsByIP = make(map[string]*loginAttempts)
+	loginAttemptsByUsername = make(map[string]*loginAttempts)
+}
+
+func TestLoginLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		free     int
+		want     time.Duration
+	}{
+		{"no failures", 0, 5, 0},
+		{"under free amount", 4, 5, 0},
+		{"at free amount", 5, 5, 0},
+		{"first over", 6, 5, loginLockoutBase},
+		{"second over", 7, 5, 2 * loginLockoutBase},
+		{"third over", 8, 5, 4 * loginLockoutBase},
+		{"capped", 20, 5, loginLockoutMax},
+		{"huge amount doesn't overflow", 10000, 5, loginLockoutMax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginLockoutDuration(tt.failures, tt.free); got != tt.want {
+				t.Errorf("loginLockoutDuration(%d, %d) = %v, want %v", tt.failures, tt.free, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// Failures recorded before the one being checked.
+		before       int
+		wantFailures int
+		wantLocked   bool
+	}{
+		{"first failure", 0, 1, false},
+		{"last free failure", loginFreeFailuresUsername - 1, loginFreeFailuresUsername, false},
+		{"first locked failure", loginFreeFailuresUsername, loginFreeFailuresUsername + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetLoginAttempts()
+			key := loginUsernameKey("watcharr", "User")
+			for i := 0; i < tt.before; i++ {
+				recordLoginFailure("1.1.1.1", key)
+			}
+			failures, locked := recordLoginFailure("1.1.1.1", key)
+			if failures != tt.wantFailures || locked != tt.wantLocked {
+				t.Errorf("recordLoginFailure() = (%d, %v), want (%d, %v)", failures, locked, tt.wantFailures, tt.wantLocked)
+			}
+			if wait := loginLockedFor("1.1.1.1", key); (wait > 0) != tt.wantLocked {
+				t.Errorf("loginLockedFor() = %v, want locked %v", wait, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestLoginLockoutIsPerUsernameAndIP(t *testing.T) {
+	resetLoginAttempts()
+	key := loginUsernameKey("watcharr", "user")
+	for i := 0; i <= loginFreeFailuresUsername; i++ {
+		recordLoginFailure("1.1.1.1", key)
+	}
+	tests := []struct {
+		name       string
+		ip         string
+		username   string
+		wantLocked bool
+	}{
+		{"same username and ip", "1.1.1.1", "user", true},
+		{"same username from another ip", "2.2.2.2", "user", true},
+		{"username is case insensitive", "2.2.2.2", "USER", true},
+		{"another username from same ip", "1.1.1.1", "other", false},
+		{"another username and ip", "2.2.2.2", "other", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait := loginLockedFor(tt.ip, loginUsernameKey("watcharr", tt.username))
+			if (wait > 0) != tt.wantLocked {
+				t.Errorf("loginLockedFor(%q, %q) = %v, want locked %v", tt.ip, tt.username, wait, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestRecordLoginSuccessKeepsIPFailures(t *testing.T) {
+	resetLoginAttempts()
+	key := loginUsernameKey("watcharr", "user")
+	for i := 0; i < loginFreeFailuresIP; i++ {
+		recordLoginFailure("1.1.1.1", loginUsernameKey("watcharr", "guess"))
+	}
+	recordLoginSuccess(key)
+	if _, locked := recordLoginFailure("1.1.1.1", key); !locked {
+		t.Error("ip should still be locked out after another user logged in from it")
+	}
+}
@@ -0,0 +1,465 @@
+// Metadata providers.
+// TMDB is always first in the chain, the providers chosen in METADATA come
+// after it to fill in details TMDB doesn't have (overviews, runtimes) and
+// add their ratings.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sbondCo/Watcharr/metadata"
+)
+
+const metadataCacheTTL = 24 * time.Hour
+
+type MetadataSettings struct {
+	// Providers to use alongside TMDB, in order of preference (`tvdb`, `omdb`).
+	Providers []string `json:"providers,omitempty"`
+	TvdbKey   string   `json:"tvdbKey,omitempty"`
+	// Only needed for user subscription keys.
+	TvdbPin string `json:"tvdbPin,omitempty"`
+	OmdbKey string `json:"omdbKey,omitempty"`
+}
+
+var (
+	metadataProviders      []metadata.Provider
+	metadataProvidersMutex sync.RWMutex
+	// Provider responses, so we aren't asking them for the same thing on every page view.
+	metadataCache sync.Map
+)
+
+type metadataCacheEntry struct {
+	value   any
+	err     error
+	expires time.Time
+}
+
+// Create the providers chosen in config.
+func loadMetadataProviders() {
+	providers := []metadata.Provider{}
+	for _, p := range Config.METADATA.Providers {
+		switch p {
+		case "tvdb":
+			providers = append(providers, metadata.NewTVDB(Config.METADATA.TvdbKey, Config.METADATA.TvdbPin))
+		case "omdb":
+			providers = append(providers, metadata.NewOMDb(Config.METADATA.OmdbKey))
+		}
+	}
+	metadataProvidersMutex.Lock()
+	metadataProviders = providers
+	metadataProvidersMutex.Unlock()
+	metadataCache.Range(func(k, _ any) bool {
+		metadataCache.Delete(k)
+		return true
+	})
+}
+
+func getMetadataProviders() []metadata.Provider {
+	metadataProvidersMutex.RLock()
+	defer metadataProvidersMutex.RUnlock()
+	return metadataProviders
+}
+
+func saveMetadataConfig(m MetadataSettings) error {
+	for i, p := range m.Providers {
+		if slices.Contains(m.Providers[:i], p) {
+			return errors.New("provider " + p + " is listed twice")
+		}
+		switch p {
+		case "tvdb":
+			if m.TvdbKey == "" {
+				return errors.New("tvdb api key is required")
+			}
+		case "omdb":
+			if m.OmdbKey == "" {
+				return errors.New("omdb api key is required")
+			}
+		default:
+			return errors.New("unknown metadata provider: " + p)
+		}
+	}
+	Config.METADATA = m
+	loadMetadataProviders()
+	err := writeConfig()
+	if err != nil {
+		slog.Error("saveMetadataConfig failed to write config", "error", err)
+		return errors.New("failed to save config")
+	}
+	return nil
+}
+
+// Get from the metadata cache, or `fetch` and cache it.
+// Only errors that won't change (not found, unsupported) are cached,
+// so a provider being down doesn't hide its metadata for a day.
+func cachedMetadata[T any](key string, fetch func() (T, error)) (T, error) {
+	if e, ok := metadataCache.Load(key); ok {
+		entry := e.(metadataCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.value.(T), entry.err
+		}
+	}
+	v, err := fetch()
+	if err == nil || errors.Is(err, metadata.ErrNotFound) || errors.Is(err, metadata.ErrUnsupported) {
+		metadataCache.Store(key, metadataCacheEntry{value: v, err: err, expires: time.Now().Add(metadataCacheTTL)})
+	}
+	return v, err
+}
+
+func cleanupMetadataCache() {
+	now := time.Now()
+	metadataCache.Range(func(k, v any) bool {
+		if now.After(v.(metadataCacheEntry).expires) {
+			metadataCache.Delete(k)
+		}
+		return true
+	})
+}
+
+func metadataIdsKey(ids metadata.ExternalIds) string {
+	return strconv.Itoa(ids.TmdbID) + ":" + strconv.Itoa(ids.TvdbID) + ":" + ids.ImdbID
+}
+
+// TMDB first, then the providers chosen in config.
+func getMetadataChain() []metadata.Provider {
+	return append([]metadata.Provider{tmdbMetadataProvider{}}, getMetadataProviders()...)
+}
+
+// Get details from every provider in the chain, merged together.
+// Earlier providers win for single values, all ratings are kept.
+// Ids found by a provider are used to look the content up in the next.
+func getMetadataDetails(t metadata.ContentType, ids metadata.ExternalIds, language string) metadata.Details {
+	merged := metadata.Details{Type: t, Ids: ids}
+	for _, p := range getMetadataChain() {
+		ids := merged.Ids
+		d, err := cachedMetadata(p.Name()+":details:"+string(t)+":"+metadataIdsKey(ids)+":"+language, func() (metadata.Details, error) {
+			return p.Details(t, ids, language)
+		})
+		if err != nil {
+			if !errors.Is(err, metadata.ErrNotFound) && !errors.Is(err, metadata.ErrUnsupported) {
+				slog.Warn("getMetadataDetails: Provider failed", "provider", p.Name(), "ids", ids, "error", err)
+			}
+			continue
+		}
+		mergeMetadataDetails(&merged, d)
+	}
+	return merged
+}
+
+func mergeMetadataDetails(merged *metadata.Details, d metadata.Details) {
+	if merged.Title == "" {
+		merged.Title = d.Title
+	}
+	if merged.Overview == "" {
+		merged.Overview = d.Overview
+	}
+	if merged.ReleaseDate == "" {
+		merged.ReleaseDate = d.ReleaseDate
+	}
+	if merged.Runtime == 0 {
+		merged.Runtime = d.Runtime
+	}
+	if len(merged.Genres) == 0 {
+		merged.Genres = d.Genres
+	}
+	if merged.PosterURL == "" {
+		merged.PosterURL = d.PosterURL
+	}
+	if merged.Ids.TmdbID == 0 {
+		merged.Ids.TmdbID = d.Ids.TmdbID
+	}
+	if merged.Ids.TvdbID == 0 {
+		merged.Ids.TvdbID = d.Ids.TvdbID
+	}
+	if merged.Ids.ImdbID == "" {
+		merged.Ids.ImdbID = d.Ids.ImdbID
+	}
+	merged.Ratings = append(merged.Ratings, d.Ratings...)
+}
+
+// Get a season from every provider in the chain, merged together.
+// Episodes are matched by number, earlier providers win.
+func getMetadataSeason(tmdbId int, num int, language string) metadata.Season {
+	merged := metadata.Season{Number: num, Episodes: []metadata.Episode{}}
+	tmdb := tmdbMetadataProvider{}
+	ids, err := cachedMetadata(tmdb.Name()+":ids:"+string(metadata.SHOW)+":"+strconv.Itoa(tmdbId), func() (metadata.ExternalIds, error) {
+		return tmdb.ExternalIds(metadata.SHOW, metadata.ExternalIds{TmdbID: tmdbId})
+	})
+	if err != nil {
+		slog.Error("getMetadataSeason: Failed to get show external ids", "tmdb_id", tmdbId, "error", err)
+		ids = metadata.ExternalIds{TmdbID: tmdbId}
+	}
+	for _, p := range getMetadataChain() {
+		s, err := cachedMetadata(p.Name()+":season:"+metadataIdsKey(ids)+":"+strconv.Itoa(num)+":"+language, func() (metadata.Season, error) {
+			return p.Season(ids, num, language)
+		})
+		if err != nil {
+			if !errors.Is(err, metadata.ErrNotFound) && !errors.Is(err, metadata.ErrUnsupported) {
+				slog.Warn("getMetadataSeason: Provider failed", "provider", p.Name(), "ids", ids, "error", err)
+			}
+			continue
+		}
+		for _, e := range s.Episodes {
+			i := slices.IndexFunc(merged.Episodes, func(m metadata.Episode) bool { return m.Number == e.Number })
+			if i == -1 {
+				merged.Episodes = append(merged.Episodes, e)
+				continue
+			}
+			m := &merged.Episodes[i]
+			if m.Name == "" {
+				m.Name = e.Name
+			}
+			if m.Overview == "" {
+				m.Overview = e.Overview
+			}
+			if m.AirDate == "" {
+				m.AirDate = e.AirDate
+			}
+			if m.Runtime == 0 {
+				m.Runtime = e.Runtime
+			}
+		}
+	}
+	return merged
+}
+
+func enrichMovieDetails(m *TMDBMovieDetails, language string) {
+	if len(getMetadataProviders()) == 0 {
+		return
+	}
+	d := getMetadataDetails(metadata.MOVIE, metadata.ExternalIds{TmdbID: m.ID, ImdbID: m.ImdbID}, language)
+	m.Ratings = d.Ratings
+	if m.Overview == "" {
+		m.Overview = d.Overview
+	}
+	if m.Runtime == 0 {
+		m.Runtime = uint32(d.Runtime)
+	}
+}
+
+func enrichShowDetails(s *TMDBShowDetails, language string) {
+	if len(getMetadataProviders()) == 0 {
+		return
+	}
+	ids := metadata.ExternalIds{TmdbID: s.ID, TvdbID: s.ExternalIds.TvdbID, ImdbID: s.ExternalIds.ImdbID}
+	d := getMetadataDetails(metadata.SHOW, ids, language)
+	s.Ratings = d.Ratings
+	if s.Overview == "" {
+		s.Overview = d.Overview
+	}
+	if len(s.EpisodeRunTime) == 0 && d.Runtime != 0 {
+		s.EpisodeRunTime = []int{d.Runtime}
+	}
+}
+
+// Fill in episode names and overviews TMDB doesn't have.
+func enrichSeasonDetails(tmdbId int, season *TMDBSeasonDetails, language string) {
+	if len(getMetadataProviders()) == 0 || len(season.Episodes) == 0 {
+		return
+	}
+	missing := false
+	for _, e := range season.Episodes {
+		if e.Overview == "" || e.Name == "" {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return
+	}
+	s := getMetadataSeason(tmdbId, season.Episodes[0].SeasonNumber, language)
+	for i, e := range season.Episodes {
+		for _, me := range s.Episodes {
+			if me.Number != e.EpisodeNumber {
+				continue
+			}
+			if e.Overview == "" {
+				season.Episodes[i].Overview = me.Overview
+			}
+			if e.Name == "" {
+				season.Episodes[i].Name = me.Name
+			}
+		}
+	}
+}
+
+// TMDB as a metadata provider.
+// Content routes return TMDB responses as they are, this is the first
+// provider in the chain used to fill in what they are missing.
+type tmdbMetadataProvider struct{}
+
+var _ metadata.Provider = tmdbMetadataProvider{}
+
+func (tmdbMetadataProvider) Name() string {
+	return "tmdb"
+}
+
+// Get the TMDB id of content, finding it by its other ids if we don't have it.
+func (tmdbMetadataProvider) getId(t metadata.ContentType, ids metadata.ExternalIds) (int, error) {
+	if ids.TmdbID != 0 {
+		return ids.TmdbID, nil
+	}
+	var externalId, source string
+	if ids.ImdbID != "" {
+		externalId, source = ids.ImdbID, "imdb_id"
+	} else if ids.TvdbID != 0 {
+		externalId, source = strconv.Itoa(ids.TvdbID), "tvdb_id"
+	} else {
+		return 0, metadata.ErrUnsupported
+	}
+	resp := new(TMDBFindResponse)
+	if err := tmdbRequest("/find/"+externalId, map[string]string{"external_source": source}, &resp); err != nil {
+		return 0, err
+	}
+	if t == metadata.MOVIE && len(resp.MovieResults) > 0 {
+		return resp.MovieResults[0].ID, nil
+	}
+	if t == metadata.SHOW && len(resp.TvResults) > 0 {
+		return resp.TvResults[0].ID, nil
+	}
+	return 0, metadata.ErrNotFound
+}
+
+func (tmdbMetadataProvider) Search(query string, language string) ([]metadata.SearchResult, error) {
+	resp, err := searchContent(query, language)
+	if err != nil {
+		return []metadata.SearchResult{}, err
+	}
+	results := []metadata.SearchResult{}
+	for _, r := range resp.Results {
+		if r.MediaType != string(MOVIE) && r.MediaType != string(SHOW) {
+			continue
+		}
+		sr := metadata.SearchResult{
+			Type:      metadata.ContentType(r.MediaType),
+			Title:     r.Title,
+			Overview:  r.Overview,
+			PosterURL: tmdbImageURL(r.PosterPath),
+			Ids:       metadata.ExternalIds{TmdbID: r.ID},
+		}
+		date := r.ReleaseDate
+		if sr.Type == metadata.SHOW {
+			sr.Title = r.Name
+			date = r.FirstAirDate
+		}
+		if len(date) >= 4 {
+			sr.Year, _ = strconv.Atoi(date[:4])
+		}
+		results = append(results, sr)
+	}
+	return results, nil
+}
+
+func (p tmdbMetadataProvider) Details(t metadata.ContentType, ids metadata.ExternalIds, language string) (metadata.Details, error) {
+	id, err := p.getId(t, ids)
+	if err != nil {
+		return metadata.Details{}, err
+	}
+	params := map[string]string{"language": language, "append_to_response": "external_ids"}
+	var (
+		d      = metadata.Details{Type: t}
+		genres []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+	)
+	if t == metadata.MOVIE {
+		m := new(TMDBMovieDetails)
+		if err := tmdbRequest("/movie/"+strconv.Itoa(id), params, &m); err != nil {
+			return metadata.Details{}, err
+		}
+		d.Title = m.Title
+		d.Overview = m.Overview
+		d.ReleaseDate = m.ReleaseDate
+		d.Runtime = int(m.Runtime)
+		d.PosterURL = tmdbImageURL(m.PosterPath)
+		d.Ids = metadata.ExternalIds{TmdbID: m.ID, ImdbID: m.ImdbID}
+		genres = m.Genres
+	} else {
+		s := new(TMDBShowDetails)
+		if err := tmdbRequest("/tv/"+strconv.Itoa(id), params, &s); err != nil {
+			return metadata.Details{}, err
+		}
+		d.Title = s.Name
+		d.Overview = s.Overview
+		d.ReleaseDate = s.FirstAirDate
+		if len(s.EpisodeRunTime) > 0 {
+			d.Runtime = s.EpisodeRunTime[0]
+		}
+		d.PosterURL = tmdbImageURL(s.PosterPath)
+		d.Ids = metadata.ExternalIds{TmdbID: s.ID, TvdbID: s.ExternalIds.TvdbID, ImdbID: s.ExternalIds.ImdbID}
+		genres = s.Genres
+	}
+	for _, g := range genres {
+		d.Genres = append(d.Genres, g.Name)
+	}
+	return d, nil
+}
+
+func (p tmdbMetadataProvider) Season(ids metadata.ExternalIds, season int, language string) (metadata.Season, error) {
+	id, err := p.getId(metadata.SHOW, ids)
+	if err != nil {
+		return metadata.Season{}, err
+	}
+	// Not seasonDetails, it enriches the season from this provider.
+	resp := new(TMDBSeasonDetails)
+	if err := tmdbRequest("/tv/"+strconv.Itoa(id)+"/season/"+strconv.Itoa(season), map[string]string{"language": language}, &resp); err != nil {
+		return metadata.Season{}, err
+	}
+	s := metadata.Season{Number: season, Episodes: []metadata.Episode{}}
+	for _, e := range resp.Episodes {
+		s.Episodes = append(s.Episodes, metadata.Episode{
+			Number:   e.EpisodeNumber,
+			Name:     e.Name,
+			Overview: e.Overview,
+			AirDate:  e.AirDate,
+			Runtime:  e.Runtime,
+		})
+	}
+	return s, nil
+}
+
+func (p tmdbMetadataProvider) Credits(t metadata.ContentType, ids metadata.ExternalIds) ([]metadata.Credit, error) {
+	id, err := p.getId(t, ids)
+	if err != nil {
+		return []metadata.Credit{}, err
+	}
+	resp := new(TMDBContentCredits)
+	if err := tmdbRequest("/"+string(t)+"/"+strconv.Itoa(id)+"/credits", map[string]string{}, &resp); err != nil {
+		return []metadata.Credit{}, err
+	}
+	credits := []metadata.Credit{}
+	for _, c := range resp.Cast {
+		credits = append(credits, metadata.Credit{Name: c.Name, Role: c.Character, Department: "Acting"})
+	}
+	for _, c := range resp.Crew {
+		if c.Department == "Directing" || c.Department == "Writing" {
+			credits = append(credits, metadata.Credit{Name: c.Name, Role: c.Job, Department: c.Department})
+		}
+	}
+	return credits, nil
+}
+
+func (p tmdbMetadataProvider) ExternalIds(t metadata.ContentType, ids metadata.ExternalIds) (metadata.ExternalIds, error) {
+	id, err := p.getId(t, ids)
+	if err != nil {
+		return metadata.ExternalIds{}, err
+	}
+	resp := new(TMDBExternalIdsShow)
+	if err := tmdbRequest("/"+string(t)+"/"+strconv.Itoa(id)+"/external_ids", map[string]string{}, &resp); err != nil {
+		return metadata.ExternalIds{}, err
+	}
+	return metadata.ExternalIds{TmdbID: id, TvdbID: resp.TvdbID, ImdbID: resp.ImdbID}, nil
+}
+
+func tmdbImageURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	return "https://image.tmdb.org/t/p/w500" + path
+}
@@ -0,0 +1,138 @@
+// Metadata providers.
+// TMDB is Watcharrs main source of metadata, other providers (TVDB,
+// OMDb) implement a shared interface so they can be used to fill in
+// what TMDB is missing, or add extra info (eg IMDb ratings).
+
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type ContentType string
+
+const (
+	MOVIE ContentType = "movie"
+	SHOW  ContentType = "tv"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// Returned when a provider can't do what was asked, eg
+	// OMDb can only look content up by its IMDb id.
+	ErrUnsupported = errors.New("not supported by provider")
+)
+
+// Ids of content with the different providers, 0/empty when unknown.
+type ExternalIds struct {
+	TmdbID int    `json:"tmdbId,omitempty"`
+	TvdbID int    `json:"tvdbId,omitempty"`
+	ImdbID string `json:"imdbId,omitempty"`
+}
+
+type SearchResult struct {
+	Type      ContentType `json:"type"`
+	Title     string      `json:"title"`
+	Year      int         `json:"year,omitempty"`
+	Overview  string      `json:"overview,omitempty"`
+	PosterURL string      `json:"posterUrl,omitempty"`
+	Ids       ExternalIds `json:"ids"`
+}
+
+type Rating struct {
+	// Where the rating is from (eg `IMDb`, `Rotten Tomatoes`).
+	Source string `json:"source"`
+	// As the source shows it (eg `8.8/10` or `94%`).
+	Value string `json:"value"`
+	Votes int    `json:"votes,omitempty"`
+}
+
+type Details struct {
+	Type     ContentType `json:"type"`
+	Title    string      `json:"title"`
+	Overview string      `json:"overview,omitempty"`
+	// YYYY-MM-DD
+	ReleaseDate string `json:"releaseDate,omitempty"`
+	// In minutes, of an episode for shows.
+	Runtime   int         `json:"runtime,omitempty"`
+	Genres    []string    `json:"genres,omitempty"`
+	PosterURL string      `json:"posterUrl,omitempty"`
+	Ratings   []Rating    `json:"ratings,omitempty"`
+	Ids       ExternalIds `json:"ids"`
+}
+
+type Episode struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Overview string `json:"overview,omitempty"`
+	// YYYY-MM-DD
+	AirDate string `json:"airDate,omitempty"`
+	Runtime int    `json:"runtime,omitempty"`
+}
+
+type Season struct {
+	Number   int       `json:"number"`
+	Episodes []Episode `json:"episodes"`
+}
+
+type Credit struct {
+	Name string `json:"name"`
+	// Character for actors, job for crew.
+	Role string `json:"role,omitempty"`
+	// `Acting`, `Directing` or `Writing`.
+	Department string `json:"department"`
+}
+
+type Provider interface {
+	// Name used to choose the provider in config (eg `tvdb`).
+	Name() string
+	Search(query string, language string) ([]SearchResult, error)
+	Details(t ContentType, ids ExternalIds, language string) (Details, error)
+	Season(ids ExternalIds, season int, language string) (Season, error)
+	Credits(t ContentType, ids ExternalIds) ([]Credit, error)
+	// Get all the ids the provider knows of for content.
+	ExternalIds(t ContentType, ids ExternalIds) (ExternalIds, error)
+}
+
+// Returned when a provider responds with a non 2xx status.
+type Error struct {
+	Provider   string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s responded with status %d", e.Provider, e.StatusCode)
+}
+
+// Lets `errors.Is(err, ErrNotFound)` match 404 responses.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Run `req`, decoding the json response into `resp`.
+func do(provider string, req *http.Request, resp interface{}) error {
+	slog.Debug("metadata request", "provider", provider, "method", req.Method, "path", req.URL.Path)
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		slog.Debug("metadata non 2xx status code", "provider", provider, "status_code", res.StatusCode, "body", string(data))
+		return &Error{Provider: provider, StatusCode: res.StatusCode}
+	}
+	return json.Unmarshal(data, resp)
+}
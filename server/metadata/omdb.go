@@ -0,0 +1,252 @@
+package metadata
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const omdbHost = "https://www.omdbapi.com/"
+
+// OMDb, mostly useful for its IMDb, Rotten Tomatoes and Metacritic ratings.
+// Content can only be looked up by IMDb id, and only in english.
+type OMDb struct {
+	Key string
+	// Defaults to omdbHost.
+	Host string
+}
+
+type omdbContent struct {
+	Title      string `json:"Title"`
+	Year       string `json:"Year"`
+	Released   string `json:"Released"`
+	Runtime    string `json:"Runtime"`
+	Genre      string `json:"Genre"`
+	Director   string `json:"Director"`
+	Writer     string `json:"Writer"`
+	Actors     string `json:"Actors"`
+	Plot       string `json:"Plot"`
+	Poster     string `json:"Poster"`
+	ImdbRating string `json:"imdbRating"`
+	ImdbVotes  string `json:"imdbVotes"`
+	ImdbID     string `json:"imdbID"`
+	Type       string `json:"Type"`
+	Ratings    []struct {
+		Source string `json:"Source"`
+		Value  string `json:"Value"`
+	} `json:"Ratings"`
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+type omdbSearch struct {
+	Search []struct {
+		Title  string `json:"Title"`
+		Year   string `json:"Year"`
+		ImdbID string `json:"imdbID"`
+		Type   string `json:"Type"`
+		Poster string `json:"Poster"`
+	} `json:"Search"`
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+type omdbSeason struct {
+	Season   string `json:"Season"`
+	Episodes []struct {
+		Title    string `json:"Title"`
+		Released string `json:"Released"`
+		Episode  string `json:"Episode"`
+	} `json:"Episodes"`
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+func NewOMDb(key string) *OMDb {
+	return &OMDb{Key: key, Host: omdbHost}
+}
+
+func (o *OMDb) Name() string {
+	return "omdb"
+}
+
+func (o *OMDb) req(p map[string]string, resp interface{}) error {
+	base, err := url.Parse(o.Host)
+	if err != nil {
+		return errors.New("failed to parse api uri")
+	}
+	params := url.Values{}
+	params.Add("apikey", o.Key)
+	for k, v := range p {
+		params.Add(k, v)
+	}
+	base.RawQuery = params.Encode()
+	req, err := http.NewRequest(http.MethodGet, base.String(), nil)
+	if err != nil {
+		return err
+	}
+	return do("omdb", req, resp)
+}
+
+// OMDb responds with 200s for errors, with Response set to `False`.
+func omdbError(response string, msg string) error {
+	if response != "False" {
+		return nil
+	}
+	if strings.Contains(msg, "not found") {
+		return ErrNotFound
+	}
+	return errors.New("omdb: " + msg)
+}
+
+func (o *OMDb) get(ids ExternalIds) (omdbContent, error) {
+	if ids.ImdbID == "" {
+		return omdbContent{}, ErrUnsupported
+	}
+	var resp omdbContent
+	if err := o.req(map[string]string{"i": ids.ImdbID, "plot": "full"}, &resp); err != nil {
+		return omdbContent{}, err
+	}
+	if err := omdbError(resp.Response, resp.Error); err != nil {
+		return omdbContent{}, err
+	}
+	return resp, nil
+}
+
+func (o *OMDb) Search(query string, language string) ([]SearchResult, error) {
+	var resp omdbSearch
+	if err := o.req(map[string]string{"s": query}, &resp); err != nil {
+		return []SearchResult{}, err
+	}
+	if err := omdbError(resp.Response, resp.Error); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return []SearchResult{}, nil
+		}
+		return []SearchResult{}, err
+	}
+	results := []SearchResult{}
+	for _, r := range resp.Search {
+		t := omdbType(r.Type)
+		if t == "" {
+			continue
+		}
+		results = append(results, SearchResult{
+			Type:      t,
+			Title:     r.Title,
+			Year:      omdbYear(r.Year),
+			PosterURL: omdbValue(r.Poster),
+			Ids:       ExternalIds{ImdbID: r.ImdbID},
+		})
+	}
+	return results, nil
+}
+
+func (o *OMDb) Details(t ContentType, ids ExternalIds, language string) (Details, error) {
+	c, err := o.get(ids)
+	if err != nil {
+		return Details{}, err
+	}
+	d := Details{
+		Type:      t,
+		Title:     c.Title,
+		Overview:  omdbValue(c.Plot),
+		PosterURL: omdbValue(c.Poster),
+		Ids:       ExternalIds{ImdbID: c.ImdbID},
+	}
+	if r, err := time.Parse("02 Jan 2006", c.Released); err == nil {
+		d.ReleaseDate = r.Format("2006-01-02")
+	}
+	if rt, _, ok := strings.Cut(c.Runtime, " "); ok {
+		d.Runtime, _ = strconv.Atoi(rt)
+	}
+	if g := omdbValue(c.Genre); g != "" {
+		d.Genres = strings.Split(g, ", ")
+	}
+	for _, r := range c.Ratings {
+		rating := Rating{Source: r.Source, Value: r.Value}
+		if r.Source == "Internet Movie Database" {
+			rating.Source = "IMDb"
+			rating.Votes, _ = strconv.Atoi(strings.ReplaceAll(c.ImdbVotes, ",", ""))
+		}
+		d.Ratings = append(d.Ratings, rating)
+	}
+	return d, nil
+}
+
+func (o *OMDb) Season(ids ExternalIds, season int, language string) (Season, error) {
+	if ids.ImdbID == "" {
+		return Season{}, ErrUnsupported
+	}
+	var resp omdbSeason
+	if err := o.req(map[string]string{"i": ids.ImdbID, "Season": strconv.Itoa(season)}, &resp); err != nil {
+		return Season{}, err
+	}
+	if err := omdbError(resp.Response, resp.Error); err != nil {
+		return Season{}, err
+	}
+	s := Season{Number: season, Episodes: []Episode{}}
+	for _, e := range resp.Episodes {
+		num, _ := strconv.Atoi(e.Episode)
+		s.Episodes = append(s.Episodes, Episode{Number: num, Name: e.Title, AirDate: omdbValue(e.Released)})
+	}
+	return s, nil
+}
+
+func (o *OMDb) Credits(t ContentType, ids ExternalIds) ([]Credit, error) {
+	c, err := o.get(ids)
+	if err != nil {
+		return []Credit{}, err
+	}
+	credits := []Credit{}
+	add := func(names string, department string) {
+		for _, n := range strings.Split(omdbValue(names), ", ") {
+			if n == "" {
+				continue
+			}
+			// Writers can come with their role (eg `Jonathan Nolan (story)`).
+			name, role, _ := strings.Cut(n, " (")
+			credits = append(credits, Credit{Name: name, Role: strings.TrimSuffix(role, ")"), Department: department})
+		}
+	}
+	add(c.Actors, "Acting")
+	add(c.Director, "Directing")
+	add(c.Writer, "Writing")
+	return credits, nil
+}
+
+func (o *OMDb) ExternalIds(t ContentType, ids ExternalIds) (ExternalIds, error) {
+	if ids.ImdbID == "" {
+		return ExternalIds{}, ErrUnsupported
+	}
+	return ExternalIds{ImdbID: ids.ImdbID}, nil
+}
+
+func omdbType(t string) ContentType {
+	switch t {
+	case "movie":
+		return MOVIE
+	case "series":
+		return SHOW
+	}
+	return ""
+}
+
+// OMDb uses `N/A` for missing values.
+func omdbValue(v string) string {
+	if v == "N/A" {
+		return ""
+	}
+	return v
+}
+
+// Years can be ranges for shows (eg `2008–2013`), the first is used.
+func omdbYear(y string) int {
+	if len(y) < 4 {
+		return 0
+	}
+	v, _ := strconv.Atoi(y[:4])
+	return v
+}
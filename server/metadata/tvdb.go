@@ -0,0 +1,317 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tvdbHost = "https://api4.thetvdb.com/v4"
+
+// TVDB (v4 api). Only its default (english) translations are used.
+type TVDB struct {
+	Key string
+	// Only needed for user subscription keys.
+	Pin string
+	// Defaults to tvdbHost.
+	Host string
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+type tvdbResponse[T any] struct {
+	Data T `json:"data"`
+}
+
+type tvdbRemoteId struct {
+	ID         string `json:"id"`
+	SourceName string `json:"sourceName"`
+}
+
+type tvdbContent struct {
+	ID             int            `json:"id"`
+	Name           string         `json:"name"`
+	Overview       string         `json:"overview"`
+	Image          string         `json:"image"`
+	FirstAired     string         `json:"firstAired"`
+	AverageRuntime int            `json:"averageRuntime"`
+	Runtime        int            `json:"runtime"`
+	RemoteIds      []tvdbRemoteId `json:"remoteIds"`
+	Genres         []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	Characters []struct {
+		Name       string `json:"name"`
+		PersonName string `json:"personName"`
+		PeopleType string `json:"peopleType"`
+	} `json:"characters"`
+	FirstRelease struct {
+		Date string `json:"date"`
+	} `json:"first_release"`
+}
+
+func NewTVDB(key string, pin string) *TVDB {
+	return &TVDB{Key: key, Pin: pin, Host: tvdbHost}
+}
+
+func (t *TVDB) Name() string {
+	return "tvdb"
+}
+
+// Get a token, logging in if we don't have one or it has expired.
+// Tokens last a month, we get a new one a bit before that.
+func (t *TVDB) getToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.tokenExpires) {
+		return t.token, nil
+	}
+	body, err := json.Marshal(map[string]string{"apikey": t.Key, "pin": t.Pin})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.Host+"/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp tvdbResponse[struct {
+		Token string `json:"token"`
+	}]
+	if err := do("tvdb", req, &resp); err != nil {
+		return "", err
+	}
+	t.token = resp.Data.Token
+	t.tokenExpires = time.Now().Add(25 * 24 * time.Hour)
+	return t.token, nil
+}
+
+func (t *TVDB) req(ep string, p map[string]string, resp interface{}) error {
+	token, err := t.getToken()
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(t.Host + ep)
+	if err != nil {
+		return errors.New("failed to parse api uri")
+	}
+	params := url.Values{}
+	for k, v := range p {
+		params.Add(k, v)
+	}
+	base.RawQuery = params.Encode()
+	req, err := http.NewRequest(http.MethodGet, base.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	err = do("tvdb", req, resp)
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusUnauthorized {
+		// Token was revoked, login again next time.
+		t.mu.Lock()
+		t.token = ""
+		t.mu.Unlock()
+	}
+	return err
+}
+
+// Get the tvdb id of content, looking it up by its IMDb id if we don't have it.
+func (t *TVDB) getId(ct ContentType, ids ExternalIds) (int, error) {
+	if ids.TvdbID != 0 {
+		return ids.TvdbID, nil
+	}
+	if ids.ImdbID == "" {
+		return 0, ErrUnsupported
+	}
+	var resp tvdbResponse[[]struct {
+		Series *struct {
+			ID int `json:"id"`
+		} `json:"series"`
+		Movie *struct {
+			ID int `json:"id"`
+		} `json:"movie"`
+	}]
+	if err := t.req("/search/remoteid/"+url.PathEscape(ids.ImdbID), nil, &resp); err != nil {
+		return 0, err
+	}
+	for _, r := range resp.Data {
+		if ct == SHOW && r.Series != nil {
+			return r.Series.ID, nil
+		}
+		if ct == MOVIE && r.Movie != nil {
+			return r.Movie.ID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (t *TVDB) get(ct ContentType, ids ExternalIds, short bool) (tvdbContent, error) {
+	id, err := t.getId(ct, ids)
+	if err != nil {
+		return tvdbContent{}, err
+	}
+	ep := "/series/"
+	if ct == MOVIE {
+		ep = "/movies/"
+	}
+	p := map[string]string{}
+	if short {
+		p["short"] = "true"
+	}
+	var resp tvdbResponse[tvdbContent]
+	if err := t.req(ep+strconv.Itoa(id)+"/extended", p, &resp); err != nil {
+		return tvdbContent{}, err
+	}
+	return resp.Data, nil
+}
+
+func (t *TVDB) Search(query string, language string) ([]SearchResult, error) {
+	var resp tvdbResponse[[]struct {
+		TvdbID    string         `json:"tvdb_id"`
+		Type      string         `json:"type"`
+		Name      string         `json:"name"`
+		Year      string         `json:"year"`
+		Overview  string         `json:"overview"`
+		ImageURL  string         `json:"image_url"`
+		RemoteIds []tvdbRemoteId `json:"remote_ids"`
+	}]
+	if err := t.req("/search", map[string]string{"query": query, "limit": "20"}, &resp); err != nil {
+		return []SearchResult{}, err
+	}
+	results := []SearchResult{}
+	for _, r := range resp.Data {
+		var ct ContentType
+		switch r.Type {
+		case "series":
+			ct = SHOW
+		case "movie":
+			ct = MOVIE
+		default:
+			continue
+		}
+		ids := tvdbExternalIds(r.RemoteIds)
+		ids.TvdbID, _ = strconv.Atoi(r.TvdbID)
+		year, _ := strconv.Atoi(r.Year)
+		results = append(results, SearchResult{
+			Type:      ct,
+			Title:     r.Name,
+			Year:      year,
+			Overview:  r.Overview,
+			PosterURL: r.ImageURL,
+			Ids:       ids,
+		})
+	}
+	return results, nil
+}
+
+func (t *TVDB) Details(ct ContentType, ids ExternalIds, language string) (Details, error) {
+	c, err := t.get(ct, ids, true)
+	if err != nil {
+		return Details{}, err
+	}
+	d := Details{
+		Type:        ct,
+		Title:       c.Name,
+		Overview:    c.Overview,
+		ReleaseDate: c.FirstAired,
+		Runtime:     c.AverageRuntime,
+		PosterURL:   c.Image,
+		Ids:         tvdbExternalIds(c.RemoteIds),
+	}
+	d.Ids.TvdbID = c.ID
+	if ct == MOVIE {
+		d.ReleaseDate = c.FirstRelease.Date
+		d.Runtime = c.Runtime
+	}
+	for _, g := range c.Genres {
+		d.Genres = append(d.Genres, g.Name)
+	}
+	return d, nil
+}
+
+func (t *TVDB) Season(ids ExternalIds, season int, language string) (Season, error) {
+	id, err := t.getId(SHOW, ids)
+	if err != nil {
+		return Season{}, err
+	}
+	var resp tvdbResponse[struct {
+		Episodes []struct {
+			Number   int    `json:"number"`
+			Name     string `json:"name"`
+			Overview string `json:"overview"`
+			Aired    string `json:"aired"`
+			Runtime  int    `json:"runtime"`
+		} `json:"episodes"`
+	}]
+	err = t.req("/series/"+strconv.Itoa(id)+"/episodes/default", map[string]string{"season": strconv.Itoa(season), "page": "0"}, &resp)
+	if err != nil {
+		return Season{}, err
+	}
+	s := Season{Number: season, Episodes: []Episode{}}
+	for _, e := range resp.Data.Episodes {
+		s.Episodes = append(s.Episodes, Episode{
+			Number:   e.Number,
+			Name:     e.Name,
+			Overview: e.Overview,
+			AirDate:  e.Aired,
+			Runtime:  e.Runtime,
+		})
+	}
+	return s, nil
+}
+
+func (t *TVDB) Credits(ct ContentType, ids ExternalIds) ([]Credit, error) {
+	c, err := t.get(ct, ids, false)
+	if err != nil {
+		return []Credit{}, err
+	}
+	credits := []Credit{}
+	for _, ch := range c.Characters {
+		cr := Credit{Name: ch.PersonName, Role: ch.PeopleType}
+		switch ch.PeopleType {
+		case "Actor", "Guest Star":
+			cr.Department = "Acting"
+			cr.Role = ch.Name
+		case "Director":
+			cr.Department = "Directing"
+		case "Writer":
+			cr.Department = "Writing"
+		default:
+			continue
+		}
+		credits = append(credits, cr)
+	}
+	return credits, nil
+}
+
+func (t *TVDB) ExternalIds(ct ContentType, ids ExternalIds) (ExternalIds, error) {
+	c, err := t.get(ct, ids, true)
+	if err != nil {
+		return ExternalIds{}, err
+	}
+	e := tvdbExternalIds(c.RemoteIds)
+	e.TvdbID = c.ID
+	return e, nil
+}
+
+func tvdbExternalIds(remoteIds []tvdbRemoteId) ExternalIds {
+	var ids ExternalIds
+	for _, r := range remoteIds {
+		switch {
+		case r.SourceName == "IMDB":
+			ids.ImdbID = r.ID
+		case strings.HasPrefix(r.SourceName, "TheMovieDB"):
+			ids.TmdbID, _ = strconv.Atoi(r.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sbondCo/Watcharr/metadata"
+)
+
+// Provider that returns canned responses, recording the ids it was asked for.
+type fakeMetadataProvider struct {
+	details metadata.Details
+	season  metadata.Season
+	err     error
+	gotIds  *metadata.ExternalIds
+}
+
+func (fakeMetadataProvider) Name() string { return "fake" }
+
+func (p fakeMetadataProvider) Search(query string, language string) ([]metadata.SearchResult, error) {
+	return []metadata.SearchResult{}, metadata.ErrUnsupported
+}
+
+func (p fakeMetadataProvider) Details(t metadata.ContentType, ids metadata.ExternalIds, language string) (metadata.Details, error) {
+	*p.gotIds = ids
+	return p.details, p.err
+}
+
+func (p fakeMetadataProvider) Season(ids metadata.ExternalIds, season int, language string) (metadata.Season, error) {
+	*p.gotIds = ids
+	return p.season, p.err
+}
+
+func (p fakeMetadataProvider) Credits(t metadata.ContentType, ids metadata.ExternalIds) ([]metadata.Credit, error) {
+	return []metadata.Credit{}, metadata.ErrUnsupported
+}
+
+func (p fakeMetadataProvider) ExternalIds(t metadata.ContentType, ids metadata.ExternalIds) (metadata.ExternalIds, error) {
+	return ids, nil
+}
+
+// Point TMDB at `responses` (by path) and use `p` as the only other provider.
+func setupMetadataChain(t *testing.T, responses map[string]string, p metadata.Provider) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	oldBaseURL := Config.TMDB_BASE_URL
+	Config.TMDB_BASE_URL = srv.URL
+	metadataProvidersMutex.Lock()
+	metadataProviders = []metadata.Provider{p}
+	metadataProvidersMutex.Unlock()
+	t.Cleanup(func() {
+		srv.Close()
+		Config.TMDB_BASE_URL = oldBaseURL
+		loadMetadataProviders()
+	})
+}
+
+func TestGetMetadataDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		tmdb     string
+		provider fakeMetadataProvider
+		want     metadata.Details
+		// Ids the provider should be asked for.
+		wantIds metadata.ExternalIds
+	}{
+		{
+			name: "provider fills in what tmdb is missing",
+			tmdb: `{"id": 1396, "name": "Breaking Bad", "first_air_date": "2008-01-20", "external_ids": {"tvdb_id": 81189, "imdb_id": "tt0903747"}}`,
+			provider: fakeMetadataProvider{details: metadata.Details{
+				Title:    "Breaking Bad (TVDB)",
+				Overview: "A teacher",
+				Runtime:  47,
+				Ratings:  []metadata.Rating{{Source: "IMDb", Value: "9.5/10"}},
+			}},
+			want: metadata.Details{
+				Type:        metadata.SHOW,
+				Title:       "Breaking Bad",
+				Overview:    "A teacher",
+				ReleaseDate: "2008-01-20",
+				Runtime:     47,
+				Ratings:     []metadata.Rating{{Source: "IMDb", Value: "9.5/10"}},
+				Ids:         metadata.ExternalIds{TmdbID: 1396, TvdbID: 81189, ImdbID: "tt0903747"},
+			},
+			wantIds: metadata.ExternalIds{TmdbID: 1396, TvdbID: 81189, ImdbID: "tt0903747"},
+		},
+		{
+			name:     "failing provider is skipped",
+			tmdb:     `{"id": 1396, "name": "Breaking Bad", "overview": "From TMDB", "external_ids": {"tvdb_id": 81189}}`,
+			provider: fakeMetadataProvider{err: metadata.ErrNotFound},
+			want: metadata.Details{
+				Type:     metadata.SHOW,
+				Title:    "Breaking Bad",
+				Overview: "From TMDB",
+				Ids:      metadata.ExternalIds{TmdbID: 1396, TvdbID: 81189},
+			},
+			wantIds: metadata.ExternalIds{TmdbID: 1396, TvdbID: 81189},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIds metadata.ExternalIds
+			tt.provider.gotIds = &gotIds
+			setupMetadataChain(t, map[string]string{"/tv/1396": tt.tmdb}, tt.provider)
+
+			got := getMetadataDetails(metadata.SHOW, metadata.ExternalIds{TmdbID: 1396}, "en-US")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getMetadataDetails() = %+v, want %+v", got, tt.want)
+			}
+			if gotIds != tt.wantIds {
+				t.Errorf("provider asked for %+v, want %+v", gotIds, tt.wantIds)
+			}
+		})
+	}
+}
+
+func TestGetMetadataSeason(t *testing.T) {
+	var gotIds metadata.ExternalIds
+	setupMetadataChain(t, map[string]string{
+		"/tv/1396/external_ids": `{"tvdb_id": 81189, "imdb_id": "tt0903747"}`,
+		"/tv/1396/season/1":     `{"episodes": [{"episode_number": 1, "name": "Pilot", "season_number": 1}, {"episode_number": 2, "name": "", "overview": "From TMDB", "season_number": 1}]}`,
+	}, fakeMetadataProvider{gotIds: &gotIds, season: metadata.Season{Number: 1, Episodes: []metadata.Episode{
+		{Number: 1, Name: "Pilot (TVDB)", Overview: "Walt..."},
+		{Number: 2, Name: "Cat's in the Bag...", Overview: "From TVDB"},
+		{Number: 3, Name: "...And the Bag's in the River"},
+	}}})
+
+	got := getMetadataSeason(1396, 1, "en-US")
+	want := metadata.Season{Number: 1, Episodes: []metadata.Episode{
+		{Number: 1, Name: "Pilot", Overview: "Walt..."},
+		{Number: 2, Name: "Cat's in the Bag...", Overview: "From TMDB"},
+		{Number: 3, Name: "...And the Bag's in the River"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getMetadataSeason() = %+v, want %+v", got, want)
+	}
+	if wantIds := (metadata.ExternalIds{TmdbID: 1396, TvdbID: 81189, ImdbID: "tt0903747"}); gotIds != wantIds {
+		t.Errorf("provider asked for %+v, want %+v", gotIds, wantIds)
+	}
+}
@@ -4,17 +4,18 @@ import (
 	"log/slog"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Location middleware
-func WhereaboutsRequired() gin.HandlerFunc {
-	// TODO: This should also take into account a user
-	// preference (of location.. which also needs to be
-	// added) and server preference (env var). The US is
-	// good enough for now as a default.
+// Sets the users language and country (their preference,
+// or the servers default). Must be used after AuthRequired.
+func WhereaboutsRequired(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		slog.Debug("WhereaboutsRequired middleware hit", "country", "US")
-		c.Set("userCountry", "US")
+		language, country := getUserWhereabouts(db, c.GetUint("userId"))
+		slog.Debug("WhereaboutsRequired middleware hit", "language", language, "country", country)
+		c.Set("userLanguage", language)
+		c.Set("userCountry", country)
 		c.Next()
 	}
 }
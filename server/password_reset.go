@@ -0,0 +1,268 @@
+// Self-service password reset for Watcharr users.
+// A reset creates a one use token, which is handed to the user
+// inside a signed link (by email, or by an admin when smtp isn't setup).
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+type PasswordResetConfirmRequest struct {
+	// Token from the reset link.
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// A reset link that can be handed to a user by an admin.
+type PasswordResetLink struct {
+	UserID    uint      `json:"userId"`
+	Username  string    `json:"username"`
+	Link      string    `json:"link"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+const (
+	passwordResetTokenAge = time.Hour
+	// Minimum time between reset requests for the same user.
+	passwordResetThrottle = time.Minute
+	passwordResetAudience = "password_reset"
+	// Appended to our jwt secrets when signing reset links, so a reset
+	// link can never be used as an auth token (and vice versa).
+	passwordResetKeySuffix = ":password_reset"
+)
+
+// Keyfunc for parsing reset link tokens.
+func getPasswordResetVerificationKey(token *jwt.Token) (interface{}, error) {
+	// Reset tokens have always had a kid, don't accept legacy ones.
+	if kid, ok := token.Header["kid"].(string); !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, err := getJWTVerificationKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return append(key.([]byte), []byte(passwordResetKeySuffix)...), nil
+}
+
+func signPasswordResetToken(userId uint, nonce string, expiresAt time.Time) (string, error) {
+	jwtSecretsMutex.RLock()
+	defer jwtSecretsMutex.RUnlock()
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userId), 10),
+		ID:        nonce,
+		Audience:  jwt.ClaimStrings{passwordResetAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "watcharr",
+	})
+	t.Header["kid"] = Config.JWT_SECRET_ID
+	return t.SignedString([]byte(Config.JWT_SECRET + passwordResetKeySuffix))
+}
+
+func buildPasswordResetLink(baseUrl string, token string) string {
+	return baseUrl + "/reset_password?token=" + url.QueryEscape(token)
+}
+
+// Get the url users reach Watcharr at.
+// PUBLIC_URL is preferred, otherwise the url of the current request is used.
+// Should only be used for links shown to admins, since request headers can be
+// spoofed by anyone.
+func getRequestPublicURL(c *gin.Context) string {
+	if Config.PUBLIC_URL != "" {
+		return Config.PUBLIC_URL
+	}
+	if origin := c.GetHeader("Origin"); origin != "" {
+		return origin
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// Create a reset token for a user and sign a link for it.
+func createPasswordResetLink(db *gorm.DB, user User, baseUrl string) (PasswordResetLink, error) {
+	nonce, err := createOneUseTokenWithExpiry(db, TOKENTYPE_PASSWORD_RESET, user.ID, passwordResetTokenAge)
+	if err != nil {
+		return PasswordResetLink{}, err
+	}
+	expiresAt := time.Now().Add(passwordResetTokenAge)
+	signed, err := signPasswordResetToken(user.ID, nonce, expiresAt)
+	if err != nil {
+		slog.Error("createPasswordResetLink: Failed to sign reset token", "user_id", user.ID, "error", err)
+		return PasswordResetLink{}, errors.New("failed to sign reset token")
+	}
+	return PasswordResetLink{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Link:      buildPasswordResetLink(baseUrl, signed),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Handle a user requesting a password reset.
+// Always succeeds (unless something actually broke), so it can't
+// be used to find out which users exist.
+func requestPasswordReset(db *gorm.DB, rr PasswordResetRequest) error {
+	user, _, err := getIdentityUser(db, WATCHARR_USER, rr.Username)
+	if err != nil {
+		slog.Info("requestPasswordReset: User not found", "username", rr.Username)
+		return nil
+	}
+	if user.Disabled {
+		slog.Info("requestPasswordReset: User is disabled", "user_id", user.ID)
+		return nil
+	}
+	var recent int64
+	res := db.Model(&Token{}).
+		Where("type = ? AND user_id = ? AND created_at > ?", TOKENTYPE_PASSWORD_RESET, user.ID, time.Now().Add(-passwordResetThrottle)).
+		Count(&recent)
+	if res.Error != nil {
+		slog.Error("requestPasswordReset: Failed to count recent reset tokens", "user_id", user.ID, "error", res.Error)
+		return errors.New("failed to request password reset")
+	}
+	if recent > 0 {
+		slog.Info("requestPasswordReset: User requested a reset too recently, ignoring", "user_id", user.ID)
+		return nil
+	}
+	// We don't trust the request for our url, so only
+	// email links if we know our PUBLIC_URL.
+	if !Config.SMTP.IsConfigured() || user.Email == "" || Config.PUBLIC_URL == "" {
+		// Create token anyways, so an admin can hand the link over.
+		if _, err := createOneUseTokenWithExpiry(db, TOKENTYPE_PASSWORD_RESET, user.ID, passwordResetTokenAge); err != nil {
+			return errors.New("failed to request password reset")
+		}
+		slog.Info("Password reset requested, but it could not be emailed (smtp, PUBLIC_URL or the users email isn't configured). An admin can get the reset link from the admin panel.", "user_id", user.ID, "username", user.Username)
+		return nil
+	}
+	link, err := createPasswordResetLink(db, user, Config.PUBLIC_URL)
+	if err != nil {
+		return errors.New("failed to request password reset")
+	}
+	body := "Hi " + user.Username + ",\n\n" +
+		"A password reset was requested for your Watcharr account. Open the link below to choose a new password:\n\n" +
+		link.Link + "\n\n" +
+		"This link expires in 1 hour. If you didn't request this, you can ignore this email."
+	if err := sendEmail(user.Email, "Watcharr password reset", body); err != nil {
+		return errors.New("failed to send password reset email")
+	}
+	slog.Info("requestPasswordReset: Reset link emailed to user", "user_id", user.ID)
+	return nil
+}
+
+// Get reset links for all pending reset requests.
+func getPendingPasswordResets(db *gorm.DB, baseUrl string) ([]PasswordResetLink, error) {
+	tokens := []Token{}
+	res := db.Where("type = ? AND expires_at > ?", TOKENTYPE_PASSWORD_RESET, time.Now()).Order("created_at DESC").Find(&tokens)
+	if res.Error != nil {
+		slog.Error("getPendingPasswordResets: Failed to get reset tokens", "error", res.Error)
+		return []PasswordResetLink{}, errors.New("failed to get password resets")
+	}
+	links := []PasswordResetLink{}
+	for _, t := range tokens {
+		var user User
+		if res := db.Select("id", "username").Where("id = ?", t.UserID).Take(&user); res.Error != nil {
+			slog.Error("getPendingPasswordResets: Failed to get user for token", "user_id", t.UserID, "error", res.Error)
+			continue
+		}
+		signed, err := signPasswordResetToken(t.UserID, t.Value, *t.ExpiresAt)
+		if err != nil {
+			slog.Error("getPendingPasswordResets: Failed to sign reset token", "user_id", t.UserID, "error", err)
+			continue
+		}
+		links = append(links, PasswordResetLink{
+			UserID:    t.UserID,
+			Username:  user.Username,
+			Link:      buildPasswordResetLink(baseUrl, signed),
+			ExpiresAt: *t.ExpiresAt,
+		})
+	}
+	return links, nil
+}
+
+// Create a reset link for a user, for an admin to hand over.
+func adminCreatePasswordResetLink(db *gorm.DB, userId uint, baseUrl string) (PasswordResetLink, error) {
+	user, err := getUserForAdmin(db, userId)
+	if err != nil {
+		return PasswordResetLink{}, err
+	}
+	if !userHasPassword(db, user.ID) {
+		return PasswordResetLink{}, errors.New("only watcharr users have a password to reset")
+	}
+	return createPasswordResetLink(db, user, baseUrl)
+}
+
+// Set a new password for the user a reset link was created for.
+func resetPassword(db *gorm.DB, rr PasswordResetConfirmRequest) error {
+	token, err := jwt.ParseWithClaims(
+		rr.Token,
+		&jwt.RegisteredClaims{},
+		getPasswordResetVerificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(passwordResetAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		slog.Info("resetPassword failed", "error", "failed to parse token", "parse_error", err)
+		return errors.New("invalid or expired reset link")
+	}
+	claims := token.Claims.(*jwt.RegisteredClaims)
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		slog.Info("resetPassword failed", "error", "invalid subject in token")
+		return errors.New("invalid or expired reset link")
+	}
+	var dbToken Token
+	res := db.Where("value = ? AND type = ? AND user_id = ? AND expires_at > ?", claims.ID, TOKENTYPE_PASSWORD_RESET, userId, time.Now()).Take(&dbToken)
+	if res.Error != nil {
+		slog.Info("resetPassword failed", "error", "token not found in db (may have been used already)", "user_id", userId)
+		return errors.New("invalid or expired reset link")
+	}
+	user, err := getUserForAdmin(db, uint(userId))
+	if err != nil {
+		return errors.New("invalid or expired reset link")
+	}
+	if user.Disabled {
+		slog.Info("resetPassword failed", "error", "user is disabled", "user_id", userId)
+		return errors.New("account disabled")
+	}
+	hash, err := hashPassword(rr.NewPassword, GetPassArgonParams())
+	if err != nil {
+		slog.Error("resetPassword failed - failed to hash new password", "user_id", userId, "error", err)
+		return errors.New("failed to hash new password")
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{"password": hash, "password_reset_required": false}).Error; err != nil {
+			return err
+		}
+		// Remove all reset tokens for this user, so older links can't be used.
+		if err := tx.Where("type = ? AND user_id = ?", TOKENTYPE_PASSWORD_RESET, userId).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		slog.Error("resetPassword failed - transaction failed", "user_id", userId, "error", err)
+		return errors.New("failed to update password")
+	}
+	// Log out everywhere, incase someone else had access to the account.
+	setPasswordResetRequired(uint(userId), false)
+	revokeUserSessions(db, uint(userId))
+	slog.Info("resetPassword: Users password has been reset", "user_id", userId)
+	return nil
+}
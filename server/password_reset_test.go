@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Db with a watcharr user that can reset their password.
+func newPasswordResetDB(t *testing.T) (*gorm.DB, User) {
+	t.Helper()
+	setupJWTConfig(t)
+	db := newTestDB(t, &Image{}, &User{}, &Token{})
+	user := User{Username: "user", Password: "old-hash"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+	return db, user
+}
+
+// Get the token out of a reset link.
+func passwordResetLinkToken(t *testing.T, link PasswordResetLink) string {
+	t.Helper()
+	u, err := url.Parse(link.Link)
+	if err != nil {
+		t.Fatal("failed to parse reset link:", err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, db *gorm.DB, user User) string
+		wantErr bool
+	}{
+		{
+			name: "valid link",
+			token: func(t *testing.T, db *gorm.DB, user User) string {
+				link, err := createPasswordResetLink(db, user, "http://watcharr")
+				if err != nil {
+					t.Fatal("createPasswordResetLink() error:", err)
+				}
+				return passwordResetLinkToken(t, link)
+			},
+		},
+		{
+			name: "expired link",
+			token: func(t *testing.T, db *gorm.DB, user User) string {
+				nonce, err := createOneUseTokenWithExpiry(db, TOKENTYPE_PASSWORD_RESET, user.ID, passwordResetTokenAge)
+				if err != nil {
+					t.Fatal("failed to create nonce:", err)
+				}
+				token, err := signPasswordResetToken(user.ID, nonce, time.Now().Add(-time.Minute))
+				if err != nil {
+					t.Fatal("failed to sign token:", err)
+				}
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "nonce expired in db",
+			token: func(t *testing.T, db *gorm.DB, user User) string {
+				link, err := createPasswordResetLink(db, user, "http://watcharr")
+				if err != nil {
+					t.Fatal("createPasswordResetLink() error:", err)
+				}
+				db.Model(&Token{}).Where("type = ?", TOKENTYPE_PASSWORD_RESET).Update("expires_at", time.Now().Add(-time.Minute))
+				return passwordResetLinkToken(t, link)
+			},
+			wantErr: true,
+		},
+		{
+			name: "session token",
+			token: func(t *testing.T, db *gorm.DB, user User) string {
+				token, err := signJWT(&user)
+				if err != nil {
+					t.Fatal("failed to sign session token:", err)
+				}
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "reset claims signed with the session secret",
+			token: func(t *testing.T, db *gorm.DB, user User) string {
+				nonce, err := createOneUseTokenWithExpiry(db, TOKENTYPE_PASSWORD_RESET, user.ID, passwordResetTokenAge)
+				if err != nil {
+					t.Fatal("failed to create nonce:", err)
+				}
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+					Subject:   strconv.FormatUint(uint64(user.ID), 10),
+					ID:        nonce,
+					Audience:  jwt.ClaimStrings{passwordResetAudience},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				})
+				token.Header["kid"] = Config.JWT_SECRET_ID
+				signed, err := token.SignedString([]byte(Config.JWT_SECRET))
+				if err != nil {
+					t.Fatal("failed to sign token:", err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, user := newPasswordResetDB(t)
+			err := resetPassword(db, PasswordResetConfirmRequest{Token: tt.token(t, db, user), NewPassword: "new-password"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resetPassword() error = %v, want error %v", err, tt.wantErr)
+			}
+			var got User
+			if err := db.Take(&got, user.ID).Error; err != nil {
+				t.Fatal("failed to get user:", err)
+			}
+			if changed := got.Password != user.Password; changed == tt.wantErr {
+				t.Errorf("password changed = %v, want %v", changed, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResetPasswordLinkCanOnlyBeUsedOnce(t *testing.T) {
+	db, user := newPasswordResetDB(t)
+	link, err := createPasswordResetLink(db, user, "http://watcharr")
+	if err != nil {
+		t.Fatal("createPasswordResetLink() error:", err)
+	}
+	token := passwordResetLinkToken(t, link)
+	if err := resetPassword(db, PasswordResetConfirmRequest{Token: token, NewPassword: "new-password"}); err != nil {
+		t.Fatal("first reset failed:", err)
+	}
+	if err := resetPassword(db, PasswordResetConfirmRequest{Token: token, NewPassword: "another-password"}); err == nil {
+		t.Error("second reset with the same link succeeded")
+	}
+}
+
+// Reset tokens are signed with a suffixed secret, so they can never be used to login.
+func TestPasswordResetTokenIsNotASessionToken(t *testing.T) {
+	db, user := newPasswordResetDB(t)
+	link, err := createPasswordResetLink(db, user, "http://watcharr")
+	if err != nil {
+		t.Fatal("createPasswordResetLink() error:", err)
+	}
+	if _, err := parseAuthToken(passwordResetLinkToken(t, link)); err == nil {
+		t.Error("reset token was accepted as a session token")
+	}
+}
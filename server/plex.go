@@ -129,6 +129,25 @@ func fetchPlexAccountFromToken(token string) (PlexUser, error) {
 	return pa.User, nil
 }
 
+// Get the plex account for a users auth token.
+// Errors if plex authentication is disabled.
+func getPlexAccount(token string) (PlexUser, error) {
+	if Config.PLEX_HOST == "" || Config.PLEX_MACHINE_ID == "" {
+		slog.Error("Request made to login via Plex, but Plex authentication is disabled")
+		return PlexUser{}, errors.New("plex login not enabled")
+	}
+	account, err := fetchPlexAccountFromToken(token)
+	if err != nil {
+		slog.Error("getPlexAccount: Could not fetch Plex account", "error", err)
+		return PlexUser{}, errors.New("could not fetch plex acount")
+	}
+	if account.Username == "" || account.Id == 0 {
+		slog.Error("getPlexAccount: Username or id missing from account response:", "username", account.Username, "id", account.Id)
+		return PlexUser{}, errors.New("data is missing from the plex account response")
+	}
+	return account, nil
+}
+
 // Update plex host setting
 func updateConfigPlexHost(v string) (PlexHostConfigUpdateResponse, error) {
 	Config.PLEX_HOST = v
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A recommendation generated for a user, kept until they are next refreshed.
+type Recommendation struct {
+	ID          uint        `json:"-" gorm:"primaryKey"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UserID      uint        `json:"-" gorm:"index;not null"`
+	TmdbID      int         `json:"tmdbId"`
+	Type        ContentType `json:"type"`
+	Title       string      `json:"title"`
+	PosterPath  string      `json:"posterPath"`
+	Overview    string      `json:"overview"`
+	ReleaseDate string      `json:"releaseDate"`
+	VoteAverage float64     `json:"voteAverage"`
+	Score       float64     `json:"score"`
+	// Title of the users rated content that contributed most to this.
+	BecauseOf string `json:"becauseOf"`
+}
+
+type RecommendationsResponse struct {
+	Recommendations []Recommendation `json:"recommendations"`
+	// If the users recommendations are being generated right now,
+	// they should check back soon.
+	Generating bool `json:"generating"`
+}
+
+const (
+	// Lowest rating (out of 10) for watched content to be used as a source.
+	recommendationMinRating = 7
+	// Max number of the users top rated content used as sources.
+	recommendationMaxSources = 20
+	// Only this many of the best candidates get their credits fetched
+	// for people affinity, keeps the number of requests to TMDB down.
+	recommendationMaxCandidates = 40
+	recommendationMaxResults    = 50
+)
+
+// How much each part contributes to a candidates score.
+const (
+	recommendationWeightSimilar  = 0.5 // A `similar` result is worth half a `recommendations` one.
+	recommendationWeightGenre    = 0.6
+	recommendationWeightPeople   = 0.4
+	recommendationWeightFollowed = 0.5
+)
+
+var errRecommendationsGenerating = errors.New("recommendations are already being generated")
+
+var (
+	// Users that are having their recommendations generated right now,
+	// so they can't be generated more than once at the same time.
+	recommendationsGenerating sync.Map
+	// When users without any recommendations last had them generated,
+	// so we don't try again on every request.
+	recommendationsEmptyAt sync.Map
+)
+
+type tmdbRecommendationResults struct {
+	Results []struct {
+		ID           int     `json:"id"`
+		Title        string  `json:"title"`
+		Name         string  `json:"name"`
+		PosterPath   string  `json:"poster_path"`
+		Overview     string  `json:"overview"`
+		ReleaseDate  string  `json:"release_date"`
+		FirstAirDate string  `json:"first_air_date"`
+		GenreIds     []int   `json:"genre_ids"`
+		VoteAverage  float64 `json:"vote_average"`
+	} `json:"results"`
+}
+
+type tmdbRecommendationCredits struct {
+	Cast []struct {
+		ID    int `json:"id"`
+		Order int `json:"order"`
+	} `json:"cast"`
+	Crew []struct {
+		ID  int    `json:"id"`
+		Job string `json:"job"`
+	} `json:"crew"`
+}
+
+// Only what we need from movie/show details to generate recommendations.
+type tmdbRecommendationSource struct {
+	Genres []struct {
+		ID int `json:"id"`
+	} `json:"genres"`
+	CreatedBy []struct {
+		ID int `json:"id"`
+	} `json:"created_by"`
+	Credits         tmdbRecommendationCredits `json:"credits"`
+	Recommendations tmdbRecommendationResults `json:"recommendations"`
+	Similar         tmdbRecommendationResults `json:"similar"`
+}
+
+type recommendationCandidate struct {
+	rec      Recommendation
+	genreIds []int
+	// Score from how many of the users sources recommend this.
+	sourceScore float64
+	// Best source, to say why it was recommended.
+	bestSource      string
+	bestSourceScore float64
+}
+
+// Key candidates and content by, since tmdb ids are only unique per type.
+func recommendationKey(t ContentType, tmdbId int) string {
+	return string(t) + ":" + strconv.Itoa(tmdbId)
+}
+
+// People that matter most in content, top billed cast and directors/creators.
+func (c tmdbRecommendationCredits) people() []int {
+	ids := []int{}
+	for _, v := range c.Cast {
+		if v.Order < 5 {
+			ids = append(ids, v.ID)
+		}
+	}
+	for _, v := range c.Crew {
+		if v.Job == "Director" || v.Job == "Screenplay" || v.Job == "Writer" {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids
+}
+
+// Get recommendations for a user, generating them in the background
+// if they never have been. Content added to their list since they
+// were generated is left out.
+func getRecommendations(db *gorm.DB, userId uint) (RecommendationsResponse, error) {
+	var recs []Recommendation
+	if res := db.Where("user_id = ?", userId).Order("score DESC").Find(&recs); res.Error != nil {
+		slog.Error("getRecommendations: Failed to get recommendations", "user_id", userId, "error", res.Error)
+		return RecommendationsResponse{}, errors.New("failed to get recommendations")
+	}
+	_, generating := recommendationsGenerating.Load(userId)
+	emptyAt, wasEmpty := recommendationsEmptyAt.Load(userId)
+	if len(recs) == 0 && !generating && (!wasEmpty || time.Since(emptyAt.(time.Time)) > 24*time.Hour) {
+		generating = true
+		go generateRecommendations(db, userId)
+	}
+	movies, err := getOnListTmdbIds(db, userId, MOVIE)
+	if err != nil {
+		return RecommendationsResponse{}, err
+	}
+	shows, err := getOnListTmdbIds(db, userId, SHOW)
+	if err != nil {
+		return RecommendationsResponse{}, err
+	}
+	resp := RecommendationsResponse{Recommendations: []Recommendation{}, Generating: generating}
+	for _, r := range recs {
+		if (r.Type == MOVIE && movies[r.TmdbID]) || (r.Type == SHOW && shows[r.TmdbID]) {
+			continue
+		}
+		resp.Recommendations = append(resp.Recommendations, r)
+	}
+	return resp, nil
+}
+
+// Generate (and save, replacing any old) recommendations for a user.
+//
+// Candidates are the TMDB recommendations and similar titles of the users
+// highest rated content, scored by how many (and how highly rated) sources
+// they came from, then weighed by how well their genres and people match
+// the users sources and by what the users followed users rated them.
+func generateRecommendations(db *gorm.DB, userId uint) ([]Recommendation, error) {
+	if _, running := recommendationsGenerating.LoadOrStore(userId, true); running {
+		return []Recommendation{}, errRecommendationsGenerating
+	}
+	defer recommendationsGenerating.Delete(userId)
+
+	var sources []Watched
+	res := db.Where("user_id = ? AND rating >= ? AND content_id IS NOT NULL", userId, recommendationMinRating).
+		Preload("Content").
+		Order("rating DESC, updated_at DESC").
+		Limit(recommendationMaxSources).
+		Find(&sources)
+	if res.Error != nil {
+		slog.Error("generateRecommendations: Failed to get users rated content", "user_id", userId, "error", res.Error)
+		return []Recommendation{}, errors.New("failed to get your rated content")
+	}
+	language, _ := getUserWhereabouts(db, userId)
+
+	genreAffinity := map[int]float64{}
+	peopleAffinity := map[int]float64{}
+	candidates := map[string]*recommendationCandidate{}
+	for _, w := range sources {
+		if w.Content == nil {
+			continue
+		}
+		// 7 -> 0.4, 10 -> 1
+		weight := float64(w.Rating-5) / 5
+		var src tmdbRecommendationSource
+		err := tmdbRequest(
+			"/"+string(w.Content.Type)+"/"+strconv.Itoa(w.Content.TmdbID),
+			map[string]string{"language": language, "append_to_response": "credits,recommendations,similar"},
+			&src,
+		)
+		if err != nil {
+			slog.Error("generateRecommendations: Failed to get source details", "user_id", userId, "tmdb_id", w.Content.TmdbID, "type", w.Content.Type, "error", err)
+			continue
+		}
+		for _, g := range src.Genres {
+			genreAffinity[g.ID] += weight
+		}
+		for _, p := range src.Credits.people() {
+			peopleAffinity[p] += weight
+		}
+		for _, p := range src.CreatedBy {
+			peopleAffinity[p.ID] += weight
+		}
+		add := func(results tmdbRecommendationResults, score float64) {
+			for _, r := range results.Results {
+				k := recommendationKey(w.Content.Type, r.ID)
+				c, ok := candidates[k]
+				if !ok {
+					c = &recommendationCandidate{
+						rec: Recommendation{
+							UserID:      userId,
+							TmdbID:      r.ID,
+							Type:        w.Content.Type,
+							Title:       r.Title,
+							PosterPath:  r.PosterPath,
+							Overview:    r.Overview,
+							ReleaseDate: r.ReleaseDate,
+							VoteAverage: r.VoteAverage,
+						},
+						genreIds: r.GenreIds,
+					}
+					if w.Content.Type == SHOW {
+						c.rec.Title = r.Name
+						c.rec.ReleaseDate = r.FirstAirDate
+					}
+					candidates[k] = c
+				}
+				c.sourceScore += score
+				if score > c.bestSourceScore {
+					c.bestSourceScore = score
+					c.bestSource = w.Content.Title
+				}
+			}
+		}
+		add(src.Recommendations, weight)
+		add(src.Similar, weight*recommendationWeightSimilar)
+	}
+
+	// Remove anything already on their list (including the sources).
+	movies, err := getOnListTmdbIds(db, userId, MOVIE)
+	if err != nil {
+		return []Recommendation{}, err
+	}
+	shows, err := getOnListTmdbIds(db, userId, SHOW)
+	if err != nil {
+		return []Recommendation{}, err
+	}
+	for k, c := range candidates {
+		if (c.rec.Type == MOVIE && movies[c.rec.TmdbID]) || (c.rec.Type == SHOW && shows[c.rec.TmdbID]) {
+			delete(candidates, k)
+		}
+	}
+
+	normalizeAffinity(genreAffinity)
+	normalizeAffinity(peopleAffinity)
+	followedRatings := getFollowedRatings(db, userId)
+
+	// First pass, without people affinity (needs a request per candidate).
+	ranked := make([]*recommendationCandidate, 0, len(candidates))
+	for k, c := range candidates {
+		c.rec.Score = c.sourceScore
+		if len(c.genreIds) > 0 {
+			var g float64
+			for _, id := range c.genreIds {
+				g += genreAffinity[id]
+			}
+			c.rec.Score += recommendationWeightGenre * g / float64(len(c.genreIds))
+		}
+		if fr, ok := followedRatings[k]; ok {
+			c.rec.Score += recommendationWeightFollowed * fr
+		}
+		c.rec.BecauseOf = c.bestSource
+		ranked = append(ranked, c)
+	}
+	sortCandidates(ranked)
+	if len(ranked) > recommendationMaxCandidates {
+		ranked = ranked[:recommendationMaxCandidates]
+	}
+	// Second pass, people affinity for the best candidates.
+	if len(peopleAffinity) > 0 {
+		for _, c := range ranked {
+			var credits tmdbRecommendationCredits
+			err := tmdbRequest("/"+string(c.rec.Type)+"/"+strconv.Itoa(c.rec.TmdbID)+"/credits", map[string]string{"language": language}, &credits)
+			if err != nil {
+				slog.Error("generateRecommendations: Failed to get candidate credits", "tmdb_id", c.rec.TmdbID, "type", c.rec.Type, "error", err)
+				continue
+			}
+			var p float64
+			for _, id := range credits.people() {
+				p += peopleAffinity[id]
+			}
+			// Capped so one huge cast overlap can't outweigh everything else.
+			if p > 1 {
+				p = 1
+			}
+			c.rec.Score += recommendationWeightPeople * p
+		}
+		sortCandidates(ranked)
+	}
+	if len(ranked) > recommendationMaxResults {
+		ranked = ranked[:recommendationMaxResults]
+	}
+
+	recs := make([]Recommendation, 0, len(ranked))
+	for _, c := range ranked {
+		recs = append(recs, c.rec)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&Recommendation{}).Error; err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			return nil
+		}
+		return tx.Create(&recs).Error
+	})
+	if err != nil {
+		slog.Error("generateRecommendations: Failed to save recommendations", "user_id", userId, "error", err)
+		return []Recommendation{}, errors.New("failed to save recommendations")
+	}
+	if len(recs) == 0 {
+		recommendationsEmptyAt.Store(userId, time.Now())
+	} else {
+		recommendationsEmptyAt.Delete(userId)
+	}
+	slog.Info("generateRecommendations: Generated recommendations", "user_id", userId, "sources", len(sources), "recommendations", len(recs))
+	return recs, nil
+}
+
+// Get what the users followed users rated content, keyed by `recommendationKey`.
+// Ratings are averaged and scaled to -1 (rated 0) -> 1 (rated 10), so content
+// they didn't like counts against it. Private users and thoughts are ignored.
+func getFollowedRatings(db *gorm.DB, userId uint) map[string]float64 {
+	var rows []struct {
+		TmdbID int
+		Type   ContentType
+		Rating float64
+	}
+	res := db.Model(&Watched{}).
+		Select("contents.tmdb_id, contents.type, AVG(watcheds.rating) AS rating").
+		Joins("JOIN contents ON contents.id = watcheds.content_id").
+		Joins("JOIN follows ON follows.followed_user_id = watcheds.user_id AND follows.user_id = ?", userId).
+		Joins("JOIN users ON users.id = watcheds.user_id AND users.private = ? AND users.private_thoughts = ?", false, false).
+		Where("watcheds.rating > 0").
+		Group("contents.tmdb_id, contents.type").
+		Scan(&rows)
+	if res.Error != nil {
+		slog.Error("getFollowedRatings: Failed to get followed users ratings", "user_id", userId, "error", res.Error)
+		return map[string]float64{}
+	}
+	ratings := make(map[string]float64, len(rows))
+	for _, r := range rows {
+		ratings[recommendationKey(r.Type, r.TmdbID)] = (r.Rating - 5) / 5
+	}
+	return ratings
+}
+
+// Scale all values so the highest is 1.
+func normalizeAffinity(m map[int]float64) {
+	var max float64
+	for _, v := range m {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return
+	}
+	for k, v := range m {
+		m[k] = v / max
+	}
+}
+
+func sortCandidates(c []*recommendationCandidate) {
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].rec.Score == c[j].rec.Score {
+			return c[i].rec.VoteAverage > c[j].rec.VoteAverage
+		}
+		return c[i].rec.Score > c[j].rec.Score
+	})
+}
+
+// Refresh recommendations of users that have them. Users that never
+// ask for recommendations aren't worth the requests to TMDB.
+func refreshRecommendations(db *gorm.DB) {
+	var userIds []uint
+	if res := db.Model(&Recommendation{}).Distinct().Pluck("user_id", &userIds); res.Error != nil {
+		slog.Error("refreshRecommendations: Failed to get users to refresh", "error", res.Error)
+		return
+	}
+	for _, id := range userIds {
+		if _, err := generateRecommendations(db, id); err != nil {
+			slog.Error("refreshRecommendations: Failed to refresh users recommendations", "user_id", id, "error", err)
+		}
+	}
+}
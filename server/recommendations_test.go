@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeAffinity(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[int]float64
+		want map[int]float64
+	}{
+		{"empty", map[int]float64{}, map[int]float64{}},
+		{"highest becomes 1", map[int]float64{28: 4, 18: 2, 35: 1}, map[int]float64{28: 1, 18: 0.5, 35: 0.25}},
+		{"already normalized", map[int]float64{28: 1, 18: 0.5}, map[int]float64{28: 1, 18: 0.5}},
+		{"negatives are scaled by the highest", map[int]float64{28: 2, 27: -1}, map[int]float64{28: 1, 27: -0.5}},
+		// Nothing liked, so there is nothing to scale by.
+		{"no positives", map[int]float64{27: -2, 18: 0}, map[int]float64{27: -2, 18: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizeAffinity(tt.m)
+			if !reflect.DeepEqual(tt.m, tt.want) {
+				t.Errorf("normalizeAffinity() = %v, want %v", tt.m, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortCandidates(t *testing.T) {
+	candidate := func(id int, score float64, voteAverage float64) *recommendationCandidate {
+		return &recommendationCandidate{rec: Recommendation{TmdbID: id, Score: score, VoteAverage: voteAverage}}
+	}
+	tests := []struct {
+		name       string
+		candidates []*recommendationCandidate
+		want       []int
+	}{
+		{
+			name:       "highest score first",
+			candidates: []*recommendationCandidate{candidate(1, 0.2, 9), candidate(2, 0.9, 5), candidate(3, 0.5, 7)},
+			want:       []int{2, 3, 1},
+		},
+		{
+			name:       "ties broken by vote average",
+			candidates: []*recommendationCandidate{candidate(1, 0.5, 6), candidate(2, 0.5, 8), candidate(3, 0.7, 1)},
+			want:       []int{3, 2, 1},
+		},
+		{
+			name:       "full ties keep their order",
+			candidates: []*recommendationCandidate{candidate(1, 0.5, 7), candidate(2, 0.5, 7), candidate(3, 0.5, 7)},
+			want:       []int{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortCandidates(tt.candidates)
+			got := []int{}
+			for _, c := range tt.candidates {
+				got = append(got, c.rec.TmdbID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortCandidates() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Request backends.
+// Content requests are reviewed by Watcharr admins and sent to sonarr/radarr
+// by default. Servers that already route requests through Overseerr/Jellyseerr
+// can use it instead, in which case requests are passed straight on to it.
+
+package main
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type RequestBackendType string
+
+var (
+	// Reviewed in Watcharr, approved requests are sent to sonarr/radarr.
+	REQUEST_BACKEND_ARR RequestBackendType = "arr"
+	// Sent to Overseerr/Jellyseerr, which handles reviewing them.
+	REQUEST_BACKEND_SEERR RequestBackendType = "seerr"
+)
+
+type RequestBackend interface {
+	// If requests are reviewed by Watcharr admins.
+	ReviewedInWatcharr() bool
+	// Pass a new request on to the backend, filling in its backend fields.
+	// Called before the request is saved.
+	Submit(db *gorm.DB, cr *ContentRequest) error
+	// Remove a cancelled request from the backend.
+	Cancel(cr ContentRequest) error
+}
+
+type arrRequestBackend struct{}
+
+func (arrRequestBackend) ReviewedInWatcharr() bool { return true }
+
+// Nothing is sent until an admin approves the request.
+func (arrRequestBackend) Submit(db *gorm.DB, cr *ContentRequest) error {
+	cr.Backend = REQUEST_BACKEND_ARR
+	return nil
+}
+
+func (arrRequestBackend) Cancel(cr ContentRequest) error { return nil }
+
+// Get the backend new requests should be sent to.
+func getRequestBackend() RequestBackend {
+	return getRequestBackendByType(RequestBackendType(Config.REQUEST_BACKEND))
+}
+
+// Get the backend of type `t`, arr is used if `t` is unknown (or empty,
+// which requests made before backends existed will be).
+func getRequestBackendByType(t RequestBackendType) RequestBackend {
+	if t == REQUEST_BACKEND_SEERR {
+		return seerrRequestBackend{}
+	}
+	return arrRequestBackend{}
+}
+
+// If a request backend is setup, so users can request content.
+func requestBackendConfigured() bool {
+	if RequestBackendType(Config.REQUEST_BACKEND) == REQUEST_BACKEND_SEERR {
+		return Config.SEERR.IsConfigured()
+	}
+	return len(Config.SONARR) > 0 || len(Config.RADARR) > 0
+}
+
+func updateConfigRequestBackend(v string) error {
+	t := RequestBackendType(v)
+	if t != "" && t != REQUEST_BACKEND_ARR && t != REQUEST_BACKEND_SEERR {
+		return errors.New("invalid request backend")
+	}
+	if t == REQUEST_BACKEND_SEERR && !Config.SEERR.IsConfigured() {
+		return errors.New("overseerr/jellyseerr must be configured first")
+	}
+	Config.REQUEST_BACKEND = v
+	return nil
+}
@@ -75,171 +75,241 @@ func (b *BaseRouter) addSetupRoutes() {
 }
 
 func (b *BaseRouter) addContentRoutes() {
-	content := b.rg.Group("/content").Use(AuthRequired(nil))
-	exp := time.Hour * 24
+	content := b.rg.Group("/content").Use(AuthRequired(nil), WhereaboutsRequired(b.db))
 
 	// Search for content
-	content.GET("/:query", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/:query", func(c *gin.Context) {
 		// println(c.Param("query"))
 		if c.Param("query") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := searchContent(c.Param("query"))
+		content, err := searchContent(c.Param("query"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get movie details (for movie page)
-	content.Use(WhereaboutsRequired()).GET("/movie/:id", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/movie/:id", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := movieDetails(b.db, c.Param("id"), c.MustGet("userCountry").(string), map[string]string{"append_to_response": "videos,watch/providers,similar"})
+		content, err := movieDetails(b.db, c.Param("id"), c.GetString("userLanguage"), c.GetString("userCountry"), map[string]string{"append_to_response": "videos,watch/providers,similar"})
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get movie cast
-	content.GET("/movie/:id/credits", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/movie/:id/credits", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := movieCredits(c.Param("id"))
+		content, err := movieCredits(c.Param("id"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get tv details (for tv page)
-	content.Use(WhereaboutsRequired()).GET("/tv/:id", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/tv/:id", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := tvDetails(b.db, c.Param("id"), c.MustGet("userCountry").(string), map[string]string{"append_to_response": "videos,watch/providers,similar,external_ids,keywords"})
+		content, err := tvDetails(b.db, c.Param("id"), c.GetString("userLanguage"), c.GetString("userCountry"), map[string]string{"append_to_response": "videos,watch/providers,similar,external_ids,keywords"})
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get tv cast
-	content.GET("/tv/:id/credits", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/tv/:id/credits", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := tvCredits(c.Param("id"))
+		content, err := tvCredits(c.Param("id"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get season details
-	content.GET("/tv/:id/season/:num", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/tv/:id/season/:num", func(c *gin.Context) {
 		if c.Param("id") == "" || c.Param("num") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := seasonDetails(c.Param("id"), c.Param("num"))
+		content, err := seasonDetails(c.Param("id"), c.Param("num"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get person details
-	content.GET("/person/:id", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/person/:id", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := personDetails(c.Param("id"))
+		content, err := personDetails(c.Param("id"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get person credits
-	content.GET("/person/:id/credits", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/person/:id/credits", func(c *gin.Context) {
 		if c.Param("id") == "" {
 			c.Status(400)
 			return
 		}
-		content, err := personCredits(c.Param("id"))
+		content, err := personCredits(c.Param("id"), c.GetString("userLanguage"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Discover movies
-	content.GET("/discover/movies", cache.CachePage(b.ms, exp, func(c *gin.Context) {
-		content, err := discoverMovies()
+	content.GET("/discover/movies", func(c *gin.Context) {
+		var q DiscoverQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		content, err := discoverMovies(c.GetString("userLanguage"), c.GetString("userCountry"), q)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if q.HideOnList {
+			onList, err := getOnListTmdbIds(b.db, c.MustGet("userId").(uint), MOVIE)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.hideOnList(onList)
+		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Discover shows
-	content.GET("/discover/tv", cache.CachePage(b.ms, exp, func(c *gin.Context) {
-		content, err := discoverTv()
+	content.GET("/discover/tv", func(c *gin.Context) {
+		var q DiscoverQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		content, err := discoverTv(c.GetString("userLanguage"), c.GetString("userCountry"), q)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if q.HideOnList {
+			onList, err := getOnListTmdbIds(b.db, c.MustGet("userId").(uint), SHOW)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.hideOnList(onList)
+		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get all trending (movies, tv, people)
-	content.GET("/trending", cache.CachePage(b.ms, exp, func(c *gin.Context) {
-		content, err := allTrending()
+	content.GET("/trending", func(c *gin.Context) {
+		var q DiscoverQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		content, err := allTrending(c.GetString("userLanguage"), q)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if q.HideOnList {
+			userId := c.MustGet("userId").(uint)
+			movies, err := getOnListTmdbIds(b.db, userId, MOVIE)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			shows, err := getOnListTmdbIds(b.db, userId, SHOW)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.hideOnList(movies, shows)
+		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Upcoming Movies
-	content.GET("/upcoming/movies", cache.CachePage(b.ms, exp, func(c *gin.Context) {
-		content, err := upcomingMovies()
+	content.GET("/upcoming/movies", func(c *gin.Context) {
+		var q DiscoverQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		content, err := upcomingMovies(c.GetString("userLanguage"), c.GetString("userCountry"), q)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if q.HideOnList {
+			onList, err := getOnListTmdbIds(b.db, c.MustGet("userId").(uint), MOVIE)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.hideOnList(onList)
+		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Upcoming Tv
-	content.GET("/upcoming/tv", cache.CachePage(b.ms, exp, func(c *gin.Context) {
-		content, err := upcomingTv()
+	content.GET("/upcoming/tv", func(c *gin.Context) {
+		var q DiscoverQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		content, err := upcomingTv(c.GetString("userLanguage"), q)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if q.HideOnList {
+			onList, err := getOnListTmdbIds(b.db, c.MustGet("userId").(uint), SHOW)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.hideOnList(onList)
+		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 }
 
 func (b *BaseRouter) addGameRoutes() {
@@ -312,11 +382,13 @@ func (b *BaseRouter) addGameRoutes() {
 			var ar game.IGDB
 			err := c.ShouldBindJSON(&ar)
 			if err == nil {
+				before := auditSnapshot(Config.TWITCH)
 				err := saveTwitchConfig(ar)
 				if err != nil {
 					c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 					return
 				}
+				addAuditLog(b.db, c, AUDIT_CONFIG_TWITCH_UPDATE, "TWITCH", before, auditSnapshot(Config.TWITCH))
 				igdb = &Config.TWITCH
 				c.Status(http.StatusOK)
 				return
@@ -547,12 +619,9 @@ func (b *BaseRouter) addAuthRoutes() {
 	auth.POST("/", func(c *gin.Context) {
 		var user User
 		if c.ShouldBindJSON(&user) == nil {
-			response, err := login(&user, b.db)
-			if err != nil {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
-				return
-			}
-			c.JSON(http.StatusOK, response)
+			handleProtectedLogin(c, b.db, "watcharr", user.Username, func() (AuthResponse, error) {
+				return login(&user, b.db)
+			})
 			return
 		}
 		c.Status(400)
@@ -562,12 +631,21 @@ func (b *BaseRouter) addAuthRoutes() {
 	auth.POST("/jellyfin", func(c *gin.Context) {
 		var user User
 		if c.ShouldBindJSON(&user) == nil {
-			response, err := loginJellyfin(&user, b.db)
-			if err != nil {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
-				return
-			}
-			c.JSON(http.StatusOK, response)
+			handleProtectedLogin(c, b.db, "jellyfin", user.Username, func() (AuthResponse, error) {
+				return loginMediaServer(JellyfinServer, &user, b.db)
+			})
+			return
+		}
+		c.Status(400)
+	})
+
+	// Emby login
+	auth.POST("/emby", func(c *gin.Context) {
+		var user User
+		if c.ShouldBindJSON(&user) == nil {
+			handleProtectedLogin(c, b.db, "emby", user.Username, func() (AuthResponse, error) {
+				return loginMediaServer(EmbyServer, &user, b.db)
+			})
 			return
 		}
 		c.Status(400)
@@ -603,12 +681,47 @@ func (b *BaseRouter) addAuthRoutes() {
 		c.Status(400)
 	})
 
+	// Request a password reset link
+	auth.POST("/reset_password/request", func(c *gin.Context) {
+		var rr PasswordResetRequest
+		err := c.ShouldBindJSON(&rr)
+		if err == nil {
+			err := requestPasswordReset(b.db, rr)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Set a new password using a reset link
+	auth.POST("/reset_password", func(c *gin.Context) {
+		var rr PasswordResetConfirmRequest
+		err := c.ShouldBindJSON(&rr)
+		if err == nil {
+			err := resetPassword(b.db, rr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
 	// Get available auth providers
 	auth.GET("/available", func(c *gin.Context) {
 		availableAuthProviders := []string{}
 		if Config.JELLYFIN_HOST != "" {
 			availableAuthProviders = append(availableAuthProviders, "jellyfin")
 		}
+		if Config.EMBY_HOST != "" {
+			availableAuthProviders = append(availableAuthProviders, "emby")
+		}
 		if Config.PLEX_HOST != "" && Config.PLEX_MACHINE_ID != "" {
 			availableAuthProviders = append(availableAuthProviders, "plex")
 		}
@@ -644,6 +757,7 @@ func (b *BaseRouter) addAuthRoutes() {
 					c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 					return
 				}
+				addAuditLog(b.db, c, AUDIT_ADMIN_TOKEN_USE, strconv.FormatUint(uint64(userId), 10), nil, nil)
 				c.Status(http.StatusNoContent)
 				return
 			}
@@ -684,17 +798,18 @@ func (b *BaseRouter) addProfileRoutes() {
 	})
 }
 
-func (b *BaseRouter) addJellyfinRoutes() {
-	jf := b.rg.Group("/jellyfin").Use(AuthRequired(b.db), JellyfinAccessRequired())
+// Routes for a Jellyfin compatible media server (at /jellyfin or /emby).
+func (b *BaseRouter) addMediaServerRoutes(s MediaServer) {
+	ms := b.rg.Group("/"+s.Name).Use(AuthRequired(b.db), MediaServerAccessRequired(b.db, s))
 
-	// Check if jf has item
-	jf.GET("/:type/:name/:tmdbId", func(c *gin.Context) {
+	// Check if server has item
+	ms.GET("/:type/:name/:tmdbId", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
 		userType := c.MustGet("userType").(UserType)
 		username := c.MustGet("username").(string)
 		userThirdPartyId := c.MustGet("userThirdPartyId").(string)
 		userThirdPartyAuth := c.MustGet("userThirdPartyAuth").(string)
-		response, err := jellyfinContentFind(userId, userType, username, userThirdPartyId, userThirdPartyAuth, c.Param("type"), c.Param("name"), c.Param("tmdbId"))
+		response, err := mediaServerContentFind(s, userId, userType, username, userThirdPartyId, userThirdPartyAuth, c.Param("type"), c.Param("name"), c.Param("tmdbId"))
 		if err != nil {
 			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 			return
@@ -702,14 +817,14 @@ func (b *BaseRouter) addJellyfinRoutes() {
 		c.JSON(http.StatusOK, response)
 	})
 
-	// Sync users jellyfin watched items to watchlist
-	jf.GET("/sync", func(c *gin.Context) {
+	// Sync users watched items on the server to watchlist
+	ms.GET("/sync", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
 		userType := c.MustGet("userType").(UserType)
 		username := c.MustGet("username").(string)
 		userThirdPartyId := c.MustGet("userThirdPartyId").(string)
 		userThirdPartyAuth := c.MustGet("userThirdPartyAuth").(string)
-		response, err := jellyfinSyncWatched(b.db, userId, userType, username, userThirdPartyId, userThirdPartyAuth)
+		response, err := mediaServerSyncWatched(b.db, s, userId, userType, username, userThirdPartyId, userThirdPartyAuth)
 		if err != nil {
 			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 			return
@@ -803,94 +918,129 @@ func (b *BaseRouter) addUserRoutes() {
 		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Upload avatar
-	u.POST("/avatar", func(c *gin.Context) {
+	// Update email
+	u.POST("/email", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		response, err := uploadUserAvatar(c, b.db, userId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		var er UserEmailUpdateRequest
+		err := c.ShouldBindJSON(&er)
+		if err == nil {
+			err := userUpdateEmail(b.db, userId, er.Email)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Status(http.StatusOK)
 			return
 		}
-		c.JSON(http.StatusOK, response)
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
-}
-
-func (b *BaseRouter) addFollowRoutes() {
-	f := b.rg.Group("/follow").Use(AuthRequired(b.db))
 
-	// Get users follows // TODO extend to support optionally passing user id as route param, default to current user
-	f.GET("", func(c *gin.Context) {
+	// Export all of the current users data
+	u.GET("/export", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		response, err := getFollows(b.db, userId)
+		response, err := exportUserData(b.db, userId)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, response)
 	})
 
-	// Follow a user
-	f.POST("/:toFollowId", func(c *gin.Context) {
+	// Get a token to confirm account deletion with by logging in to
+	// the linked Jellyfin account again (for users without a Watcharr password).
+	u.POST("/delete_token/jellyfin", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		toFollowId, err := strconv.ParseUint(c.Param("toFollowId"), 10, 64)
-		if err != nil {
-			slog.Error("failed to convert toFollowId param to uint", "toFollowId", toFollowId)
-			c.Status(400)
-			return
-		}
-		response, err := followUser(b.db, userId, uint(toFollowId))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		var ja JellyfinAuth
+		err := c.ShouldBindJSON(&ja)
+		if err == nil {
+			token, err := createMediaServerDeleteToken(b.db, JellyfinServer, userId, ja)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, ValueRequest{Value: token})
 			return
 		}
-		c.JSON(http.StatusOK, response)
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Unfollow a user
-	f.DELETE("/:toUnfollowId", func(c *gin.Context) {
+	// Get a token to confirm account deletion with by logging in to
+	// the linked Emby account again (for users without a Watcharr password).
+	u.POST("/delete_token/emby", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		toUnfollowId, err := strconv.ParseUint(c.Param("toUnfollowId"), 10, 64)
-		if err != nil {
-			slog.Error("failed to convert toUnfollowId param to uint", "toUnfollowId", toUnfollowId)
-			c.Status(400)
+		var ja JellyfinAuth
+		err := c.ShouldBindJSON(&ja)
+		if err == nil {
+			token, err := createMediaServerDeleteToken(b.db, EmbyServer, userId, ja)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, ValueRequest{Value: token})
 			return
 		}
-		response, err := unfollowUser(b.db, userId, uint(toUnfollowId))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get a token to confirm account deletion with by logging in to
+	// the linked Plex account again (for users without a Watcharr password).
+	u.POST("/delete_token/plex", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var lr PlexLoginRequest
+		err := c.ShouldBindJSON(&lr)
+		if err == nil {
+			token, err := createPlexDeleteToken(b.db, userId, lr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, ValueRequest{Value: token})
 			return
 		}
-		c.JSON(http.StatusOK, response)
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Get follows thoughts on content
-	f.GET("/thoughts/:type/:tmdbId", func(c *gin.Context) {
-		t := c.Param("type")
-		if t != "movie" && t != "tv" && t != "game" {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "only movie, tv or game types are supported"})
+	// Delete current users account
+	u.POST("/delete", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var dr UserDeleteRequest
+		err := c.ShouldBindJSON(&dr)
+		if err == nil {
+			export, err := userDelete(b.db, userId, dr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if export != nil {
+				c.JSON(http.StatusOK, export)
+				return
+			}
+			c.Status(http.StatusOK)
 			return
 		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get the logins linked to the current user
+	u.GET("/identities", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		response, err := getFollowsThoughts(b.db, userId, t, c.Param("tmdbId"))
+		response, err := getUserIdentities(b.db, userId)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, response)
 	})
-}
-
-func (b *BaseRouter) addImportRoutes() {
-	imprt := b.rg.Group("/import").Use(AuthRequired(nil))
 
-	imprt.POST("", func(c *gin.Context) {
+	// Add a Watcharr username and password login
+	u.POST("/identities/watcharr", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
-		var ar ImportRequest
-		err := c.ShouldBindJSON(&ar)
+		var lr LinkWatcharrIdentityRequest
+		err := c.ShouldBindJSON(&lr)
 		if err == nil {
-			response, err := importContent(b.db, userId, ar)
+			response, err := linkWatcharrIdentity(b.db, userId, lr)
 			if err != nil {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
 			c.JSON(http.StatusOK, response)
@@ -898,60 +1048,726 @@ func (b *BaseRouter) addImportRoutes() {
 		}
 		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
-}
 
-func (b *BaseRouter) addServerRoutes() {
-	server := b.rg.Group("/server").Use(AuthRequired(b.db), AdminRequired())
-
-	// Get server config (minus very sensitive fields, like JWT_SECRET)
-	server.GET("/config", func(c *gin.Context) {
-		// Return new ServerConfig with only the fields we want to show in settings ui
-		c.JSON(http.StatusOK, Config.GetSafe())
+	// Link a Jellyfin account
+	u.POST("/identities/jellyfin", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var ja JellyfinAuth
+		err := c.ShouldBindJSON(&ja)
+		if err == nil {
+			response, err := linkMediaServerIdentity(b.db, JellyfinServer, userId, ja)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Update config
-	server.POST("/config", func(c *gin.Context) {
-		var ur KeyValueRequest
-		err := c.ShouldBindJSON(&ur)
+	// Link a Emby account
+	u.POST("/identities/emby", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var ja JellyfinAuth
+		err := c.ShouldBindJSON(&ja)
 		if err == nil {
-			err := updateConfig(ur.Key, ur.Value)
+			response, err := linkMediaServerIdentity(b.db, EmbyServer, userId, ja)
 			if err != nil {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
-			c.Status(http.StatusOK)
+			c.JSON(http.StatusOK, response)
 			return
 		}
 		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Update plex host config
-	server.POST("/config/plex_host", func(c *gin.Context) {
-		var ur ValueRequest
-		err := c.ShouldBindJSON(&ur)
+	// Link a Plex account
+	u.POST("/identities/plex", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var lr PlexLoginRequest
+		err := c.ShouldBindJSON(&lr)
 		if err == nil {
-			resp, err := updateConfigPlexHost(ur.Value.(string))
+			response, err := linkPlexIdentity(b.db, userId, lr)
 			if err != nil {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, resp)
+			c.JSON(http.StatusOK, response)
 			return
 		}
 		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 	})
 
-	// Get server stats
-	server.GET("/stats", cache.CachePage(b.ms, time.Minute*5, func(c *gin.Context) {
-		c.JSON(http.StatusOK, getServerStats(b.db))
-	}))
-}
-
-func (b *BaseRouter) addFeatureRoutes() {
-	feature := b.rg.Group("/features").Use(AuthRequired(b.db))
-
-	// Get enabled features (aka functionality)
-	feature.GET("", func(c *gin.Context) {
+	// Unlink a login from the current user
+	u.DELETE("/identities/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		if err := unlinkIdentity(b.db, userId, uint(id)); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Upload avatar
+	u.POST("/avatar", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := uploadUserAvatar(c, b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addRecommendationRoutes() {
+	r := b.rg.Group("/recommendations").Use(AuthRequired(b.db))
+
+	// Get current users recommendations
+	r.GET("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getRecommendations(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addCollectionRoutes() {
+	col := b.rg.Group("/collections").Use(AuthRequired(b.db), WhereaboutsRequired(b.db))
+
+	// Get collections the current user has movies from, with their completion
+	col.GET("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getUserCollections(b.db, userId, c.GetString("userLanguage"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get a collection, with the current users completion
+	col.GET("/:id", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		response, err := getUserCollection(b.db, userId, id, c.GetString("userLanguage"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Add all parts of a collection not on the current users list as PLANNED
+	col.POST("/:id/plan", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		response, err := planCollection(b.db, userId, id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addFollowRoutes() {
+	f := b.rg.Group("/follow").Use(AuthRequired(b.db))
+
+	// Get users follows // TODO extend to support optionally passing user id as route param, default to current user
+	f.GET("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getFollows(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Follow a user
+	f.POST("/:toFollowId", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		toFollowId, err := strconv.ParseUint(c.Param("toFollowId"), 10, 64)
+		if err != nil {
+			slog.Error("failed to convert toFollowId param to uint", "toFollowId", toFollowId)
+			c.Status(400)
+			return
+		}
+		response, err := followUser(b.db, userId, uint(toFollowId))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Unfollow a user
+	f.DELETE("/:toUnfollowId", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		toUnfollowId, err := strconv.ParseUint(c.Param("toUnfollowId"), 10, 64)
+		if err != nil {
+			slog.Error("failed to convert toUnfollowId param to uint", "toUnfollowId", toUnfollowId)
+			c.Status(400)
+			return
+		}
+		response, err := unfollowUser(b.db, userId, uint(toUnfollowId))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get follows thoughts on content
+	f.GET("/thoughts/:type/:tmdbId", func(c *gin.Context) {
+		t := c.Param("type")
+		if t != "movie" && t != "tv" && t != "game" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "only movie, tv or game types are supported"})
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		response, err := getFollowsThoughts(b.db, userId, t, c.Param("tmdbId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addImportRoutes() {
+	imprt := b.rg.Group("/import").Use(AuthRequired(nil))
+
+	imprt.POST("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var ar ImportRequest
+		err := c.ShouldBindJSON(&ar)
+		if err == nil {
+			response, err := importContent(b.db, userId, ar)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+}
+
+func (b *BaseRouter) addServerRoutes() {
+	server := b.rg.Group("/server").Use(AuthRequired(b.db), AdminRequired())
+
+	// Get server config (minus very sensitive fields, like JWT_SECRET)
+	server.GET("/config", func(c *gin.Context) {
+		// Return new ServerConfig with only the fields we want to show in settings ui
+		c.JSON(http.StatusOK, Config.GetSafe())
+	})
+
+	// Update config
+	server.POST("/config", func(c *gin.Context) {
+		var ur KeyValueRequest
+		err := c.ShouldBindJSON(&ur)
+		if err == nil {
+			before := auditSnapshot(Config)
+			err := updateConfig(ur.Key, ur.Value)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONFIG_UPDATE, ur.Key, before, auditSnapshot(Config))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Update plex host config
+	server.POST("/config/plex_host", func(c *gin.Context) {
+		var ur ValueRequest
+		err := c.ShouldBindJSON(&ur)
+		if err == nil {
+			before := auditSnapshot(Config)
+			resp, err := updateConfigPlexHost(ur.Value.(string))
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONFIG_PLEX_HOST_UPDATE, "PLEX_HOST", before, auditSnapshot(Config))
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Update smtp config
+	server.POST("/config/smtp", func(c *gin.Context) {
+		var sr SMTPSettings
+		err := c.ShouldBindJSON(&sr)
+		if err == nil {
+			before := auditSnapshot(Config.SMTP)
+			err := saveSMTPConfig(sr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONFIG_SMTP_UPDATE, "SMTP", before, auditSnapshot(Config.SMTP))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Update overseerr/jellyseerr config
+	server.POST("/config/seerr", func(c *gin.Context) {
+		var sr SeerrSettings
+		err := c.ShouldBindJSON(&sr)
+		if err == nil {
+			before := auditSnapshot(Config.SEERR)
+			err := saveSeerrConfig(sr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONFIG_SEERR_UPDATE, "SEERR", before, auditSnapshot(Config.SEERR))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get overseerr/jellyseerr users, to pick who Watcharr users request as
+	server.GET("/seerr/users", func(c *gin.Context) {
+		users, err := getSeerrUsers()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, users)
+	})
+
+	// Update metadata providers config
+	server.POST("/config/metadata", func(c *gin.Context) {
+		var mr MetadataSettings
+		err := c.ShouldBindJSON(&mr)
+		if err == nil {
+			before := auditSnapshot(Config.METADATA)
+			err := saveMetadataConfig(mr)
+			if err != nil {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONFIG_METADATA_UPDATE, "METADATA", before, auditSnapshot(Config.METADATA))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Rotate JWT secret. Tokens signed with the old secret keep
+	// working until the grace period is over.
+	server.POST("/jwt/rotate", func(c *gin.Context) {
+		var rr JWTRotateRequest
+		err := c.ShouldBindJSON(&rr)
+		if err == nil {
+			gracePeriod := defaultJWTGracePeriod
+			if rr.GracePeriodHours != nil {
+				gracePeriod = time.Duration(*rr.GracePeriodHours) * time.Hour
+			}
+			resp, err := rotateJWTSecret(gracePeriod)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_JWT_ROTATE, resp.NewKeyID, nil, nil)
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get TMDB client metrics (request counts, failures, etc)
+	server.GET("/tmdb/metrics", func(c *gin.Context) {
+		c.JSON(http.StatusOK, tmdb.metrics())
+	})
+
+	// Get TMDB response cache stats
+	server.GET("/tmdb/cache", func(c *gin.Context) {
+		response, err := getTMDBCacheStats(b.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Purge TMDB response cache, optionally only for endpoints starting with `?endpoint=`
+	server.DELETE("/tmdb/cache", func(c *gin.Context) {
+		removed, err := purgeTMDBCache(b.db, c.Query("endpoint"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_TMDB_CACHE_PURGE, c.Query("endpoint"), nil, map[string]int64{"removed": removed})
+		c.JSON(http.StatusOK, map[string]int64{"removed": removed})
+	})
+
+	// Get server stats
+	server.GET("/stats", cache.CachePage(b.ms, time.Minute*5, func(c *gin.Context) {
+		c.JSON(http.StatusOK, getServerStats(b.db))
+	}))
+}
+
+func (b *BaseRouter) addAdminRoutes() {
+	admin := b.rg.Group("/admin").Use(AuthRequired(b.db), AdminRequired())
+
+	// Get all users
+	admin.GET("/users", func(c *gin.Context) {
+		response, err := getAllUsers(b.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get a users stats
+	admin.GET("/users/:id/stats", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		response, err := adminGetUserStats(b.db, uint(id))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Grant or revoke a permission
+	admin.POST("/users/:id/permissions", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		var pr AdminUserPermissionRequest
+		err = c.ShouldBindJSON(&pr)
+		if err == nil {
+			before := adminUserAuditSnapshot(b.db, uint(id))
+			perms, err := adminUpdateUserPermission(b.db, userId, uint(id), pr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_USER_PERMISSIONS_UPDATE, c.Param("id"), before, adminUserAuditSnapshot(b.db, uint(id)))
+			c.JSON(http.StatusOK, ValueRequest{Value: perms})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Disable a user
+	admin.POST("/users/:id/disable", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		before := adminUserAuditSnapshot(b.db, uint(id))
+		if err := adminSetUserDisabled(b.db, userId, uint(id), true); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_USER_DISABLE, c.Param("id"), before, adminUserAuditSnapshot(b.db, uint(id)))
+		c.Status(http.StatusOK)
+	})
+
+	// Enable a disabled user
+	admin.POST("/users/:id/enable", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		before := adminUserAuditSnapshot(b.db, uint(id))
+		if err := adminSetUserDisabled(b.db, userId, uint(id), false); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_USER_ENABLE, c.Param("id"), before, adminUserAuditSnapshot(b.db, uint(id)))
+		c.Status(http.StatusOK)
+	})
+
+	// Force a user to change their password
+	admin.POST("/users/:id/force_password_reset", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		before := adminUserAuditSnapshot(b.db, uint(id))
+		if err := adminForcePasswordReset(b.db, uint(id)); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_USER_FORCE_PASSWORD_RESET, c.Param("id"), before, adminUserAuditSnapshot(b.db, uint(id)))
+		c.Status(http.StatusOK)
+	})
+
+	// Set the overseerr/jellyseerr user a user requests as
+	admin.POST("/users/:id/seerr_user", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		var sr AdminUserSeerrUserRequest
+		err = c.ShouldBindJSON(&sr)
+		if err == nil {
+			before := adminUserAuditSnapshot(b.db, uint(id))
+			if err := adminSetUserSeerrUser(b.db, uint(id), sr.SeerrUserID); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_USER_SEERR_USER_UPDATE, c.Param("id"), before, adminUserAuditSnapshot(b.db, uint(id)))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Create a password reset link for a user to hand over
+	admin.POST("/users/:id/password_reset_link", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		response, err := adminCreatePasswordResetLink(b.db, uint(id), getRequestPublicURL(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_USER_PASSWORD_RESET_LINK, c.Param("id"), nil, nil)
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get links for password resets users have requested
+	admin.GET("/password_resets", func(c *gin.Context) {
+		response, err := getPendingPasswordResets(b.db, getRequestPublicURL(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Merge one user into another
+	admin.POST("/users/merge", func(c *gin.Context) {
+		var mr UserMergeRequest
+		err := c.ShouldBindJSON(&mr)
+		if err == nil {
+			before := adminUserAuditSnapshot(b.db, mr.TargetUserID)
+			if err := mergeUsers(b.db, mr); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_USER_MERGE, strconv.FormatUint(uint64(mr.SourceUserID), 10)+" -> "+strconv.FormatUint(uint64(mr.TargetUserID), 10), before, adminUserAuditSnapshot(b.db, mr.TargetUserID))
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get ips and usernames with failed logins
+	admin.GET("/lockouts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getLoginLockouts())
+	})
+
+	// Clear a lockout (or all of them)
+	admin.POST("/lockouts/clear", func(c *gin.Context) {
+		var lr LoginLockoutClearRequest
+		err := c.ShouldBindJSON(&lr)
+		if err == nil {
+			if err := clearLoginLockout(lr); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			target := "all"
+			if lr.Type != "" {
+				target = string(lr.Type) + ":" + lr.Key
+			}
+			addAuditLog(b.db, c, AUDIT_LOGIN_LOCKOUT_CLEAR, target, nil, nil)
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Delete a user
+	admin.DELETE("/users/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		before := adminUserAuditSnapshot(b.db, uint(id))
+		export, err := adminDeleteUser(b.db, userId, uint(id), c.Query("export") == "true")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_USER_DELETE, c.Param("id"), before, nil)
+		if export != nil {
+			c.JSON(http.StatusOK, export)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Get all invites
+	admin.GET("/invites", func(c *gin.Context) {
+		response, err := getInvites(b.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Create an invite
+	admin.POST("/invites", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var ir InviteCreateRequest
+		err := c.ShouldBindJSON(&ir)
+		if err == nil {
+			response, err := createInvite(b.db, userId, ir)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_INVITE_CREATE, strconv.FormatUint(uint64(response.ID), 10), nil, auditSnapshot(ir))
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Delete an invite
+	admin.DELETE("/invites/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		if err := deleteInvite(b.db, uint(id)); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		addAuditLog(b.db, c, AUDIT_INVITE_DELETE, c.Param("id"), nil, nil)
+		c.Status(http.StatusOK)
+	})
+
+	// Get content requests, optionally filtered by status
+	admin.GET("/requests", func(c *gin.Context) {
+		response, err := getContentRequests(b.db, ContentRequestStatus(c.Query("status")))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Approve a content request, sending it to sonarr/radarr
+	admin.POST("/requests/:id/approve", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		var ar ContentRequestApproveRequest
+		err = c.ShouldBindJSON(&ar)
+		if err == nil {
+			response, err := approveContentRequest(b.db, userId, uint(id), ar)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONTENT_REQUEST_APPROVE, c.Param("id"), nil, auditSnapshot(ar))
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Deny a content request
+	admin.POST("/requests/:id/deny", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		var dr ContentRequestDenyRequest
+		err = c.ShouldBindJSON(&dr)
+		if err == nil {
+			response, err := denyContentRequest(b.db, userId, uint(id), dr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			addAuditLog(b.db, c, AUDIT_CONTENT_REQUEST_DENY, c.Param("id"), nil, auditSnapshot(dr))
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get audit log (paginated, newest first)
+	admin.GET("/audit", func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		response, err := getAuditLogs(b.db, page, limit, c.Query("action"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addFeatureRoutes() {
+	feature := b.rg.Group("/features").Use(AuthRequired(b.db))
+
+	// Get enabled features (aka functionality)
+	feature.GET("", func(c *gin.Context) {
 		c.JSON(http.StatusOK, getEnabledFeatures(c.GetInt("userPermissions")))
 	})
 }
@@ -961,7 +1777,7 @@ func (b *BaseRouter) addSonarrRoutes() {
 
 	// Test configuration
 	s.POST("/test", func(c *gin.Context) {
-		var ur ArrTestParams
+		var ur ArrConnection
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
 			resp, err := testSonarr(ur)
@@ -982,7 +1798,7 @@ func (b *BaseRouter) addSonarrRoutes() {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
-		resp, err := testSonarr(ArrTestParams{Host: server.Host, Key: server.Key})
+		resp, err := testSonarr(server.ArrConnection)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
@@ -995,11 +1811,13 @@ func (b *BaseRouter) addSonarrRoutes() {
 		var ur SonarrSettings
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
+			before := auditSnapshot(Config.SONARR)
 			err := addSonarr(ur)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			addAuditLog(b.db, c, AUDIT_SONARR_ADD, ur.Name, before, auditSnapshot(Config.SONARR))
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1011,11 +1829,13 @@ func (b *BaseRouter) addSonarrRoutes() {
 		var ur SonarrSettings
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
+			before := auditSnapshot(Config.SONARR)
 			err := editSonarr(ur)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			addAuditLog(b.db, c, AUDIT_SONARR_EDIT, ur.Name, before, auditSnapshot(Config.SONARR))
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1024,11 +1844,13 @@ func (b *BaseRouter) addSonarrRoutes() {
 
 	// Remove sonarr server
 	s.POST("/rm/:name", func(c *gin.Context) {
+		before := auditSnapshot(Config.SONARR)
 		err := rmSonarr(c.Param("name"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		addAuditLog(b.db, c, AUDIT_SONARR_RM, c.Param("name"), before, auditSnapshot(Config.SONARR))
 		c.Status(http.StatusOK)
 	})
 
@@ -1049,12 +1871,36 @@ func (b *BaseRouter) addSonarrRoutes() {
 				return
 			}
 			ur.AutomaticSearch = server.AutomaticSearch
-			sonarr := arr.New(arr.SONARR, &server.Host, &server.Key)
-			err = sonarr.AddContent(sonarr.BuildAddShowBody(ur))
+			sonarr := server.client(arr.SONARR)
+			if ur.MonitorMode == "" {
+				ur.MonitorMode = server.MonitorMode
+			}
+			ur.Tags = getArrRequestTags(sonarr, server.ArrSettings, ur.Tags, c.MustGet("username").(string))
+			// Older clients only tell us it's anime with the series type.
+			if !ur.IsAnime && ur.SeriesType != "anime" {
+				// Clients don't always know, so check for ourselves too.
+				if ur.IsAnime, err = isAnimeShowByTvdbId(ur.TVDBID); err != nil {
+					slog.Warn("SonarrRoutes: Failed to check if show is anime", "tvdb_id", ur.TVDBID, "error", err)
+				}
+			}
+			if ur.IsAnime || ur.SeriesType == "anime" {
+				ur.IsAnime = true
+				ur.Anime, err = getSonarrAnimeOptions(sonarr, server)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+					return
+				}
+			}
+			if err := ensureNotOnArr(sonarr, server.Name, ur.TVDBID); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			arrId, err := sonarr.AddContent(sonarr.BuildAddShowBody(ur))
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			trackArrDownload(b.db, ArrDownload{UserID: c.MustGet("userId").(uint), ArrType: arr.SONARR, ServerName: server.Name, ArrID: arrId, Title: ur.Title})
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1067,7 +1913,7 @@ func (b *BaseRouter) addRadarrRoutes() {
 
 	// Test configuration
 	s.POST("/test", func(c *gin.Context) {
-		var ur ArrTestParams
+		var ur ArrConnection
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
 			resp, err := testRadarr(ur)
@@ -1088,7 +1934,7 @@ func (b *BaseRouter) addRadarrRoutes() {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
-		resp, err := testRadarr(ArrTestParams{Host: server.Host, Key: server.Key})
+		resp, err := testRadarr(server.ArrConnection)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
@@ -1100,11 +1946,13 @@ func (b *BaseRouter) addRadarrRoutes() {
 		var ur RadarrSettings
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
+			before := auditSnapshot(Config.RADARR)
 			err := addRadarr(ur)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			addAuditLog(b.db, c, AUDIT_RADARR_ADD, ur.Name, before, auditSnapshot(Config.RADARR))
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1115,11 +1963,13 @@ func (b *BaseRouter) addRadarrRoutes() {
 		var ur RadarrSettings
 		err := c.ShouldBindJSON(&ur)
 		if err == nil {
+			before := auditSnapshot(Config.RADARR)
 			err := editRadarr(ur)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			addAuditLog(b.db, c, AUDIT_RADARR_EDIT, ur.Name, before, auditSnapshot(Config.RADARR))
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1127,11 +1977,13 @@ func (b *BaseRouter) addRadarrRoutes() {
 	})
 
 	s.POST("/rm/:name", func(c *gin.Context) {
+		before := auditSnapshot(Config.RADARR)
 		err := rmRadarr(c.Param("name"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		addAuditLog(b.db, c, AUDIT_RADARR_RM, c.Param("name"), before, auditSnapshot(Config.RADARR))
 		c.Status(http.StatusOK)
 	})
 
@@ -1150,12 +2002,21 @@ func (b *BaseRouter) addRadarrRoutes() {
 				return
 			}
 			ur.AutomaticSearch = server.AutomaticSearch
-			radarr := arr.New(arr.RADARR, &server.Host, &server.Key)
-			err = radarr.AddContent(radarr.BuildAddMovieBody(ur))
+			radarr := server.client(arr.RADARR)
+			if ur.MinimumAvailability == "" {
+				ur.MinimumAvailability = server.MinimumAvailability
+			}
+			ur.Tags = getArrRequestTags(radarr, server.ArrSettings, ur.Tags, c.MustGet("username").(string))
+			if err := ensureNotOnArr(radarr, server.Name, ur.TMDBID); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			arrId, err := radarr.AddContent(radarr.BuildAddMovieBody(ur))
 			if err != nil {
 				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 				return
 			}
+			trackArrDownload(b.db, ArrDownload{UserID: c.MustGet("userId").(uint), ArrType: arr.RADARR, ServerName: server.Name, ArrID: arrId, Title: ur.Title})
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1163,6 +2024,114 @@ func (b *BaseRouter) addRadarrRoutes() {
 	})
 }
 
+func (b *BaseRouter) addArrRoutes() {
+	a := b.rg.Group("/arr").Use(AuthRequired(b.db), PermissionRequired(PERM_REQUEST_CONTENT))
+
+	// Get the state of content on each sonarr/radarr server,
+	// so users can see if it's already there before requesting it.
+	a.GET("/status/:type/:id", func(c *gin.Context) {
+		contentType := ContentType(c.Param("type"))
+		if contentType != MOVIE && contentType != SHOW {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid content type"})
+			return
+		}
+		tmdbId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		response, err := getArrContentStatus(contentType, tmdbId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func (b *BaseRouter) addContentRequestRoutes() {
+	r := b.rg.Group("/request").Use(AuthRequired(b.db), PermissionRequired(PERM_REQUEST_CONTENT))
+
+	// Get current users requests
+	r.GET("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getUserContentRequests(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Request content
+	r.POST("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var ar ContentRequestAddRequest
+		err := c.ShouldBindJSON(&ar)
+		if err == nil {
+			response, err := addContentRequest(b.db, userId, ar)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get download status of content the current user has requested
+	r.GET("/downloads", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getUserArrDownloads(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Cancel a pending request
+	r.DELETE("/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		if err := cancelContentRequest(b.db, userId, uint(id)); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+}
+
+func (b *BaseRouter) addArrWebhookRoutes() {
+	w := b.rg.Group("/webhook").Use(ArrWebhookAuthRequired())
+
+	handle := func(t arr.ArrType) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var p arr.WebhookPayload
+			if err := c.ShouldBindJSON(&p); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if err := handleArrWebhook(b.db, t, c.Param("name"), p); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Status(http.StatusOK)
+		}
+	}
+
+	// Sonarr webhook, {name} is the name of the server in our config
+	w.POST("/sonarr/:name", handle(arr.SONARR))
+
+	// Radarr webhook, {name} is the name of the server in our config
+	w.POST("/radarr/:name", handle(arr.RADARR))
+}
+
 func (b *BaseRouter) addJobRoutes() {
 	job := b.rg.Group("/job").Use(AuthRequired(nil))
 
@@ -0,0 +1,275 @@
+// Overseerr/Jellyseerr request backend.
+// Requests are created in seerr as the seerr user an admin has set for the
+// requester, or the one linked to the same jellyfin/plex/emby account (only
+// falling back to the api keys owner if allowed), and their status is
+// synced back every minute so users can follow them from Watcharr.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sbondCo/Watcharr/seerr"
+	"gorm.io/gorm"
+)
+
+type SeerrSettings struct {
+	Host string `json:"host,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Optional: Request timeout in seconds, defaults to 30.
+	Timeout int `json:"timeout,omitempty"`
+	// Optional: Don't verify the servers certificate (for self-signed installs).
+	SkipTLSVerify bool `json:"skipTlsVerify,omitempty"`
+	// Request content that users (who have opted in) add to their planned list.
+	AutoRequestPlanned bool `json:"autoRequestPlanned"`
+	// Request as the api keys owner when a user has no matching seerr
+	// user (see `getSeerrUserId`). The owner is usually an admin, so seerr will
+	// auto approve these requests.
+	RequestAsOwnerFallback bool `json:"requestAsOwnerFallback,omitempty"`
+}
+
+// If enough seerr config has been provided to use it.
+func (s *SeerrSettings) IsConfigured() bool {
+	return s.Host != "" && s.Key != ""
+}
+
+// Get a client for the server.
+func (s SeerrSettings) client() *seerr.Seerr {
+	return seerr.New(s.Host, s.Key, seerr.Options{
+		Timeout:       time.Duration(s.Timeout) * time.Second,
+		SkipTLSVerify: s.SkipTLSVerify,
+	})
+}
+
+// Save seerr config, after making sure we can talk to it.
+// Clearing the host removes the config (if it isn't in use).
+func saveSeerrConfig(s SeerrSettings) error {
+	s.Host = strings.TrimSuffix(s.Host, "/")
+	if s.Host == "" {
+		if RequestBackendType(Config.REQUEST_BACKEND) == REQUEST_BACKEND_SEERR {
+			return errors.New("overseerr/jellyseerr is the request backend, change it before removing")
+		}
+		s = SeerrSettings{}
+	} else {
+		if s.Key == "" {
+			return errors.New("api key is required")
+		}
+		if _, err := s.client().GetMe(); err != nil {
+			return errors.New("failed to connect: " + err.Error())
+		}
+	}
+	Config.SEERR = s
+	err := writeConfig()
+	if err != nil {
+		slog.Error("saveSeerrConfig failed to write config", "error", err)
+		return errors.New("failed to save config")
+	}
+	return nil
+}
+
+// Get all seerr users, so admins can pick one for a Watcharr user.
+func getSeerrUsers() ([]seerr.User, error) {
+	if !Config.SEERR.IsConfigured() {
+		return []seerr.User{}, errors.New("overseerr/jellyseerr is not configured")
+	}
+	users, err := Config.SEERR.client().GetUsers()
+	if err != nil {
+		return []seerr.User{}, errors.New("failed to get overseerr/jellyseerr users")
+	}
+	return users, nil
+}
+
+type seerrRequestBackend struct{}
+
+// Seerr has its own approval flow.
+func (seerrRequestBackend) ReviewedInWatcharr() bool { return false }
+
+func (seerrRequestBackend) Submit(db *gorm.DB, cr *ContentRequest) error {
+	if !Config.SEERR.IsConfigured() {
+		return errors.New("overseerr/jellyseerr is not configured")
+	}
+	s := Config.SEERR.client()
+	seerrUserId, err := getSeerrUserId(db, s, cr.UserID)
+	if err != nil {
+		return err
+	}
+	sr, err := s.CreateRequest(string(cr.Content.Type), cr.Content.TmdbID, seerrUserId)
+	if err != nil {
+		slog.Error("seerrRequestBackend: Failed to create request", "tmdb_id", cr.Content.TmdbID, "error", err)
+		return errors.New("failed to request from overseerr/jellyseerr: " + err.Error())
+	}
+	cr.Backend = REQUEST_BACKEND_SEERR
+	cr.BackendRequestID = sr.ID
+	cr.Status = getSeerrRequestStatus(sr.Status)
+	cr.MediaStatus = getSeerrMediaStatus(sr.Media.Status)
+	return nil
+}
+
+func (seerrRequestBackend) Cancel(cr ContentRequest) error {
+	if cr.BackendRequestID == 0 {
+		return nil
+	}
+	err := Config.SEERR.client().DeleteRequest(cr.BackendRequestID)
+	if err != nil && !errors.Is(err, seerr.ErrNotFound) {
+		return errors.New("failed to cancel request in overseerr/jellyseerr")
+	}
+	return nil
+}
+
+// Get the id of the seerr user to request as for a Watcharr user.
+// Uses the seerr user an admin has set for them, otherwise the seerr user
+// linked to the same jellyfin/plex/emby account as one of their identities.
+// Emails aren't used, users can set theirs to anything.
+// Returns 0 (request as the api keys owner) if there isn't one and
+// `RequestAsOwnerFallback` is enabled, otherwise errors.
+func getSeerrUserId(db *gorm.DB, s *seerr.Seerr, userId uint) (int, error) {
+	var user User
+	if res := db.Select("seerr_user_id").Where("id = ?", userId).Take(&user); res.Error != nil {
+		slog.Error("getSeerrUserId: Failed to get user", "user_id", userId, "error", res.Error)
+		return 0, errors.New("failed to get user")
+	}
+	if user.SeerrUserID != 0 {
+		return user.SeerrUserID, nil
+	}
+	var identities []UserIdentity
+	if res := db.Where("user_id = ? AND type IN ?", userId, []UserType{JELLYFIN_USER, PLEX_USER, EMBY_USER}).Find(&identities); res.Error != nil {
+		slog.Error("getSeerrUserId: Failed to get user identities", "user_id", userId, "error", res.Error)
+		return 0, errors.New("failed to get user")
+	}
+	if len(identities) > 0 {
+		users, err := s.GetUsers()
+		if err != nil {
+			slog.Error("getSeerrUserId: Failed to get seerr users", "error", err)
+			return 0, errors.New("failed to get overseerr/jellyseerr users")
+		}
+		for _, i := range identities {
+			if id := findSeerrUserForIdentity(users, i); id != 0 {
+				return id, nil
+			}
+		}
+	}
+	if Config.SEERR.RequestAsOwnerFallback {
+		slog.Info("getSeerrUserId: No matching seerr user, requesting as api key owner", "user_id", userId)
+		return 0, nil
+	}
+	slog.Info("getSeerrUserId: No matching seerr user", "user_id", userId)
+	return 0, errors.New("no matching Overseerr/Jellyseerr user, link the account you use there or ask an admin to set it for you")
+}
+
+// Find the seerr user linked to the same jellyfin/plex/emby account
+// as an identity. Returns 0 if there isn't one.
+func findSeerrUserForIdentity(users []seerr.User, i UserIdentity) int {
+	if i.ThirdPartyID == "" {
+		return 0
+	}
+	for _, u := range users {
+		switch i.Type {
+		case PLEX_USER:
+			if u.PlexID != 0 && strconv.Itoa(u.PlexID) == i.ThirdPartyID {
+				return u.ID
+			}
+		case JELLYFIN_USER, EMBY_USER:
+			// Jellyfin ids are guids, which aren't always formatted the same.
+			if u.JellyfinUserID != "" && normalizeGuid(u.JellyfinUserID) == normalizeGuid(i.ThirdPartyID) {
+				return u.ID
+			}
+		}
+	}
+	return 0
+}
+
+func normalizeGuid(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+func getSeerrRequestStatus(s seerr.RequestStatus) ContentRequestStatus {
+	switch s {
+	case seerr.REQUEST_APPROVED, seerr.REQUEST_COMPLETED:
+		return CONTENT_REQUEST_APPROVED
+	case seerr.REQUEST_DECLINED:
+		return CONTENT_REQUEST_DENIED
+	case seerr.REQUEST_FAILED:
+		return CONTENT_REQUEST_FAILED
+	}
+	return CONTENT_REQUEST_PENDING
+}
+
+func getSeerrMediaStatus(s seerr.MediaStatus) RequestMediaStatus {
+	switch s {
+	case seerr.MEDIA_PENDING:
+		return REQUEST_MEDIA_PENDING
+	case seerr.MEDIA_PROCESSING:
+		return REQUEST_MEDIA_PROCESSING
+	case seerr.MEDIA_PARTIALLY_AVAILABLE:
+		return REQUEST_MEDIA_PARTIALLY_AVAILABLE
+	case seerr.MEDIA_AVAILABLE:
+		return REQUEST_MEDIA_AVAILABLE
+	}
+	return REQUEST_MEDIA_UNKNOWN
+}
+
+// Update open seerr requests with their status in seerr.
+// Requesters are notified when their request is reviewed, and when
+// the content becomes available.
+func syncSeerrRequests(db *gorm.DB) {
+	if !Config.SEERR.IsConfigured() {
+		return
+	}
+	var requests []ContentRequest
+	res := db.Preload("Content").
+		Where("backend = ? AND backend_request_id != 0", REQUEST_BACKEND_SEERR).
+		Where("status NOT IN ? AND media_status != ?", []ContentRequestStatus{CONTENT_REQUEST_DENIED, CONTENT_REQUEST_FAILED}, REQUEST_MEDIA_AVAILABLE).
+		Find(&requests)
+	if res.Error != nil {
+		slog.Error("syncSeerrRequests: Failed to get requests", "error", res.Error)
+		return
+	}
+	if len(requests) == 0 {
+		return
+	}
+	s := Config.SEERR.client()
+	for _, cr := range requests {
+		updates := map[string]interface{}{}
+		sr, err := s.GetRequest(cr.BackendRequestID)
+		if err != nil {
+			if !errors.Is(err, seerr.ErrNotFound) {
+				continue
+			}
+			// Removed from seerr, treat it like it was declined.
+			updates["status"] = CONTENT_REQUEST_DENIED
+			updates["review_note"] = "Request was removed from Overseerr/Jellyseerr."
+		} else {
+			if status := getSeerrRequestStatus(sr.Status); status != cr.Status {
+				updates["status"] = status
+			}
+			if ms := getSeerrMediaStatus(sr.Media.Status); ms != cr.MediaStatus {
+				updates["media_status"] = ms
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if status, ok := updates["status"]; ok {
+			updates["reviewed_at"] = time.Now()
+			cr.Status = status.(ContentRequestStatus)
+		}
+		if res := db.Model(&ContentRequest{}).Where("id = ?", cr.ID).Updates(updates); res.Error != nil {
+			slog.Error("syncSeerrRequests: Failed to update request", "id", cr.ID, "error", res.Error)
+			continue
+		}
+		slog.Debug("syncSeerrRequests: Request updated", "id", cr.ID, "updates", updates)
+		if _, ok := updates["status"]; ok && (cr.Status == CONTENT_REQUEST_APPROVED || cr.Status == CONTENT_REQUEST_DENIED) {
+			if note, ok := updates["review_note"]; ok {
+				cr.ReviewNote = note.(string)
+			}
+			go notifyContentRequestStatus(db, cr)
+		}
+		if updates["media_status"] == REQUEST_MEDIA_AVAILABLE {
+			go notifyContentAvailable(db, cr.Content, nil)
+		}
+	}
+}
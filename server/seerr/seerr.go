@@ -0,0 +1,164 @@
+// Overseerr and Jellyseerr (they share the same api).
+
+package seerr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/sbondCo/Watcharr/apiclient"
+)
+
+type RequestStatus int
+
+const (
+	REQUEST_PENDING  RequestStatus = 1
+	REQUEST_APPROVED RequestStatus = 2
+	REQUEST_DECLINED RequestStatus = 3
+	// Jellyseerr only.
+	REQUEST_FAILED    RequestStatus = 4
+	REQUEST_COMPLETED RequestStatus = 5
+)
+
+type MediaStatus int
+
+const (
+	MEDIA_UNKNOWN             MediaStatus = 1
+	MEDIA_PENDING             MediaStatus = 2
+	MEDIA_PROCESSING          MediaStatus = 3
+	MEDIA_PARTIALLY_AVAILABLE MediaStatus = 4
+	MEDIA_AVAILABLE           MediaStatus = 5
+)
+
+type Request struct {
+	ID     int           `json:"id"`
+	Status RequestStatus `json:"status"`
+	Media  struct {
+		ID     int         `json:"id"`
+		TmdbID int         `json:"tmdbId"`
+		Status MediaStatus `json:"status"`
+	} `json:"media"`
+}
+
+type User struct {
+	ID          int    `json:"id"`
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+	// Id of the users plex account, 0 if they aren't a plex user.
+	PlexID int `json:"plexId"`
+	// Id of the users jellyfin (or emby) account (Jellyseerr only).
+	JellyfinUserID string `json:"jellyfinUserId"`
+}
+
+// Returned when seerr responds with a non 2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("seerr responded with status %d", e.StatusCode)
+}
+
+// Lets `errors.Is(err, ErrNotFound)` match 404 responses.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+var ErrNotFound = errors.New("not found")
+
+type Options = apiclient.Options
+
+type Seerr struct {
+	Host   string
+	Key    string
+	client *apiclient.Client
+}
+
+func New(host string, key string, o Options) *Seerr {
+	return &Seerr{Host: host, Key: key, client: apiclient.New("seerr", host, "/api/v1", key, o, parseError)}
+}
+
+// Get the user the api key belongs to, useful for testing config.
+func (s *Seerr) GetMe() (User, error) {
+	var resp User
+	if err := s.client.Do(http.MethodGet, "/auth/me", nil, nil, &resp); err != nil {
+		slog.Error("seerr GetMe request failed", "error", err)
+		return User{}, err
+	}
+	return resp, nil
+}
+
+// Get all users (up to 1000, which should be plenty).
+func (s *Seerr) GetUsers() ([]User, error) {
+	var resp struct {
+		Results []User `json:"results"`
+	}
+	if err := s.client.Do(http.MethodGet, "/user", map[string]string{"take": "1000"}, nil, &resp); err != nil {
+		slog.Error("seerr GetUsers request failed", "error", err)
+		return []User{}, err
+	}
+	return resp.Results, nil
+}
+
+// Request a movie or show (`mediaType` is `movie` or `tv`).
+// Shows are requested with all of their seasons.
+// The request is made by `userId` if not 0, otherwise the api keys owner
+// (which will usually get it auto approved).
+func (s *Seerr) CreateRequest(mediaType string, tmdbId int, userId int) (Request, error) {
+	body := map[string]interface{}{
+		"mediaType": mediaType,
+		"mediaId":   tmdbId,
+	}
+	if mediaType == "tv" {
+		body["seasons"] = "all"
+	}
+	if userId != 0 {
+		body["userId"] = userId
+	}
+	var resp Request
+	if err := s.client.Do(http.MethodPost, "/request", nil, body, &resp); err != nil {
+		slog.Error("seerr CreateRequest request failed", "error", err)
+		return Request{}, err
+	}
+	return resp, nil
+}
+
+// Returns ErrNotFound if the request has been deleted.
+func (s *Seerr) GetRequest(id int) (Request, error) {
+	var resp Request
+	if err := s.client.Do(http.MethodGet, "/request/"+strconv.Itoa(id), nil, nil, &resp); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			slog.Error("seerr GetRequest request failed", "error", err)
+		}
+		return Request{}, err
+	}
+	return resp, nil
+}
+
+func (s *Seerr) DeleteRequest(id int) error {
+	if err := s.client.Do(http.MethodDelete, "/request/"+strconv.Itoa(id), nil, nil, nil); err != nil {
+		slog.Error("seerr DeleteRequest request failed", "error", err)
+		return err
+	}
+	return nil
+}
+
+// Build an Error from a failed responses body.
+func parseError(statusCode int, body []byte) error {
+	e := &Error{StatusCode: statusCode}
+	var m struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &m) == nil {
+		e.Message = m.Message
+	}
+	return e
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sbondCo/Watcharr/seerr"
+)
+
+func TestFindSeerrUserForIdentity(t *testing.T) {
+	users := []seerr.User{
+		// Email is what a user could set on their Watcharr account to pretend to be them.
+		{ID: 1, Email: "admin@example.com", PlexID: 1111},
+		{ID: 2, Email: "jf@example.com", JellyfinUserID: "5f2b3c4d6e7f48a9b0c1d2e3f4a5b6c7"},
+		{ID: 3, Email: "local@example.com"},
+	}
+	tests := []struct {
+		name     string
+		identity UserIdentity
+		want     int
+	}{
+		{"plex account id", UserIdentity{Type: PLEX_USER, ThirdPartyID: "1111"}, 1},
+		{"jellyfin user id", UserIdentity{Type: JELLYFIN_USER, ThirdPartyID: "5f2b3c4d6e7f48a9b0c1d2e3f4a5b6c7"}, 2},
+		{"jellyfin user id with dashes", UserIdentity{Type: JELLYFIN_USER, ThirdPartyID: "5F2B3C4D-6E7F-48A9-B0C1-D2E3F4A5B6C7"}, 2},
+		{"emby uses the jellyfin user id", UserIdentity{Type: EMBY_USER, ThirdPartyID: "5f2b3c4d6e7f48a9b0c1d2e3f4a5b6c7"}, 2},
+		{"plex id doesn't match jellyfin identity", UserIdentity{Type: JELLYFIN_USER, ThirdPartyID: "1111"}, 0},
+		{"unknown plex account", UserIdentity{Type: PLEX_USER, ThirdPartyID: "2222"}, 0},
+		{"watcharr identity never matches", UserIdentity{Type: WATCHARR_USER, ThirdPartyID: "admin@example.com"}, 0},
+		{"empty third party id", UserIdentity{Type: JELLYFIN_USER}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findSeerrUserForIdentity(users, tt.identity); got != tt.want {
+				t.Errorf("findSeerrUserForIdentity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSeerrRequestStatus(t *testing.T) {
+	tests := []struct {
+		status seerr.RequestStatus
+		want   ContentRequestStatus
+	}{
+		{seerr.REQUEST_PENDING, CONTENT_REQUEST_PENDING},
+		{seerr.REQUEST_APPROVED, CONTENT_REQUEST_APPROVED},
+		{seerr.REQUEST_DECLINED, CONTENT_REQUEST_DENIED},
+		{seerr.REQUEST_FAILED, CONTENT_REQUEST_FAILED},
+		// Completed requests were approved, availability is tracked by the media status.
+		{seerr.REQUEST_COMPLETED, CONTENT_REQUEST_APPROVED},
+		// Unknown statuses from newer seerr versions stay open.
+		{seerr.RequestStatus(0), CONTENT_REQUEST_PENDING},
+		{seerr.RequestStatus(99), CONTENT_REQUEST_PENDING},
+	}
+	for _, tt := range tests {
+		if got := getSeerrRequestStatus(tt.status); got != tt.want {
+			t.Errorf("getSeerrRequestStatus(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestGetSeerrMediaStatus(t *testing.T) {
+	tests := []struct {
+		status seerr.MediaStatus
+		want   RequestMediaStatus
+	}{
+		{seerr.MEDIA_UNKNOWN, REQUEST_MEDIA_UNKNOWN},
+		{seerr.MEDIA_PENDING, REQUEST_MEDIA_PENDING},
+		{seerr.MEDIA_PROCESSING, REQUEST_MEDIA_PROCESSING},
+		{seerr.MEDIA_PARTIALLY_AVAILABLE, REQUEST_MEDIA_PARTIALLY_AVAILABLE},
+		{seerr.MEDIA_AVAILABLE, REQUEST_MEDIA_AVAILABLE},
+		{seerr.MediaStatus(99), REQUEST_MEDIA_UNKNOWN},
+	}
+	for _, tt := range tests {
+		if got := getSeerrMediaStatus(tt.status); got != tt.want {
+			t.Errorf("getSeerrMediaStatus(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Our tokens don't expire, so to log a user out everywhere (eg when
+// they are disabled by an admin) we save the time their sessions were
+// revoked on the user and reject any token issued before it.
+//
+// Routes using `AuthRequired(nil)` don't touch the db, so the revoked
+// times (and users that must change their password) are also kept in
+// memory. Loaded from the db on startup and updated whenever they change.
+var (
+	revokedSessions       = make(map[uint]time.Time)
+	passwordResetRequired = make(map[uint]bool)
+	revokedSessionsMutex  sync.RWMutex
+)
+
+// Invalidate all tokens issued to a user up until now.
+func revokeUserSessions(db *gorm.DB, userId uint) {
+	slog.Debug("revokeUserSessions: Revoking sessions for user", "user_id", userId)
+	now := time.Now()
+	if err := db.Model(&User{}).Where("id = ?", userId).Update("sessions_revoked_at", now).Error; err != nil {
+		// Still revoked in memory, but won't survive a restart.
+		slog.Error("revokeUserSessions: Failed to save revoked time", "user_id", userId, "error", err)
+	}
+	revokedSessionsMutex.Lock()
+	defer revokedSessionsMutex.Unlock()
+	revokedSessions[userId] = now
+}
+
+// If a token issued at `issuedAt` has been revoked.
+func isSessionRevoked(userId uint, issuedAt time.Time) bool {
+	revokedSessionsMutex.RLock()
+	defer revokedSessionsMutex.RUnlock()
+	revokedAt, ok := revokedSessions[userId]
+	if !ok {
+		return false
+	}
+	return isRevokedAt(issuedAt, revokedAt)
+}
+
+func isRevokedAt(issuedAt time.Time, revokedAt time.Time) bool {
+	// Token issued at times only have second precision.
+	return issuedAt.Before(revokedAt.Truncate(time.Second))
+}
+
+// Keep our in memory copy of a users `PasswordResetRequired` up to date.
+// Call after it is changed in the db.
+func setPasswordResetRequired(userId uint, required bool) {
+	revokedSessionsMutex.Lock()
+	defer revokedSessionsMutex.Unlock()
+	if required {
+		passwordResetRequired[userId] = true
+	} else {
+		delete(passwordResetRequired, userId)
+	}
+}
+
+func isPasswordResetRequired(userId uint) bool {
+	revokedSessionsMutex.RLock()
+	defer revokedSessionsMutex.RUnlock()
+	return passwordResetRequired[userId]
+}
+
+// Load revoked sessions and users that must change their password.
+// Disabled users from before revoked times were saved have theirs set now.
+func loadRevokedSessions(db *gorm.DB) {
+	var users []User
+	err := db.Select("id", "disabled", "sessions_revoked_at", "password_reset_required").
+		Where("sessions_revoked_at IS NOT NULL OR disabled = ? OR password_reset_required = ?", true, true).
+		Find(&users).Error
+	if err != nil {
+		slog.Error("loadRevokedSessions: Failed to get users", "error", err)
+		return
+	}
+	for _, u := range users {
+		if u.PasswordResetRequired {
+			setPasswordResetRequired(u.ID, true)
+		}
+		if u.SessionsRevokedAt == nil {
+			if u.Disabled {
+				revokeUserSessions(db, u.ID)
+			}
+			continue
+		}
+		revokedSessionsMutex.Lock()
+		revokedSessions[u.ID] = *u.SessionsRevokedAt
+		revokedSessionsMutex.Unlock()
+	}
+	slog.Debug("loadRevokedSessions: Loaded users revoked sessions", "amount", len(users))
+}
@@ -21,6 +21,12 @@ func setupMinutelyTasks(db *gorm.DB) {
 		// Runs funcs that are in the place where we are cleaning.
 		// Bit cleaner and we can keep the related code close to its home.
 		cleanupTokens(db)
+		cleanupLoginAttempts()
+		// Arr requests can be slow, don't hold up the other tasks.
+		go pollArrDownloads(db)
+		syncSeerrRequests(db)
+		cleanupTMDBCache(db)
+		backfillContentCollections(db)
 	}
 }
 
@@ -31,5 +37,9 @@ func setupDailyTasks(db *gorm.DB) {
 
 	for range ticker.C {
 		cleanupImages(db)
+		cleanupRetiredJWTSecrets()
+		cleanupMetadataCache()
+		cleanupAuditLogs(db)
+		refreshRecommendations(db)
 	}
 }
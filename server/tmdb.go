@@ -3,11 +3,11 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"io"
 	"log/slog"
-	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/sbondCo/Watcharr/metadata"
 )
 
 type TMDBSearchMultiResponse struct {
@@ -75,22 +75,51 @@ type TMDBContentDetails struct {
 
 type TMDBMovieDetails struct {
 	TMDBContentDetails
-	Adult               bool   `json:"adult"`
-	BelongsToCollection any    `json:"belongs_to_collection"`
-	Budget              uint32 `json:"budget"`
-	ImdbID              string `json:"imdb_id"`
-	OriginalTitle       string `json:"original_title"`
-	ReleaseDate         string `json:"release_date"`
-	Revenue             uint32 `json:"revenue"`
-	Runtime             uint32 `json:"runtime"`
-	Title               string `json:"title"`
-	Video               bool   `json:"video"`
+	Adult               bool               `json:"adult"`
+	BelongsToCollection *TMDBCollectionRef `json:"belongs_to_collection"`
+	Budget              uint32             `json:"budget"`
+	ImdbID              string             `json:"imdb_id"`
+	OriginalTitle       string             `json:"original_title"`
+	ReleaseDate         string             `json:"release_date"`
+	Revenue             uint32             `json:"revenue"`
+	Runtime             uint32             `json:"runtime"`
+	Title               string             `json:"title"`
+	Video               bool               `json:"video"`
 
 	// Extra items because we use `append_to_response` on the request
 	Videos         TMDBContentVideos    `json:"videos"`
 	WatchProviders interface{}          `json:"watch/providers"`
 	Similar        TMDBMovieSimilar     `json:"similar"`
 	ExternalIds    TMDBExternalIdsMovie `json:"external_ids"`
+
+	// Added by us, from the other metadata providers.
+	Ratings []metadata.Rating `json:"ratings,omitempty"`
+}
+
+type TMDBCollectionRef struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+}
+
+type TMDBCollectionDetails struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Overview     string `json:"overview"`
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+	Parts        []struct {
+		ID           int     `json:"id"`
+		Title        string  `json:"title"`
+		Overview     string  `json:"overview"`
+		PosterPath   string  `json:"poster_path"`
+		BackdropPath string  `json:"backdrop_path"`
+		ReleaseDate  string  `json:"release_date"`
+		Popularity   float64 `json:"popularity"`
+		VoteAverage  float64 `json:"vote_average"`
+		VoteCount    int     `json:"vote_count"`
+	} `json:"parts"`
 }
 
 type TMDBShowDetails struct {
@@ -148,6 +177,9 @@ type TMDBShowDetails struct {
 	Similar        TMDBShowSimilar     `json:"similar"`
 	ExternalIds    TMDBExternalIdsShow `json:"external_ids"`
 	Keywords       TMDBKeywords        `json:"keywords"`
+
+	// Added by us, from the other metadata providers.
+	Ratings []metadata.Rating `json:"ratings,omitempty"`
 }
 
 type WatchProvider struct {
@@ -483,6 +515,18 @@ type TMDBExternalIdsShow struct {
 	TvrageID    int    `json:"tvrage_id"`
 }
 
+// Response of /find/{external_id}.
+type TMDBFindResponse struct {
+	MovieResults []struct {
+		ID    int    `json:"id"`
+		Title string `json:"title"`
+	} `json:"movie_results"`
+	TvResults []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"tv_results"`
+}
+
 type TMDBKeywords struct {
 	// ID      int `json:"id"`
 	Results []struct {
@@ -500,7 +544,7 @@ func getTMDBKey() string {
 
 func tmdbAPIRequest(ep string, p map[string]string) ([]byte, error) {
 	slog.Debug("tmdbAPIRequest", "endpoint", ep, "params", p)
-	base, err := url.Parse("https://api.themoviedb.org/3")
+	base, err := url.Parse(getTMDBBaseURL())
 	if err != nil {
 		return nil, errors.New("failed to parse api uri")
 	}
@@ -510,30 +554,20 @@ func tmdbAPIRequest(ep string, p map[string]string) ([]byte, error) {
 
 	// Query params
 	params := url.Values{}
-	params.Add("api_key", getTMDBKey())
-	params.Add("language", "en-US")
 	for k, v := range p {
 		params.Add(k, v)
 	}
-
-	// Add params to url
-	base.RawQuery = params.Encode()
-
-	// Run get request
-	res, err := http.Get(base.String())
-	if err != nil {
-		return nil, err
-	}
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != 200 {
-		slog.Error("TMDB non 200 status code:", "status_code", res.StatusCode)
-		return nil, errors.New(string(body))
+	// Callers pass the users language, otherwise the servers is used.
+	if params.Get("language") == "" {
+		params.Set("language", getServerLanguage())
 	}
-	return body, nil
+
+	// Encode sorts params, so the same request always gets the same key.
+	return tmdbCache.get(ep, ep+"?"+params.Encode(), func() ([]byte, error) {
+		params.Set("api_key", getTMDBKey())
+		base.RawQuery = params.Encode()
+		return tmdb.get(base.String())
+	})
 }
 
 func tmdbRequest(ep string, p map[string]string, resp interface{}) error {
@@ -0,0 +1,255 @@
+// Persistent cache of TMDB responses.
+// Responses are kept in the db, keyed by endpoint and params, so they
+// survive restarts. Each endpoint has its own ttl, once expired the cached
+// response is still served (for up to tmdbCacheMaxStale) while it is
+// refreshed in the background. The cache is kept under TMDB_CACHE_MAX_SIZE
+// by removing the least recently used responses.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Ttl of endpoints not in tmdbCacheTTLs.
+	tmdbCacheDefaultTTL = 24 * time.Hour
+	// How long after expiring a response can still be served while refreshing it.
+	tmdbCacheMaxStale = 7 * 24 * time.Hour
+	// Default TMDB_CACHE_MAX_SIZE, in megabytes.
+	tmdbCacheDefaultMaxSize = 100
+	// Only update when an entry was last used this often, saves a write on every hit.
+	tmdbCacheTouchInterval = time.Hour
+)
+
+// Ttls of endpoints, the first matching pattern is used.
+var tmdbCacheTTLs = []struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}{
+	{regexp.MustCompile(`^/search/`), time.Hour},
+	{regexp.MustCompile(`^/trending/`), 3 * time.Hour},
+	{regexp.MustCompile(`^/(discover/|movie/upcoming)`), 6 * time.Hour},
+	{regexp.MustCompile(`^/(movie|tv)/\d+/credits`), 7 * 24 * time.Hour},
+	{regexp.MustCompile(`^/(person|find)/`), 7 * 24 * time.Hour},
+}
+
+type TMDBCacheEntry struct {
+	// Endpoint with its (sorted) params, minus the api key.
+	CacheKey   string `gorm:"primaryKey"`
+	Endpoint   string `gorm:"index"`
+	Body       []byte
+	Size       int
+	FetchedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time `gorm:"index"`
+}
+
+type TMDBCacheStats struct {
+	Entries int64 `json:"entries"`
+	// Size of all cached responses, in bytes.
+	Size int64 `json:"size"`
+	// In bytes.
+	MaxSize int64 `json:"maxSize"`
+	// Since the server started.
+	Hits   int64 `json:"hits"`
+	Stale  int64 `json:"stale"`
+	Misses int64 `json:"misses"`
+}
+
+type tmdbResponseCache struct {
+	db *gorm.DB
+	// Keys being refreshed in the background.
+	revalidating sync.Map
+
+	hits   atomic.Int64
+	stale  atomic.Int64
+	misses atomic.Int64
+}
+
+// Set by setupTMDBCache, responses aren't cached until then.
+var tmdbCache = &tmdbResponseCache{}
+
+func setupTMDBCache(db *gorm.DB) {
+	tmdbCache.db = db
+}
+
+func getTMDBCacheTTL(ep string) time.Duration {
+	for _, t := range tmdbCacheTTLs {
+		if t.pattern.MatchString(ep) {
+			return t.ttl
+		}
+	}
+	return tmdbCacheDefaultTTL
+}
+
+func getTMDBCacheMaxSize() int64 {
+	if Config.TMDB_CACHE_MAX_SIZE > 0 {
+		return int64(Config.TMDB_CACHE_MAX_SIZE) * 1024 * 1024
+	}
+	return tmdbCacheDefaultMaxSize * 1024 * 1024
+}
+
+// Get the response for `key` from the cache, or `fetch` and cache it.
+func (c *tmdbResponseCache) get(ep string, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c.db == nil {
+		return fetch()
+	}
+	var e TMDBCacheEntry
+	res := c.db.Where("cache_key = ?", key).Limit(1).Find(&e)
+	if res.Error != nil {
+		slog.Error("tmdbCache: Failed to get entry", "key", key, "error", res.Error)
+	}
+	now := time.Now()
+	if res.Error == nil && res.RowsAffected > 0 {
+		if now.Before(e.ExpiresAt) {
+			c.hits.Add(1)
+			c.touch(e, now)
+			return e.Body, nil
+		}
+		if now.Before(e.ExpiresAt.Add(tmdbCacheMaxStale)) {
+			c.stale.Add(1)
+			c.touch(e, now)
+			go c.revalidate(ep, key, fetch)
+			return e.Body, nil
+		}
+	}
+	c.misses.Add(1)
+	body, err := fetch()
+	if err != nil {
+		// Something old beats nothing when TMDB is having a bad time.
+		if e.CacheKey != "" {
+			slog.Warn("tmdbCache: Request failed, serving expired response", "key", key, "error", err)
+			return e.Body, nil
+		}
+		return nil, err
+	}
+	c.store(ep, key, body)
+	return body, nil
+}
+
+func (c *tmdbResponseCache) revalidate(ep string, key string, fetch func() ([]byte, error)) {
+	if _, running := c.revalidating.LoadOrStore(key, true); running {
+		return
+	}
+	defer c.revalidating.Delete(key)
+	body, err := fetch()
+	if err != nil {
+		slog.Warn("tmdbCache: Failed to revalidate entry", "key", key, "error", err)
+		return
+	}
+	c.store(ep, key, body)
+}
+
+func (c *tmdbResponseCache) store(ep string, key string, body []byte) {
+	now := time.Now()
+	e := TMDBCacheEntry{
+		CacheKey:   key,
+		Endpoint:   ep,
+		Body:       body,
+		Size:       len(body),
+		FetchedAt:  now,
+		ExpiresAt:  now.Add(getTMDBCacheTTL(ep)),
+		LastUsedAt: now,
+	}
+	if res := c.db.Save(&e); res.Error != nil {
+		slog.Error("tmdbCache: Failed to store entry", "key", key, "error", res.Error)
+	}
+}
+
+func (c *tmdbResponseCache) touch(e TMDBCacheEntry, now time.Time) {
+	if now.Sub(e.LastUsedAt) < tmdbCacheTouchInterval {
+		return
+	}
+	if res := c.db.Model(&TMDBCacheEntry{}).Where("cache_key = ?", e.CacheKey).Update("last_used_at", now); res.Error != nil {
+		slog.Error("tmdbCache: Failed to update last used", "key", e.CacheKey, "error", res.Error)
+	}
+}
+
+func getTMDBCacheStats(db *gorm.DB) (TMDBCacheStats, error) {
+	var s struct {
+		Entries int64
+		Size    int64
+	}
+	if res := db.Model(&TMDBCacheEntry{}).Select("COUNT(*) AS entries, COALESCE(SUM(size), 0) AS size").Scan(&s); res.Error != nil {
+		slog.Error("getTMDBCacheStats: Failed to get stats", "error", res.Error)
+		return TMDBCacheStats{}, errors.New("failed to get cache stats")
+	}
+	return TMDBCacheStats{
+		Entries: s.Entries,
+		Size:    s.Size,
+		MaxSize: getTMDBCacheMaxSize(),
+		Hits:    tmdbCache.hits.Load(),
+		Stale:   tmdbCache.stale.Load(),
+		Misses:  tmdbCache.misses.Load(),
+	}, nil
+}
+
+// Remove cached responses, only ones for endpoints
+// starting with `endpoint` if provided (eg `/movie/`).
+// Returns how many were removed.
+func purgeTMDBCache(db *gorm.DB, endpoint string) (int64, error) {
+	q := db.Where("1 = 1")
+	if endpoint != "" {
+		if !strings.HasPrefix(endpoint, "/") {
+			endpoint = "/" + endpoint
+		}
+		q = db.Where("substr(endpoint, 1, ?) = ?", len(endpoint), endpoint)
+	}
+	res := q.Delete(&TMDBCacheEntry{})
+	if res.Error != nil {
+		slog.Error("purgeTMDBCache: Failed to purge cache", "endpoint", endpoint, "error", res.Error)
+		return 0, errors.New("failed to purge cache")
+	}
+	slog.Info("purgeTMDBCache: Purged cache", "endpoint", endpoint, "removed", res.RowsAffected)
+	return res.RowsAffected, nil
+}
+
+// Remove responses too old to serve, then the least recently
+// used ones until the cache is under its max size.
+func cleanupTMDBCache(db *gorm.DB) {
+	res := db.Where("expires_at < ?", time.Now().Add(-tmdbCacheMaxStale)).Delete(&TMDBCacheEntry{})
+	if res.Error != nil {
+		slog.Error("cleanupTMDBCache: Failed to remove old entries", "error", res.Error)
+		return
+	}
+	var size int64
+	if res := db.Model(&TMDBCacheEntry{}).Select("COALESCE(SUM(size), 0)").Scan(&size); res.Error != nil {
+		slog.Error("cleanupTMDBCache: Failed to get cache size", "error", res.Error)
+		return
+	}
+	maxSize := getTMDBCacheMaxSize()
+	if size <= maxSize {
+		return
+	}
+	// Remove in batches, oldest first, until we are under.
+	removed := 0
+	for size > maxSize {
+		var entries []TMDBCacheEntry
+		if res := db.Select("cache_key", "size").Order("last_used_at ASC").Limit(100).Find(&entries); res.Error != nil || len(entries) == 0 {
+			break
+		}
+		keys := []string{}
+		for _, e := range entries {
+			if size <= maxSize {
+				break
+			}
+			keys = append(keys, e.CacheKey)
+			size -= int64(e.Size)
+		}
+		if res := db.Where("cache_key IN ?", keys).Delete(&TMDBCacheEntry{}); res.Error != nil {
+			slog.Error("cleanupTMDBCache: Failed to remove entries", "error", res.Error)
+			return
+		}
+		removed += len(keys)
+	}
+	slog.Info("cleanupTMDBCache: Cache over max size, removed least recently used", "removed", removed)
+}
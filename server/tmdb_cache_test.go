@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGetTMDBCacheTTL(t *testing.T) {
+	tests := []struct {
+		ep   string
+		want time.Duration
+	}{
+		{"/search/multi", time.Hour},
+		{"/trending/all/day", 3 * time.Hour},
+		{"/discover/movie", 6 * time.Hour},
+		{"/movie/upcoming", 6 * time.Hour},
+		{"/movie/603/credits", 7 * 24 * time.Hour},
+		{"/tv/1396/credits", 7 * 24 * time.Hour},
+		{"/person/287", 7 * 24 * time.Hour},
+		{"/find/tt0903747", 7 * 24 * time.Hour},
+		{"/movie/603", tmdbCacheDefaultTTL},
+		{"/tv/1396/season/1", tmdbCacheDefaultTTL},
+		// Patterns only match from the start.
+		{"/movie/search/603", tmdbCacheDefaultTTL},
+		{"/movie/credits", tmdbCacheDefaultTTL},
+	}
+	for _, tt := range tests {
+		if got := getTMDBCacheTTL(tt.ep); got != tt.want {
+			t.Errorf("getTMDBCacheTTL(%q) = %v, want %v", tt.ep, got, tt.want)
+		}
+	}
+}
+
+func TestCleanupTMDBCache(t *testing.T) {
+	const mb = 1024 * 1024
+	now := time.Now()
+	fresh := now.Add(time.Hour)
+	// Expired, but can still be served while refreshing.
+	stale := now.Add(-time.Hour)
+	tooOld := now.Add(-tmdbCacheMaxStale - time.Hour)
+	tests := []struct {
+		name    string
+		maxSize int
+		entries []TMDBCacheEntry
+		want    []string
+	}{
+		{
+			name:    "under max size",
+			maxSize: 1,
+			entries: []TMDBCacheEntry{
+				{CacheKey: "a", Size: mb / 4, ExpiresAt: fresh, LastUsedAt: now.Add(-3 * time.Hour)},
+				{CacheKey: "b", Size: mb / 4, ExpiresAt: stale, LastUsedAt: now},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name:    "too old to serve",
+			maxSize: 1,
+			entries: []TMDBCacheEntry{
+				{CacheKey: "a", Size: 10, ExpiresAt: tooOld, LastUsedAt: now},
+				{CacheKey: "b", Size: 10, ExpiresAt: stale, LastUsedAt: now},
+			},
+			want: []string{"b"},
+		},
+		{
+			name:    "least recently used removed until under max size",
+			maxSize: 1,
+			entries: []TMDBCacheEntry{
+				{CacheKey: "a", Size: mb * 2 / 5, ExpiresAt: fresh, LastUsedAt: now.Add(-time.Minute)},
+				{CacheKey: "b", Size: mb * 2 / 5, ExpiresAt: fresh, LastUsedAt: now.Add(-3 * time.Hour)},
+				{CacheKey: "c", Size: mb * 2 / 5, ExpiresAt: fresh, LastUsedAt: now.Add(-2 * time.Hour)},
+				{CacheKey: "d", Size: mb * 2 / 5, ExpiresAt: fresh, LastUsedAt: now},
+			},
+			want: []string{"a", "d"},
+		},
+		{
+			name:    "too old are removed before counting size",
+			maxSize: 1,
+			entries: []TMDBCacheEntry{
+				{CacheKey: "a", Size: mb / 2, ExpiresAt: tooOld, LastUsedAt: now},
+				{CacheKey: "b", Size: mb / 2, ExpiresAt: fresh, LastUsedAt: now.Add(-time.Hour)},
+				{CacheKey: "c", Size: mb / 2, ExpiresAt: fresh, LastUsedAt: now},
+			},
+			want: []string{"b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := Config.TMDB_CACHE_MAX_SIZE
+			Config.TMDB_CACHE_MAX_SIZE = tt.maxSize
+			t.Cleanup(func() { Config.TMDB_CACHE_MAX_SIZE = old })
+			db := newTestDB(t, &TMDBCacheEntry{})
+			if err := db.Create(&tt.entries).Error; err != nil {
+				t.Fatal("failed to create entries:", err)
+			}
+
+			cleanupTMDBCache(db)
+
+			got := []string{}
+			if err := db.Model(&TMDBCacheEntry{}).Pluck("cache_key", &got).Error; err != nil {
+				t.Fatal("failed to get entries:", err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries left = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
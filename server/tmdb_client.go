@@ -0,0 +1,245 @@
+// Http client used for all TMDB requests.
+// Imports and media server syncs can fire off a lot of requests at once,
+// so requests are rate limited (TMDB allows ~50/s), retried with backoff
+// when TMDB is overloaded and identical in-flight requests are coalesced.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tmdbDefaultBaseURL = "https://api.themoviedb.org/3"
+	// Requests allowed per second, and how many can be made at once after being idle.
+	tmdbRateLimit = 40
+	tmdbRateBurst = 40
+	// Max requests waiting on a response at the same time.
+	tmdbMaxConcurrent = 20
+	tmdbTimeout       = 15 * time.Second
+	// Retries after the first attempt, on 429s, 5xxs and network errors.
+	tmdbMaxRetries = 3
+	tmdbRetryBase  = 500 * time.Millisecond
+	// Longest we will wait between retries, even if TMDB asks for more.
+	tmdbRetryMax = 30 * time.Second
+)
+
+// Returned when TMDB responds with a non 200 status.
+type TMDBError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *TMDBError) Error() string {
+	return e.Body
+}
+
+type TMDBMetrics struct {
+	// Requests sent to TMDB, including retries.
+	Requests int64 `json:"requests"`
+	// Requests that shared the response of an identical in-flight request.
+	Coalesced int64 `json:"coalesced"`
+	Retries   int64 `json:"retries"`
+	// Responses with status 429.
+	RateLimited int64 `json:"rateLimited"`
+	// Requests that failed after all retries.
+	Failures      int64      `json:"failures"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastFailureAt *time.Time `json:"lastFailureAt,omitempty"`
+}
+
+// Token bucket rate limiter.
+type tmdbLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Block until a request can be made.
+func (l *tmdbLimiter) wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if l.last.IsZero() {
+			l.tokens = tmdbRateBurst
+		} else {
+			l.tokens += now.Sub(l.last).Seconds() * tmdbRateLimit
+			if l.tokens > tmdbRateBurst {
+				l.tokens = tmdbRateBurst
+			}
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - l.tokens) / tmdbRateLimit * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+type tmdbCall struct {
+	wg   sync.WaitGroup
+	body []byte
+	err  error
+}
+
+type tmdbClient struct {
+	http     *http.Client
+	limiter  tmdbLimiter
+	sem      chan struct{}
+	mu       sync.Mutex
+	inflight map[string]*tmdbCall
+
+	requests    atomic.Int64
+	coalesced   atomic.Int64
+	retries     atomic.Int64
+	rateLimited atomic.Int64
+	failures    atomic.Int64
+	lastErrMu   sync.Mutex
+	lastErr     string
+	lastErrAt   *time.Time
+}
+
+var tmdb = &tmdbClient{
+	http:     &http.Client{Timeout: tmdbTimeout},
+	sem:      make(chan struct{}, tmdbMaxConcurrent),
+	inflight: map[string]*tmdbCall{},
+}
+
+// Get the TMDB api url, TMDB_BASE_URL can point it at a proxy/mirror.
+func getTMDBBaseURL() string {
+	if Config.TMDB_BASE_URL != "" {
+		return Config.TMDB_BASE_URL
+	}
+	return tmdbDefaultBaseURL
+}
+
+// Get `u`, sharing the response with any identical requests already in flight.
+func (t *tmdbClient) get(u string) ([]byte, error) {
+	t.mu.Lock()
+	if c, ok := t.inflight[u]; ok {
+		t.mu.Unlock()
+		t.coalesced.Add(1)
+		c.wg.Wait()
+		return c.body, c.err
+	}
+	c := &tmdbCall{}
+	c.wg.Add(1)
+	t.inflight[u] = c
+	t.mu.Unlock()
+
+	c.body, c.err = t.getWithRetry(u)
+	c.wg.Done()
+
+	t.mu.Lock()
+	delete(t.inflight, u)
+	t.mu.Unlock()
+	return c.body, c.err
+}
+
+func (t *tmdbClient) getWithRetry(u string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, err := t.do(u)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		var te *TMDBError
+		retryable := !errors.As(err, &te) || te.StatusCode == http.StatusTooManyRequests || te.StatusCode >= 500
+		if !retryable || attempt >= tmdbMaxRetries {
+			break
+		}
+		wait := retryAfter
+		if wait <= 0 {
+			// Exponential backoff with some jitter, so waiting requests don't all retry at once.
+			wait = tmdbRetryBase << attempt
+			wait += time.Duration(rand.Int63n(int64(wait / 2)))
+		}
+		if wait > tmdbRetryMax {
+			wait = tmdbRetryMax
+		}
+		t.retries.Add(1)
+		slog.Debug("tmdbClient: Retrying request", "attempt", attempt+1, "wait", wait, "error", err)
+		time.Sleep(wait)
+	}
+	t.failures.Add(1)
+	now := time.Now()
+	t.lastErrMu.Lock()
+	t.lastErr = lastErr.Error()
+	t.lastErrAt = &now
+	t.lastErrMu.Unlock()
+	return nil, lastErr
+}
+
+// Make one request. Returns how long TMDB asked us to wait
+// before retrying (from Retry-After), if it did.
+func (t *tmdbClient) do(u string) ([]byte, time.Duration, error) {
+	t.limiter.wait()
+	t.sem <- struct{}{}
+	defer func() { <-t.sem }()
+
+	t.requests.Add(1)
+	res, err := t.http.Get(u)
+	if err != nil {
+		// Drop the url from the error, it contains our api key.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, 0, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != 200 {
+		slog.Error("TMDB non 200 status code:", "status_code", res.StatusCode)
+		if res.StatusCode == http.StatusTooManyRequests {
+			t.rateLimited.Add(1)
+		}
+		return nil, parseRetryAfter(res.Header.Get("Retry-After")), &TMDBError{StatusCode: res.StatusCode, Body: string(body)}
+	}
+	return body, 0, nil
+}
+
+// Retry-After can be a number of seconds or a http date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if d, err := http.ParseTime(v); err == nil {
+		return time.Until(d)
+	}
+	return 0
+}
+
+func (t *tmdbClient) metrics() TMDBMetrics {
+	t.lastErrMu.Lock()
+	defer t.lastErrMu.Unlock()
+	return TMDBMetrics{
+		Requests:      t.requests.Load(),
+		Coalesced:     t.coalesced.Load(),
+		Retries:       t.retries.Load(),
+		RateLimited:   t.rateLimited.Load(),
+		Failures:      t.failures.Load(),
+		LastError:     t.lastErr,
+		LastFailureAt: t.lastErrAt,
+	}
+}
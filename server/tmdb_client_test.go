@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		// Http dates are relative to now, so allow a range.
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{"empty", "", 0, 0},
+		{"seconds", "5", 5 * time.Second, 5 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"large seconds", "3600", time.Hour, time.Hour},
+		{"http date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"http date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), -2 * time.Minute, 0},
+		{"garbage", "soon", 0, 0},
+		{"fractional seconds", "1.5", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.v)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.v, got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestTMDBLimiter(t *testing.T) {
+	// Time for one token to be added back.
+	perToken := time.Second / tmdbRateLimit
+	tests := []struct {
+		name     string
+		requests int
+		wantMin  time.Duration
+		wantMax  time.Duration
+	}{
+		{"single request", 1, 0, perToken},
+		{"burst is immediate", tmdbRateBurst, 0, perToken},
+		{"one over burst waits for a token", tmdbRateBurst + 1, perToken * 3 / 4, perToken * 8},
+		{"ten over burst waits for ten tokens", tmdbRateBurst + 10, perToken * 10 * 3 / 4, perToken * 10 * 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l tmdbLimiter
+			start := time.Now()
+			for i := 0; i < tt.requests; i++ {
+				l.wait()
+			}
+			if took := time.Since(start); took < tt.wantMin || took > tt.wantMax {
+				t.Errorf("%d requests took %v, want between %v and %v", tt.requests, took, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestTMDBLimiterRefills(t *testing.T) {
+	var l tmdbLimiter
+	for i := 0; i < tmdbRateBurst; i++ {
+		l.wait()
+	}
+	// Long enough for the whole burst to come back.
+	time.Sleep(time.Second * tmdbRateBurst / tmdbRateLimit)
+	start := time.Now()
+	for i := 0; i < tmdbRateBurst; i++ {
+		l.wait()
+	}
+	if took := time.Since(start); took > time.Second/tmdbRateLimit {
+		t.Errorf("burst after being idle took %v, want it to be immediate", took)
+	}
+}
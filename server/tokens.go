@@ -11,26 +11,50 @@ import (
 type TokenType string
 
 var (
-	TOKENTYPE_ADMIN TokenType = "ADMIN"
+	TOKENTYPE_ADMIN          TokenType = "ADMIN"
+	TOKENTYPE_INVITE         TokenType = "INVITE"
+	TOKENTYPE_PASSWORD_RESET TokenType = "PASSWORD_RESET"
+	TOKENTYPE_DELETE_ACCOUNT TokenType = "DELETE_ACCOUNT"
 )
 
 type Token struct {
-	ID        uint      `gorm:"primarykey"`
+	ID        uint      `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time `json:"createdAt"`
-	Value     string    `gorm:"not null"`
-	Type      TokenType `gorm:"not null"`
-	UserID    uint      `gorm:"not null"`
+	Value     string    `gorm:"not null" json:"value"`
+	Type      TokenType `gorm:"not null" json:"type"`
+	// User the token was created for (or by, for invites).
+	UserID uint `gorm:"not null" json:"userId"`
+	// When the token stops being valid. Tokens without an expiry date
+	// are cleaned up after `tokenMaxAge`, unless they are invites.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// How many times the token can be used, 0 for unlimited (invites only).
+	MaxUses int `gorm:"default:0" json:"maxUses"`
+	// How many times the token has been used (invites only).
+	Uses int `gorm:"default:0" json:"uses"`
+	// Permissions given to users registering with this token (invites only).
+	Permissions int `gorm:"default:0" json:"permissions"`
 }
 
 const tokenMaxAge = 2 * time.Minute
 
 func createOneUseToken(db *gorm.DB, t TokenType, userId uint) (string, error) {
+	return createOneUseTokenWithExpiry(db, t, userId, 0)
+}
+
+// Create a one use token that is valid for `expiresIn`.
+// If `expiresIn` is 0, the token is valid for `tokenMaxAge`.
+func createOneUseTokenWithExpiry(db *gorm.DB, t TokenType, userId uint, expiresIn time.Duration) (string, error) {
 	token, err := generateString(8)
 	if err != nil {
 		slog.Error("createOneUseToken: Failed to generate string!", "error", err)
 		return "", errors.New("failed to generate token")
 	}
-	res := db.Create(&Token{Type: t, Value: token, UserID: userId})
+	dbToken := Token{Type: t, Value: token, UserID: userId}
+	if expiresIn > 0 {
+		exp := time.Now().Add(expiresIn)
+		dbToken.ExpiresAt = &exp
+	}
+	res := db.Create(&dbToken)
 	if res.Error != nil {
 		slog.Error("createOneUseToken: Failed to insert token into db!", "error", res.Error)
 		return "", errors.New("failed to generate token")
@@ -38,11 +62,15 @@ func createOneUseToken(db *gorm.DB, t TokenType, userId uint) (string, error) {
 	return token, nil
 }
 
-// Cleans up tokens older than 2m.
+// Cleans up tokens older than 2m (if they have no expiry date),
+// expired tokens and invites that have been used up.
 func cleanupTokens(db *gorm.DB) {
 	slog.Debug("cleanupTokens: Cleaning up old tokens from db")
 	twoMinsAgo := time.Now().Add(-tokenMaxAge)
-	resp := db.Where("created_at < ?", twoMinsAgo).Delete(&Token{})
+	resp := db.Where("expires_at IS NULL AND type != ? AND created_at < ?", TOKENTYPE_INVITE, twoMinsAgo).
+		Or("expires_at < ?", time.Now()).
+		Or("type = ? AND max_uses > 0 AND uses >= max_uses", TOKENTYPE_INVITE).
+		Delete(&Token{})
 	if resp.Error != nil {
 		slog.Error("cleanupTokens: Failed to run DELETE on old tokens!", "error", resp.Error)
 	}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"net/mail"
 	"path"
 	"path/filepath"
 
@@ -31,12 +32,18 @@ type PrivateUser struct {
 	AvatarID    uint     `json:"-"`
 	Avatar      Image    `json:"avatar"`
 	Bio         string   `json:"bio"`
+	Email       string   `json:"email"`
 }
 
 type UserBioUpdateRequest struct {
 	NewBio string `json:"newBio" binding:"max=128"`
 }
 
+type UserEmailUpdateRequest struct {
+	// Empty to remove the users email.
+	Email string `json:"email" binding:"max=254"`
+}
+
 // Update user settings
 func userUpdate(db *gorm.DB, userId uint, ur UserSettings) (UserSettings, error) {
 	slog.Debug("user update request running", "user_id", userId, "ur", ur)
@@ -58,12 +65,37 @@ func userUpdate(db *gorm.DB, userId uint, ur UserSettings) (UserSettings, error)
 	if ur.IncludePreviouslyWatched != nil {
 		user.IncludePreviouslyWatched = ur.IncludePreviouslyWatched
 	}
+	if ur.AutoRequestPlanned != nil {
+		user.AutoRequestPlanned = ur.AutoRequestPlanned
+	}
+	if ur.Language != nil {
+		if *ur.Language != "" {
+			if err := validateLanguage(*ur.Language); err != nil {
+				return UserSettings{}, err
+			}
+		}
+		user.Language = ur.Language
+	}
+	if ur.Country != nil {
+		if *ur.Country != "" {
+			if err := validateCountry(*ur.Country); err != nil {
+				return UserSettings{}, err
+			}
+		}
+		user.Country = ur.Country
+	}
 	db.Save(&user)
+	if ur.Language != nil || ur.Country != nil {
+		forgetUserWhereabouts(userId)
+	}
 	return UserSettings{
 		Private:                  user.Private,
 		PrivateThoughts:          user.PrivateThoughts,
 		HideSpoilers:             user.HideSpoilers,
 		IncludePreviouslyWatched: user.IncludePreviouslyWatched,
+		AutoRequestPlanned:       user.AutoRequestPlanned,
+		Language:                 user.Language,
+		Country:                  user.Country,
 	}, nil
 }
 
@@ -80,6 +112,9 @@ func userGetSettings(db *gorm.DB, userId uint) (UserSettings, error) {
 		PrivateThoughts:          user.PrivateThoughts,
 		HideSpoilers:             user.HideSpoilers,
 		IncludePreviouslyWatched: user.IncludePreviouslyWatched,
+		AutoRequestPlanned:       user.AutoRequestPlanned,
+		Language:                 user.Language,
+		Country:                  user.Country,
 	}, nil
 }
 
@@ -126,6 +161,21 @@ func userUpdateBio(db *gorm.DB, userId uint, newBio string) error {
 	return nil
 }
 
+func userUpdateEmail(db *gorm.DB, userId uint, email string) error {
+	slog.Debug("userUpdateEmail request running", "user_id", userId)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return errors.New("invalid email")
+		}
+	}
+	if res := db.Model(&User{}).Where("id = ?", userId).Update("email", email); res.Error != nil {
+		slog.Error("userUpdateEmail failed", "user_id", userId, "error", res.Error)
+		return errors.New("failed to update email")
+	}
+	return nil
+}
+
 func uploadUserAvatar(c *gin.Context, db *gorm.DB, userId uint) (Image, error) {
 	file, err := c.FormFile("avatar")
 	if err != nil {
@@ -0,0 +1,205 @@
+// Account deletion. Deleting an account removes all of the users data.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UserDeleteRequest struct {
+	// Current password, required for Watcharr users.
+	Password string `json:"password"`
+	// Token from `createMediaServerDeleteToken` or `createPlexDeleteToken`
+	// for users without a Watcharr login (eg jellyfin or plex only users).
+	Token string `json:"token"`
+	// If an export of the users data should be returned.
+	Export bool `json:"export"`
+}
+
+// All of a users data, returned before deleting their account if wanted.
+type UserDataExport struct {
+	ExportedAt time.Time      `json:"exportedAt"`
+	User       PrivateUser    `json:"user"`
+	Settings   UserSettings   `json:"settings"`
+	Watched    []Watched      `json:"watched"`
+	Following  []FollowPublic `json:"following"`
+}
+
+func exportUserData(db *gorm.DB, userId uint) (UserDataExport, error) {
+	user, err := getUserInfo(db, userId)
+	if err != nil {
+		return UserDataExport{}, err
+	}
+	settings, err := userGetSettings(db, userId)
+	if err != nil {
+		return UserDataExport{}, err
+	}
+	following, err := getFollows(db, userId)
+	if err != nil {
+		return UserDataExport{}, err
+	}
+	return UserDataExport{
+		ExportedAt: time.Now(),
+		User:       user,
+		Settings:   settings,
+		Watched:    getWatched(db, userId),
+		Following:  following,
+	}, nil
+}
+
+// Create a delete token for a user without a Watcharr login, once they
+// have logged in to the media server account that is linked to them again.
+// A session token alone isn't enough, so a stolen session can't delete the account.
+func createMediaServerDeleteToken(db *gorm.DB, s MediaServer, userId uint, ja JellyfinAuth) (string, error) {
+	if userHasPassword(db, userId) {
+		return "", errors.New("use your password to delete your account")
+	}
+	identity, err := getUserIdentity(db, userId, s.UserType)
+	if err != nil {
+		return "", errors.New("you don't have a " + s.Name + " account linked")
+	}
+	resp, err := authenticateMediaServer(s, ja.Username, ja.Pw)
+	if err != nil {
+		return "", err
+	}
+	if resp.User.ID != identity.ThirdPartyID {
+		slog.Warn("createMediaServerDeleteToken: Logged in to a different account than the one linked", "user_id", userId, "server", s.Name)
+		return "", errors.New("that isn't the " + s.Name + " account linked to you")
+	}
+	return createOneUseToken(db, TOKENTYPE_DELETE_ACCOUNT, userId)
+}
+
+// Create a delete token for a user without a Watcharr login, from
+// a fresh auth token for the Plex account that is linked to them.
+func createPlexDeleteToken(db *gorm.DB, userId uint, lr PlexLoginRequest) (string, error) {
+	if userHasPassword(db, userId) {
+		return "", errors.New("use your password to delete your account")
+	}
+	identity, err := getUserIdentity(db, userId, PLEX_USER)
+	if err != nil {
+		return "", errors.New("you don't have a plex account linked")
+	}
+	account, err := getPlexAccount(lr.AuthToken)
+	if err != nil {
+		return "", err
+	}
+	if strconv.FormatUint(account.Id, 10) != identity.ThirdPartyID {
+		slog.Warn("createPlexDeleteToken: Logged in to a different account than the one linked", "user_id", userId)
+		return "", errors.New("that isn't the plex account linked to you")
+	}
+	return createOneUseToken(db, TOKENTYPE_DELETE_ACCOUNT, userId)
+}
+
+// Check the user has confirmed they want to delete their account.
+func confirmUserDelete(db *gorm.DB, user User, dr UserDeleteRequest) error {
+	if userHasPassword(db, user.ID) {
+		if dr.Password == "" {
+			return errors.New("password required")
+		}
+		match, err := compareHash(dr.Password, user.Password)
+		if err != nil {
+			slog.Error("confirmUserDelete: Failed to compare password", "user_id", user.ID, "error", err)
+			return errors.New("failed to compare passwords")
+		}
+		if !match {
+			return errors.New("incorrect password")
+		}
+		return nil
+	}
+	if dr.Token == "" {
+		return errors.New("token required")
+	}
+	var dbToken Token
+	res := db.Where("value = ? AND type = ? AND user_id = ?", dr.Token, TOKENTYPE_DELETE_ACCOUNT, user.ID).Take(&dbToken)
+	if res.Error != nil {
+		slog.Info("confirmUserDelete failed", "error", "token not found in db", "user_id", user.ID)
+		return errors.New("invalid token")
+	}
+	if time.Since(dbToken.CreatedAt) > tokenMaxAge {
+		slog.Info("confirmUserDelete failed", "error", "token in db has expired", "user_id", user.ID)
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// Delete the current users account, after they have confirmed it.
+// Returns an export of their data first if requested.
+func userDelete(db *gorm.DB, userId uint, dr UserDeleteRequest) (*UserDataExport, error) {
+	var user User
+	if res := db.Where("id = ?", userId).Take(&user); res.Error != nil {
+		slog.Error("userDelete: Failed to get user", "user_id", userId, "error", res.Error)
+		return nil, errors.New("failed to retrieve user")
+	}
+	if err := confirmUserDelete(db, user, dr); err != nil {
+		return nil, err
+	}
+	var export *UserDataExport
+	if dr.Export {
+		e, err := exportUserData(db, userId)
+		if err != nil {
+			slog.Error("userDelete: Failed to export user data", "user_id", userId, "error", err)
+			return nil, errors.New("failed to export data")
+		}
+		export = &e
+	}
+	if err := purgeUser(db, userId); err != nil {
+		return nil, err
+	}
+	slog.Info("userDelete: User deleted their account", "user_id", userId)
+	return export, nil
+}
+
+// Hard delete a user and all of their data.
+func purgeUser(db *gorm.DB, userId uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&WatchedEpisode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&WatchedSeason{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&Activity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&Watched{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ? OR followed_user_id = ?", userId, userId).Delete(&Follow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&ContentRequest{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&ArrDownload{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&Recommendation{}).Error; err != nil {
+			return err
+		}
+		// The users avatar reference goes with their row, the image itself
+		// is removed by `cleanupImages` if no other user is using it.
+		if err := tx.Unscoped().Where("id = ?", userId).Delete(&User{}).Error; err != nil {
+			return err
+		}
+		// commit transaction if no errors
+		return nil
+	})
+	if err != nil {
+		slog.Error("purgeUser: Failed to delete user data", "user_id", userId, "error", err)
+		return errors.New("failed to delete user")
+	}
+	revokeUserSessions(db, userId)
+	forgetUserWhereabouts(userId)
+	return nil
+}
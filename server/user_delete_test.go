@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Point jellyfin at a server that only lets `username` login, as jellyfin user `jellyfinId`.
+func setupJellyfinAuth(t *testing.T, username string, jellyfinId string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ja JellyfinAuth
+		if err := json.NewDecoder(r.Body).Decode(&ja); err != nil || ja.Username != username || ja.Pw != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"AccessToken": "jf-token", "User": {"Id": "` + jellyfinId + `", "Name": "` + username + `"}}`))
+	}))
+	old := Config.JELLYFIN_HOST
+	Config.JELLYFIN_HOST = srv.URL
+	t.Cleanup(func() {
+		srv.Close()
+		Config.JELLYFIN_HOST = old
+	})
+}
+
+func TestCreateMediaServerDeleteToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		identities []UserIdentity
+		auth       JellyfinAuth
+		wantErr    bool
+	}{
+		{
+			name:       "linked account",
+			identities: []UserIdentity{{Type: JELLYFIN_USER, ThirdPartyID: "jf-linked", Username: "linked"}},
+			auth:       JellyfinAuth{Username: "linked", Pw: "password"},
+		},
+		{
+			name:       "wrong password",
+			identities: []UserIdentity{{Type: JELLYFIN_USER, ThirdPartyID: "jf-linked", Username: "linked"}},
+			auth:       JellyfinAuth{Username: "linked", Pw: "guess"},
+			wantErr:    true,
+		},
+		{
+			name:       "someone elses account",
+			identities: []UserIdentity{{Type: JELLYFIN_USER, ThirdPartyID: "jf-other", Username: "other"}},
+			auth:       JellyfinAuth{Username: "linked", Pw: "password"},
+			wantErr:    true,
+		},
+		{
+			name:       "no jellyfin account linked",
+			identities: []UserIdentity{{Type: PLEX_USER, ThirdPartyID: "1111", Username: "linked"}},
+			auth:       JellyfinAuth{Username: "linked", Pw: "password"},
+			wantErr:    true,
+		},
+		{
+			name: "user has a password",
+			identities: []UserIdentity{
+				{Type: JELLYFIN_USER, ThirdPartyID: "jf-linked", Username: "linked"},
+				{Type: WATCHARR_USER, ThirdPartyID: "linked", Username: "linked"},
+			},
+			auth:    JellyfinAuth{Username: "linked", Pw: "password"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupJellyfinAuth(t, "linked", "jf-linked")
+			db := newTestDB(t, &Image{}, &User{}, &UserIdentity{}, &Token{})
+			user := User{Username: "linked"}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatal("failed to create user:", err)
+			}
+			for _, i := range tt.identities {
+				i.UserID = user.ID
+				if err := db.Create(&i).Error; err != nil {
+					t.Fatal("failed to create identity:", err)
+				}
+			}
+
+			token, err := createMediaServerDeleteToken(db, JellyfinServer, user.ID, tt.auth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createMediaServerDeleteToken() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var count int64
+				db.Model(&Token{}).Where("type = ?", TOKENTYPE_DELETE_ACCOUNT).Count(&count)
+				if count != 0 {
+					t.Errorf("%d delete tokens created, want 0", count)
+				}
+				return
+			}
+			if err := confirmUserDelete(db, user, UserDeleteRequest{Token: token}); err != nil {
+				t.Error("confirmUserDelete() rejected the token:", err)
+			}
+		})
+	}
+}
+
+func TestConfirmUserDeleteWithoutPassword(t *testing.T) {
+	db := newTestDB(t, &Image{}, &User{}, &UserIdentity{}, &Token{})
+	users := []User{{Username: "user"}, {Username: "other"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal("failed to create users:", err)
+	}
+	otherToken, err := createOneUseToken(db, TOKENTYPE_DELETE_ACCOUNT, users[1].ID)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	resetToken, err := createOneUseToken(db, TOKENTYPE_PASSWORD_RESET, users[0].ID)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"made up token", "made-up"},
+		{"another users token", otherToken},
+		{"another type of token", resetToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := confirmUserDelete(db, users[0], UserDeleteRequest{Token: tt.token}); err == nil {
+				t.Error("confirmUserDelete() accepted the token")
+			}
+		})
+	}
+}
@@ -80,10 +80,24 @@ func main() {
 		&Follow{},
 		&Image{},
 		&Game{},
+		&AuditLog{},
+		&UserIdentity{},
+		&ContentRequest{},
+		&ArrDownload{},
+		&TMDBCacheEntry{},
+		&Recommendation{},
+		&Collection{},
+		&CollectionPart{},
 	)
 	if err != nil {
 		log.Fatal("Failed to auto migrate database:", err)
 	}
+	if err := migrateUserIdentities(db); err != nil {
+		log.Fatal("Failed to migrate users to identities:", err)
+	}
+
+	loadRevokedSessions(db)
+	setupTMDBCache(db)
 
 	if isProd {
 		go runUI()
@@ -91,6 +105,11 @@ func main() {
 	}
 	gin.DefaultWriter = multiw
 	gine := gin.Default()
+	// Gin trusts X-Forwarded-For from anyone by default, letting
+	// clients choose their own ip.
+	if err := gine.SetTrustedProxies(getTrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES in config:", err)
+	}
 	gine.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -130,14 +149,21 @@ func main() {
 	br.addWatchedRoutes()
 	br.addActivityRoutes()
 	br.addProfileRoutes()
-	br.addJellyfinRoutes()
+	br.addMediaServerRoutes(JellyfinServer)
+	br.addMediaServerRoutes(EmbyServer)
 	br.addUserRoutes()
 	br.addFollowRoutes()
+	br.addRecommendationRoutes()
+	br.addCollectionRoutes()
 	br.addImportRoutes()
 	br.addServerRoutes()
+	br.addAdminRoutes()
 	br.addFeatureRoutes()
 	br.addSonarrRoutes()
 	br.addRadarrRoutes()
+	br.addArrRoutes()
+	br.addContentRequestRoutes()
+	br.addArrWebhookRoutes()
 	br.addJobRoutes()
 	br.rg.Static("/img", path.Join(DataPath, "img"))
 